@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"go_backend/data"
+	"go_backend/menu"
+	"go_backend/migrations"
+	"go_backend/models"
+	"go_backend/repository"
+)
+
+// runCommand handles the command line subcommands. It reports false when
+// args name no subcommand and the server should start.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "import":
+		os.Exit(importCommand(args[1:]))
+	case "export":
+		os.Exit(exportCommand(args[1:]))
+	case "migrate":
+		os.Exit(migrateCommand(args[1:]))
+	case "super-admin":
+		os.Exit(superAdminCommand(args[1:]))
+	}
+	return false
+}
+
+// importCommand imports a menu file:
+//
+//	go_backend import -format csv -mode upsert-sku -dry-run menu.csv
+func importCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", menu.FormatCSV, "file format: csv or json")
+	mode := flags.String("mode", menu.ModeInsert, "insert, upsert-name or upsert-sku")
+	store := flags.String("store", models.DefaultStoreID, "store ID")
+	dryRun := flags.Bool("dry-run", false, "validate without writing")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: import [flags] FILE")
+		return 2
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	rows, readErrs, err := menu.Read(*format, file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	backend, err := repository.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	result, err := menu.Import(context.Background(), backend, rows, readErrs, menu.Options{StoreID: *store, Mode: *mode, DryRun: *dryRun})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import failed:", err)
+		return 1
+	}
+	for _, rowErr := range result.Errors {
+		fmt.Fprintln(os.Stderr, rowErr)
+	}
+	if len(result.Errors) > 0 {
+		fmt.Fprintf(os.Stderr, "%d errors, nothing imported\n", len(result.Errors))
+		return 1
+	}
+
+	summary, _ := json.Marshal(result)
+	fmt.Println(string(summary))
+	return 0
+}
+
+// exportCommand writes a store's foods to a file, or to stdout without one.
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", menu.FormatCSV, "file format: csv or json")
+	store := flags.String("store", models.DefaultStoreID, "store ID")
+	flags.Parse(args)
+
+	var out io.Writer = os.Stdout
+	if flags.NArg() > 0 {
+		file, err := os.Create(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	backend, err := repository.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	foods, err := menu.Export(context.Background(), backend.Foods, *store)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export failed:", err)
+		return 1
+	}
+	if err := menu.Write(*format, out, foods); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// migrateCommand applies, reverts or lists schema migrations:
+//
+//	go_backend migrate up
+//	go_backend migrate down [STEPS]
+//	go_backend migrate status
+func migrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: migrate up | down [STEPS] | status")
+		return 2
+	}
+
+	// SQL databases create their tables when they are opened
+	if !repository.UsesMongo() {
+		fmt.Fprintln(os.Stderr, "migrations only apply to the mongo driver")
+		return 1
+	}
+
+	data.InitMongo()
+	ctx := context.Background()
+	db := data.GetMongoClient().Database("foodstoreDB")
+
+	switch args[0] {
+	case "up":
+		count, err := migrations.Up(ctx, db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate up failed:", err)
+			return 1
+		}
+		fmt.Printf("applied %d migrations\n", count)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "STEPS must be a positive number")
+				return 2
+			}
+			steps = n
+		}
+		count, err := migrations.Down(ctx, db, steps)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate down failed:", err)
+			return 1
+		}
+		fmt.Printf("reverted %d migrations\n", count)
+	case "status":
+		states, err := migrations.Status(ctx, db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate status failed:", err)
+			return 1
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = state.AppliedAt.Format(time.RFC3339)
+			}
+			reversible := "irreversible"
+			if state.Reversible {
+				reversible = "reversible"
+			}
+			fmt.Printf("%4d  %-24s  %-25s  %s\n", state.Version, state.Name, applied, reversible)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "usage: migrate up | down [STEPS] | status")
+		return 2
+	}
+	return 0
+}
+
+// superAdminCommand grants or revokes super admin, which lets an account
+// manage every store:
+//
+//	go_backend super-admin [-revoke] EMAIL
+func superAdminCommand(args []string) int {
+	flags := flag.NewFlagSet("super-admin", flag.ExitOnError)
+	revoke := flags.Bool("revoke", false, "revoke instead of grant")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: super-admin [-revoke] EMAIL")
+		return 2
+	}
+
+	backend, err := repository.FromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	ctx := context.Background()
+	user, err := backend.Users.ByEmail(ctx, flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "no user with email", flags.Arg(0))
+		return 1
+	}
+
+	user.IsSuperAdmin = !*revoke
+	if !*revoke {
+		user.IsAdmin = true
+	}
+	user.UpdatedAt = time.Now()
+	if err := backend.Users.Update(ctx, &user); err != nil {
+		fmt.Fprintln(os.Stderr, "update failed:", err)
+		return 1
+	}
+	fmt.Printf("%s super admin: %t\n", user.Email, user.IsSuperAdmin)
+	return 0
+}
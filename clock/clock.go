@@ -0,0 +1,20 @@
+// Package clock lets code that depends on the current time be run against a
+// fixed or simulated time.
+package clock
+
+import "time"
+
+// Clock tells the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the Clock backed by the machine's time.
+type System struct{}
+
+func (System) Now() time.Time { return time.Now() }
+
+// Fixed is a Clock that always reports the same instant.
+type Fixed time.Time
+
+func (f Fixed) Now() time.Time { return time.Time(f) }
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go_backend/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetAllergenProfile returns the logged-in user's allergens along with the
+// allergens and diet labels foods can declare
+func GetAllergenProfile(c *gin.Context) {
+	profile, err := allergenProfile(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"allergens":  profile,
+		"available":  models.Allergens,
+		"dietLabels": models.DietLabels,
+	})
+}
+
+// UpdateAllergenProfile replaces the logged-in user's allergens
+func UpdateAllergenProfile(c *gin.Context) {
+	var req struct {
+		Allergens []string `json:"allergens"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := models.ValidateAllergens(req.Allergens); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Allergens == nil {
+		req.Allergens = []string{}
+	}
+
+	user, err := Repos.Users.ByID(context.TODO(), c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	user.Allergens = req.Allergens
+	user.UpdatedAt = time.Now()
+	if err := Repos.Users.Update(context.TODO(), &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update allergens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Allergens updated successfully", "allergens": req.Allergens})
+}
+
+// CheckCartAllergens warns about cart items that contain allergens from the
+// logged-in user's profile
+func CheckCartAllergens(c *gin.Context) {
+	var req struct {
+		Items []models.OrderItem `json:"items"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(req.Items))
+	for _, item := range req.Items {
+		ids = append(ids, item.Food.ID)
+	}
+
+	foods, err := Repos.Foods.ByIDs(context.TODO(), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
+		return
+	}
+
+	warnings, err := allergenWarnings(c.GetString("userId"), foods)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check allergens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"warnings": warnings})
+}
+
+// allergenWarnings lists the foods that conflict with a user's allergen
+// profile. Anonymous users get no warnings.
+func allergenWarnings(userID string, foods []models.Food) ([]models.AllergenWarning, error) {
+	warnings := []models.AllergenWarning{}
+	if userID == "" {
+		return warnings, nil
+	}
+
+	profile, err := allergenProfile(userID)
+	if err != nil || len(profile) == 0 {
+		return warnings, err
+	}
+
+	seen := map[primitive.ObjectID]bool{}
+	for _, food := range foods {
+		if seen[food.ID] {
+			continue
+		}
+		seen[food.ID] = true
+		if conflicts := food.AllergenConflicts(profile); len(conflicts) > 0 {
+			warnings = append(warnings, models.AllergenWarning{FoodID: food.ID.Hex(), Name: food.Name, Allergens: conflicts})
+		}
+	}
+	return warnings, nil
+}
+
+func allergenProfile(userID string) ([]string, error) {
+	user, err := Repos.Users.ByID(context.TODO(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Allergens == nil {
+		return []string{}, nil
+	}
+	return user.Allergens, nil
+}
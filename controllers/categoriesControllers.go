@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go_backend/middleware"
+	"go_backend/models"
+	"go_backend/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetCategories lists the store's categories in display order
+func GetCategories(c *gin.Context) {
+	categories, err := storeCategories(middleware.StoreID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, categories)
+}
+
+// CreateCategory adds a category to the store's menu
+func CreateCategory(c *gin.Context) {
+	var category models.Category
+	if err := c.ShouldBindJSON(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	storeID := middleware.StoreID(c)
+	category.ID = primitive.NewObjectID().Hex()
+	category.StoreID = storeID
+	if err := validateCategory(category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = time.Now()
+
+	if err := Repos.Categories.Create(context.TODO(), &category); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category added successfully", "category": category})
+}
+
+// UpdateCategory changes a category's details, position or parent
+func UpdateCategory(c *gin.Context) {
+	var category models.Category
+	if err := c.ShouldBindJSON(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := Repos.Categories.ByID(context.TODO(), middleware.StoreID(c), c.Param("categoryId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	category.ID = existing.ID
+	category.StoreID = existing.StoreID
+	if err := validateCategory(category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	category.CreatedAt = existing.CreatedAt
+	category.UpdatedAt = time.Now()
+
+	if err := Repos.Categories.Update(context.TODO(), &category); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category updated successfully", "category": category})
+}
+
+// DeleteCategory removes an empty category and takes its foods out of it.
+// Categories with subcategories must be emptied first.
+func DeleteCategory(c *gin.Context) {
+	storeID := middleware.StoreID(c)
+	categoryID := c.Param("categoryId")
+
+	hasChildren, err := Repos.Categories.HasChildren(context.TODO(), storeID, categoryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		return
+	}
+	if hasChildren {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category has subcategories"})
+		return
+	}
+
+	err = Repos.Categories.Delete(context.TODO(), storeID, categoryID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		return
+	}
+
+	if err := Repos.Foods.RemoveCategory(context.TODO(), storeID, categoryID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove foods from category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+// SetFoodCategories replaces the categories a food is placed in
+func SetFoodCategories(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("foodId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid food ID"})
+		return
+	}
+
+	var placements []models.CategoryPlacement
+	if err := c.ShouldBindJSON(&placements); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	storeID := middleware.StoreID(c)
+	if err := validatePlacements(storeID, placements); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	food, err := Repos.Foods.ByID(context.TODO(), storeID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food not found"})
+		return
+	}
+
+	food.Categories = placements
+	err = Repos.Foods.Update(context.TODO(), &food, "categories")
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Food has been modified by someone else"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update food categories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Food categories updated successfully"})
+}
+
+// GetMenu returns the store's whole menu arranged by category
+func GetMenu(c *gin.Context) {
+	storeID := middleware.StoreID(c)
+
+	categories, err := storeCategories(storeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	foods, err := Repos.Foods.Find(context.TODO(), models.FoodQuery{StoreID: storeID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
+		return
+	}
+	markFavorites(c, foods)
+	foods = applyAvailability(c, foods)
+
+	c.JSON(http.StatusOK, models.BuildMenu(categories, foods))
+}
+
+func storeCategories(storeID string) ([]models.Category, error) {
+	return Repos.Categories.List(context.TODO(), storeID)
+}
+
+func validateCategory(category models.Category) error {
+	if category.Name == "" {
+		return fmt.Errorf("category name is required")
+	}
+
+	categories, err := storeCategories(category.StoreID)
+	if err != nil {
+		return err
+	}
+	return models.ValidateParent(category.ID, category.ParentID, categories)
+}
+
+// validatePlacements checks that every category exists in the store and is
+// used once
+func validatePlacements(storeID string, placements []models.CategoryPlacement) error {
+	if len(placements) == 0 {
+		return nil
+	}
+
+	categories, err := storeCategories(storeID)
+	if err != nil {
+		return err
+	}
+	known := map[string]bool{}
+	for _, category := range categories {
+		known[category.ID] = true
+	}
+
+	seen := map[string]bool{}
+	for _, placement := range placements {
+		if !known[placement.CategoryID] {
+			return fmt.Errorf("category %s not found", placement.CategoryID)
+		}
+		if seen[placement.CategoryID] {
+			return fmt.Errorf("category %s is listed twice", placement.CategoryID)
+		}
+		seen[placement.CategoryID] = true
+	}
+	return nil
+}
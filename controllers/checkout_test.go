@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go_backend/models"
+	"go_backend/repository"
+	"go_backend/uow"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testSlot = time.Date(2024, 3, 1, 19, 0, 0, 0, time.UTC)
+
+// useTestRepositories stores data in a throwaway SQLite database and runs
+// units of work with uow.Memory, so writes stay outside any transaction
+// and only OnRollback can undo them, as on a standalone Mongo server
+func useTestRepositories(t *testing.T) {
+	t.Helper()
+	repos, err := repository.OpenSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	previous, previousTransactions := Repos, Transactions
+	Repos, Transactions = repos, &uow.Memory{}
+	t.Cleanup(func() { Repos, Transactions = previous, previousTransactions })
+}
+
+func addTestFood(t *testing.T, name string, stock int) models.Food {
+	t.Helper()
+	food := models.Food{
+		ID:         primitive.NewObjectID(),
+		StoreID:    models.DefaultStoreID,
+		Name:       name,
+		Price:      10,
+		TrackStock: true,
+		Stock:      stock,
+		Version:    1,
+	}
+	if err := Repos.Foods.Create(context.Background(), &food); err != nil {
+		t.Fatal(err)
+	}
+	return food
+}
+
+func foodStock(t *testing.T, food models.Food) int {
+	t.Helper()
+	stored, err := Repos.Foods.ByID(context.Background(), food.StoreID, food.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored.Stock
+}
+
+func slotCount(t *testing.T, store models.Store) int {
+	t.Helper()
+	taken, err := Repos.Stores.SlotCount(context.Background(), store.ID, testSlot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return taken
+}
+
+func TestReserveSlotRollsBackWhenFull(t *testing.T) {
+	useTestRepositories(t)
+	store := models.Store{ID: models.DefaultStoreID, Schedule: models.StoreSchedule{SlotCapacity: 1}}
+
+	reserve := func(ctx context.Context) error { return reserveSlot(ctx, store, testSlot) }
+	if err := Transactions.Do(context.Background(), reserve); err != nil {
+		t.Fatalf("first reservation: %v", err)
+	}
+	if err := Transactions.Do(context.Background(), reserve); !errors.Is(err, errSlotFull) {
+		t.Fatalf("second reservation = %v, want errSlotFull", err)
+	}
+	if taken := slotCount(t, store); taken != 1 {
+		t.Errorf("slot count = %d, want the full slot's 1", taken)
+	}
+}
+
+func TestReserveStockRollsBackWhenShort(t *testing.T) {
+	useTestRepositories(t)
+	pizza := addTestFood(t, "Pizza", 3)
+	salad := addTestFood(t, "Salad", 0)
+	order := models.Order{StoreID: models.DefaultStoreID, Items: []models.OrderItem{
+		{Food: pizza, Quantity: 2},
+		{Food: salad, Quantity: 1},
+	}}
+
+	err := Transactions.Do(context.Background(), func(ctx context.Context) error {
+		return reserveStock(ctx, &order)
+	})
+	if !errors.Is(err, errInsufficientStock) {
+		t.Fatalf("reserveStock = %v, want errInsufficientStock", err)
+	}
+	if stock := foodStock(t, pizza); stock != 3 {
+		t.Errorf("pizza stock = %d, want the 3 it had before", stock)
+	}
+}
+
+func TestCheckoutRollsBackSlotAndStock(t *testing.T) {
+	useTestRepositories(t)
+	store := models.Store{ID: models.DefaultStoreID, Schedule: models.StoreSchedule{SlotCapacity: 5}}
+	pizza := addTestFood(t, "Pizza", 3)
+	order := models.Order{StoreID: models.DefaultStoreID, Items: []models.OrderItem{{Food: pizza, Quantity: 2}}}
+
+	// A failure after the slot and the stock are reserved puts both back
+	failed := errors.New("failed")
+	err := Transactions.Do(context.Background(), func(ctx context.Context) error {
+		if err := reserveSlot(ctx, store, testSlot); err != nil {
+			return err
+		}
+		if err := reserveStock(ctx, &order); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Do = %v, want %v", err, failed)
+	}
+	if taken := slotCount(t, store); taken != 0 {
+		t.Errorf("slot count = %d, want 0", taken)
+	}
+	if stock := foodStock(t, pizza); stock != 3 {
+		t.Errorf("pizza stock = %d, want 3", stock)
+	}
+	adjustments, err := Repos.Inventory.Adjustments(context.Background(), models.DefaultStoreID, pizza.ID.Hex(), 10)
+	if err != nil || len(adjustments) != 0 {
+		t.Errorf("Adjustments = %+v, %v, want the reservation's removed", adjustments, err)
+	}
+}
+
+func TestCreateOrderOnAFreshDatabase(t *testing.T) {
+	useTestRepositories(t)
+	pizza := addTestFood(t, "Pizza", 3)
+
+	// Nothing but the tables exists yet; the order goes to the default store
+	body := `{"address":"1 Main St","items":[{"food":{"id":"` + pizza.ID.Hex() + `"},"quantity":2}]}`
+	recorder := serveJSON(CreateOrder, "ada", body)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("CreateOrder = %d %s", recorder.Code, recorder.Body)
+	}
+
+	orders, err := Repos.Orders.List(context.Background(), models.DefaultStoreID, "")
+	if err != nil || len(orders) != 1 || orders[0].TotalPrice != 20 {
+		t.Errorf("orders = %+v, %v, want one order of 20", orders, err)
+	}
+	if stock := foodStock(t, pizza); stock != 1 {
+		t.Errorf("pizza stock = %d, want 1", stock)
+	}
+}
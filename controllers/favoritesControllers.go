@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go_backend/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetFavorites lists the foods the logged-in user has favorited
+func GetFavorites(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	foodIDs, err := favoriteFoodIDs(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch favorites"})
+		return
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(foodIDs))
+	for id := range foodIDs {
+		if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+			ids = append(ids, oid)
+		}
+	}
+
+	foods, err := Repos.Foods.ByIDs(context.TODO(), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch favorites"})
+		return
+	}
+	for i := range foods {
+		foods[i].IsFavorite = true
+	}
+
+	c.JSON(http.StatusOK, foods)
+}
+
+// AddFavorite marks a food as a favorite of the logged-in user
+func AddFavorite(c *gin.Context) {
+	userID := c.GetString("userId")
+	id, err := primitive.ObjectIDFromHex(c.Param("foodId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid food ID"})
+		return
+	}
+
+	foods, err := Repos.Foods.ByIDs(context.TODO(), []primitive.ObjectID{id})
+	if err != nil || len(foods) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food not found"})
+		return
+	}
+
+	err = Repos.Favorites.Add(context.TODO(), &models.UserFavorite{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    userID,
+		FoodID:    id.Hex(),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add favorite"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Favorite added successfully"})
+}
+
+// RemoveFavorite removes a food from the logged-in user's favorites
+func RemoveFavorite(c *gin.Context) {
+	userID := c.GetString("userId")
+	foodID := c.Param("foodId")
+
+	if err := Repos.Favorites.Remove(context.TODO(), userID, foodID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove favorite"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Favorite removed successfully"})
+}
+
+// favoriteFoodIDs returns the set of food IDs the user has favorited
+func favoriteFoodIDs(userID string) (map[string]bool, error) {
+	foodIDs, err := Repos.Favorites.FoodIDs(context.TODO(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool, len(foodIDs))
+	for _, id := range foodIDs {
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// markFavorites sets IsFavorite on foods for the logged-in user, if any
+func markFavorites(c *gin.Context, foods []models.Food) {
+	userID := c.GetString("userId")
+	if userID == "" {
+		return
+	}
+
+	ids, err := favoriteFoodIDs(userID)
+	if err != nil {
+		return
+	}
+	for i := range foods {
+		foods[i].IsFavorite = ids[foods[i].ID.Hex()]
+	}
+}
@@ -2,11 +2,23 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
-	"go_backend/data"
+	"go_backend/mergepatch"
+	"go_backend/middleware"
 	"go_backend/models"
+	"go_backend/pricing"
+	"go_backend/repository"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,21 +27,19 @@ import (
 
 // GetAllFoods retrieves all foods
 func GetAllFoods(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("foods")
-
-	cursor, err := collection.Find(context.TODO(), bson.M{})
+	query, err := parseFoodQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursor.Close(context.TODO())
 
-	var foods []models.Food
-	if err := cursor.All(context.TODO(), &foods); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse foods"})
+	foods, err := Repos.Foods.Find(context.TODO(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
 		return
 	}
+	markFavorites(c, foods)
+	foods = applyAvailability(c, foods)
 
 	c.JSON(http.StatusOK, foods)
 }
@@ -37,59 +47,113 @@ func GetAllFoods(c *gin.Context) {
 // SearchFoods searches for foods by a term
 func SearchFoods(c *gin.Context) {
 	searchTerm := c.Param("searchTerm")
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("foods")
 
-	filter := bson.M{"name": bson.M{"$regex": searchTerm, "$options": "i"}}
-	cursor, err := collection.Find(context.TODO(), filter)
+	query, err := parseFoodQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursor.Close(context.TODO())
+	query.Search = searchTerm
 
-	var foods []models.Food
-	if err := cursor.All(context.TODO(), &foods); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse foods"})
+	foods, err := Repos.Foods.Find(context.TODO(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
 		return
 	}
+	markFavorites(c, foods)
+	foods = applyAvailability(c, foods)
 
 	c.JSON(http.StatusOK, foods)
 }
 
 // GetAllTags retrieves all unique tags
 func GetAllTags(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("foods")
-
-	cursor, err := collection.Distinct(context.TODO(), "tags", bson.M{})
+	tags, err := Repos.Foods.Tags(context.TODO(), middleware.StoreID(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
 		return
 	}
 
-	c.JSON(http.StatusOK, cursor)
+	c.JSON(http.StatusOK, tags)
+}
+
+// GetFoodFacets returns tag, origin, price and star counts for the foods
+// matching the current search and filter query
+func GetFoodFacets(c *gin.Context) {
+	query, err := parseFoodQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	facets, err := Repos.Foods.Facets(context.TODO(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch facets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, facets)
+}
+
+// parseFoodQuery reads the search and filter query parameters
+func parseFoodQuery(c *gin.Context) (models.FoodQuery, error) {
+	query := models.FoodQuery{
+		StoreID: middleware.StoreID(c),
+		Search:  c.Query("search"),
+		Text:    c.Query("q"),
+		Tag:     c.Query("tag"),
+		Origin:  c.Query("origin"),
+	}
+
+	for param, dest := range map[string]**float64{"minPrice": &query.MinPrice, "maxPrice": &query.MaxPrice} {
+		if raw := c.Query(param); raw != "" {
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s", param)
+			}
+			*dest = &value
+		}
+	}
+
+	if raw := c.Query("stars"); raw != "" {
+		stars, err := strconv.Atoi(raw)
+		if err != nil {
+			return query, fmt.Errorf("invalid stars")
+		}
+		query.MinStars = &stars
+	}
+
+	query.ExcludeAllergens = splitParam(c.Query("excludeAllergens"))
+	if err := models.ValidateAllergens(query.ExcludeAllergens); err != nil {
+		return query, err
+	}
+	query.DietLabels = splitParam(c.Query("diet"))
+
+	return query, nil
+}
+
+// splitParam splits a comma-separated query parameter
+func splitParam(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
 }
 
 // GetFoodsByTag retrieves foods by a specific tag
 func GetFoodsByTag(c *gin.Context) {
 	tag := c.Param("tag")
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("foods")
 
-	filter := bson.M{"tags": tag}
-	cursor, err := collection.Find(context.TODO(), filter)
+	foods, err := Repos.Foods.Find(context.TODO(), models.FoodQuery{StoreID: middleware.StoreID(c), Tag: tag})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods by tag"})
 		return
 	}
-	defer cursor.Close(context.TODO())
-
-	var foods []models.Food
-	if err := cursor.All(context.TODO(), &foods); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse foods"})
-		return
-	}
+	markFavorites(c, foods)
+	foods = applyAvailability(c, foods)
 
 	c.JSON(http.StatusOK, foods)
 }
@@ -97,8 +161,6 @@ func GetFoodsByTag(c *gin.Context) {
 // GetFoodByID retrieves a food by its ID
 func GetFoodByID(c *gin.Context) {
 	foodID := c.Param("foodId")
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("foods")
 
 	id, err := primitive.ObjectIDFromHex(foodID)
 	if err != nil {
@@ -106,66 +168,204 @@ func GetFoodByID(c *gin.Context) {
 		return
 	}
 
-	var food models.Food
-	err = collection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&food)
+	food, err := Repos.Foods.ByID(context.TODO(), middleware.StoreID(c), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Food not found"})
 		return
 	}
+	foods := []models.Food{food}
+	markFavorites(c, foods)
+	foods = applyAvailability(c, foods)
+	if len(foods) == 0 {
+		foods = []models.Food{food}
+	}
 
-	c.JSON(http.StatusOK, food)
+	c.Header("ETag", food.ETag())
+	c.JSON(http.StatusOK, foods[0])
 }
 
-// DeleteFood deletes a food by its ID
-func DeleteFood(c *gin.Context) {
-	foodID := c.Param("foodId")
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("foods")
+// UpdateFood replaces an existing food. The ID is taken from the body,
+// along with the version being replaced unless its ETag is sent in
+// If-Match.
+func UpdateFood(c *gin.Context) {
+	var food models.Food
+	if err := c.ShouldBindJSON(&food); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if food.Version == 0 && c.GetHeader("If-Match") == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "Send the food's version or its ETag in If-Match"})
+		return
+	}
 
-	id, err := primitive.ObjectIDFromHex(foodID)
+	existing, ok := foodForEdit(c, food.ID)
+	if !ok {
+		return
+	}
+	if food.Version != 0 && food.Version != existing.Version {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Food has been modified by someone else"})
+		return
+	}
+
+	if saved, ok := saveFoodEdit(c, existing, food); ok {
+		c.Header("ETag", saved.ETag())
+		c.JSON(http.StatusOK, gin.H{"message": "Food updated successfully", "food": saved})
+	}
+}
+
+// PatchFood applies a JSON Merge Patch to a food. Send the food's ETag in
+// If-Match to make sure nobody else changed it in the meantime.
+func PatchFood(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("foodId"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid food ID"})
 		return
 	}
 
-	_, err = collection.DeleteOne(context.TODO(), bson.M{"_id": id})
+	patch, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete food"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read patch"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Food deleted successfully"})
-}
+	existing, ok := foodForEdit(c, id)
+	if !ok {
+		return
+	}
 
-// UpdateFood updates an existing food
-func UpdateFood(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("foods")
+	doc, err := json.Marshal(existing)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to patch food"})
+		return
+	}
+	patched, err := mergepatch.Apply(doc, patch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	var food models.Food
-	if err := c.ShouldBindJSON(&food); err != nil {
+	if err := json.Unmarshal(patched, &food); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	filter := bson.M{"_id": food.ID}
-	food.UpdatedAt = time.Now()
-	update := bson.M{"$set": food}
+	if saved, ok := saveFoodEdit(c, existing, food); ok {
+		c.Header("ETag", saved.ETag())
+		c.JSON(http.StatusOK, saved)
+	}
+}
 
-	_, err := collection.UpdateOne(context.TODO(), filter, update)
+// foodForEdit loads a food of the current store and checks the request's
+// If-Match header against its ETag
+func foodForEdit(c *gin.Context, id primitive.ObjectID) (models.Food, bool) {
+	existing, err := Repos.Foods.ByID(context.TODO(), middleware.StoreID(c), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food not found"})
+		return existing, false
+	}
+
+	if match := c.GetHeader("If-Match"); match != "" && match != "*" && match != existing.ETag() {
+		c.Header("ETag", existing.ETag())
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Food has been modified by someone else"})
+		return existing, false
+	}
+	return existing, true
+}
+
+// saveFoodEdit validates an edited food and writes the fields that differ
+// from existing, provided nobody saved a newer version in between. Fields
+// the server maintains are kept from existing.
+func saveFoodEdit(c *gin.Context, existing, food models.Food) (models.Food, bool) {
+	// Ratings come from reviews, stock from inventory adjustments and
+	// images from uploads
+	food.ID = existing.ID
+	food.CreatedAt = existing.CreatedAt
+	food.UpdatedAt = existing.UpdatedAt
+	food.DeletedAt = existing.DeletedAt
+	food.StoreID = existing.StoreID
+	food.Stars = existing.Stars
+	food.RatingCount = existing.RatingCount
+	food.RatingSum = existing.RatingSum
+	food.Stock = existing.Stock
+	food.SoldOut = existing.SoldOut
+	food.Images = existing.Images
+	food.Version = existing.Version
+
+	// A manual price change ends any running promotion
+	food.Promotion = existing.Promotion
+	if food.Price != existing.Price {
+		food.Promotion = nil
+	}
+
+	if err := food.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return food, false
+	}
+	if err := validatePlacements(existing.StoreID, food.Categories); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return food, false
+	}
+
+	set, err := changedFields(existing, food)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update food"})
-		return
+		return food, false
+	}
+	if len(set) == 0 {
+		return existing, true
+	}
+
+	fields := make([]string, 0, len(set))
+	for field := range set {
+		fields = append(fields, field)
 	}
+	sort.Strings(fields)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Food updated successfully"})
+	err = Repos.Foods.Update(context.TODO(), &food, fields...)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Food has been modified by someone else"})
+		return food, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update food"})
+		return food, false
+	}
+
+	if err := pricing.Record(context.TODO(), Repos.Prices, existing, food.Price, c.GetString("userId"), "updated"); err != nil {
+		log.Println("Failed to record price change:", err)
+	}
+	return food, true
+}
+
+// changedFields returns the top-level document fields of food that differ
+// from existing
+func changedFields(existing, food models.Food) (bson.M, error) {
+	var before, after bson.M
+	for _, pair := range []struct {
+		food models.Food
+		doc  *bson.M
+	}{{existing, &before}, {food, &after}} {
+		raw, err := bson.Marshal(pair.food)
+		if err != nil {
+			return nil, err
+		}
+		if err := bson.Unmarshal(raw, pair.doc); err != nil {
+			return nil, err
+		}
+	}
+
+	set := bson.M{}
+	for key, value := range after {
+		if !reflect.DeepEqual(before[key], value) {
+			set[key] = value
+		}
+	}
+	return set, nil
 }
 
 // AddFood adds a new food item
 func AddFood(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("foods")
-
 	var food models.Food
 
 	if err := c.ShouldBindJSON(&food); err != nil {
@@ -173,12 +373,26 @@ func AddFood(c *gin.Context) {
 		return
 	}
 
+	if err := food.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePlacements(middleware.StoreID(c), food.Categories); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	food.ID = primitive.NewObjectID()
+	food.StoreID = middleware.StoreID(c)
+	food.Version = 1
+	food.Promotion = nil
+	food.Stars = 0
+	food.RatingCount = 0
+	food.RatingSum = 0
 	food.CreatedAt = time.Now()
 	food.UpdatedAt = time.Now()
 
-	_, err := collection.InsertOne(context.TODO(), food)
-	if err != nil {
+	if err := Repos.Foods.Create(context.TODO(), &food); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add food"})
 		return
 	}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go_backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// putFood runs UpdateFood with food as the body and ifMatch, when not
+// empty, as the If-Match header
+func putFood(t *testing.T, food models.Food, ifMatch string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(food)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		c.Request.Header.Set("If-Match", ifMatch)
+	}
+	UpdateFood(c)
+	return recorder
+}
+
+func TestUpdateFoodChecksTheVersion(t *testing.T) {
+	useTestRepositories(t)
+	pizza := addTestFood(t, "Pizza", 3)
+	edit := pizza
+	edit.Price = 12
+
+	tests := []struct {
+		name    string
+		version int
+		ifMatch string
+		want    int
+	}{
+		{"neither version nor If-Match", 0, "", http.StatusPreconditionRequired},
+		{"stale version", 2, "", http.StatusPreconditionFailed},
+		{"stale If-Match", 0, `"2"`, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		edit.Version = tt.version
+		if recorder := putFood(t, edit, tt.ifMatch); recorder.Code != tt.want {
+			t.Errorf("%s: PUT = %d %s, want %d", tt.name, recorder.Code, recorder.Body, tt.want)
+		}
+	}
+	if stored, _ := Repos.Foods.ByID(context.Background(), pizza.StoreID, pizza.ID); stored.Price != pizza.Price || stored.Version != 1 {
+		t.Fatalf("after refused updates food = %+v, want it unchanged", stored)
+	}
+
+	edit.Version = 1
+	recorder := putFood(t, edit, "")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("ETag") != `"2"` {
+		t.Fatalf("PUT with the current version = %d %s, ETag %s", recorder.Code, recorder.Body, recorder.Header().Get("ETag"))
+	}
+	edit.Version = 0
+	edit.Price = 14
+	if recorder := putFood(t, edit, `"2"`); recorder.Code != http.StatusOK {
+		t.Errorf("PUT with the current ETag = %d %s", recorder.Code, recorder.Body)
+	}
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"go_backend/images"
+	"go_backend/middleware"
+	"go_backend/models"
+	"go_backend/repository"
+	"go_backend/storage"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Storage is where uploaded images are saved. It is set up in main.
+var Storage storage.Storage
+
+// UploadFoodImage accepts a multipart "image" upload, stores its resized
+// variants and links them to the food. The upload becomes the food's
+// primary image if it has none yet or primary=true is sent.
+func UploadFoodImage(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("foodId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid food ID"})
+		return
+	}
+
+	food, err := Repos.Foods.ByID(context.TODO(), middleware.StoreID(c), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food not found"})
+		return
+	}
+
+	// Leave room for the multipart envelope around the file itself.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, images.MaxUploadBytes+64<<10)
+	file, header, err := c.Request.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An image file is required"})
+		return
+	}
+	defer file.Close()
+	if header.Size > images.MaxUploadBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image must be at most 10MB"})
+		return
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(file, images.MaxUploadBytes+1))
+	if err != nil || len(raw) > images.MaxUploadBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image must be at most 10MB"})
+		return
+	}
+
+	variants, err := images.Process(raw)
+	if errors.Is(err, images.ErrUnsupportedType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	image := models.FoodImage{
+		ID:         primitive.NewObjectID().Hex(),
+		UploadedBy: c.GetString("userId"),
+		CreatedAt:  time.Now(),
+	}
+	for _, v := range variants {
+		key := fmt.Sprintf("foods/%s/%s/%s.%s", id.Hex(), image.ID, v.Size, v.Format)
+		url, err := Storage.Put(c.Request.Context(), key, bytes.NewReader(v.Data), v.ContentType)
+		if err != nil {
+			log.Println("Failed to store image:", err)
+			deleteImageVariants(image.Variants)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image"})
+			return
+		}
+		image.Variants = append(image.Variants, models.ImageVariant{
+			Size: v.Size, Format: v.Format, URL: url, Key: key, Width: v.Width, Height: v.Height,
+		})
+	}
+
+	food.Images = append(food.Images, image)
+	if food.ImageUrl == "" || c.PostForm("primary") == "true" {
+		food.ImageUrl = image.URLFor("medium", image.Variants[0].Format)
+	}
+
+	if err := Repos.Foods.Update(context.TODO(), &food, "images", "imageUrl"); err != nil {
+		deleteImageVariants(image.Variants)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Food was modified during the upload, please try again"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link image to food"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Image uploaded successfully", "image": image})
+}
+
+// DeleteFoodImage unlinks an image from a food and removes its files
+func DeleteFoodImage(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("foodId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid food ID"})
+		return
+	}
+	imageID := c.Param("imageId")
+
+	food, err := Repos.Foods.ByID(context.TODO(), middleware.StoreID(c), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+
+	var removed models.FoodImage
+	kept := []models.FoodImage{}
+	for _, img := range food.Images {
+		if img.ID == imageID {
+			removed = img
+		} else {
+			kept = append(kept, img)
+		}
+	}
+	if removed.ID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+
+	food.Images = kept
+	for _, v := range removed.Variants {
+		if v.URL == food.ImageUrl {
+			food.ImageUrl = ""
+		}
+	}
+
+	if err := Repos.Foods.Update(context.TODO(), &food, "images", "imageUrl"); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Food was modified in the meantime, please try again"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete image"})
+		return
+	}
+	deleteImageVariants(removed.Variants)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Image deleted successfully"})
+}
+
+func deleteImageVariants(variants []models.ImageVariant) {
+	for _, v := range variants {
+		if err := Storage.Delete(context.TODO(), v.Key); err != nil {
+			log.Println("Failed to delete stored image:", err)
+		}
+	}
+}
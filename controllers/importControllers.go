@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"go_backend/menu"
+	"go_backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportFoods imports foods from a CSV or JSON request body. Either every
+// row is applied or, when any row has an error, none is.
+func ImportFoods(c *gin.Context) {
+	format := c.DefaultQuery("format", menu.FormatCSV)
+	opts := menu.Options{
+		StoreID: middleware.StoreID(c),
+		Mode:    c.DefaultQuery("mode", menu.ModeInsert),
+		DryRun:  c.Query("dryRun") == "true",
+		UserID:  c.GetString("userId"),
+	}
+
+	rows, readErrs, err := menu.Read(format, c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := menu.Import(context.TODO(), Repos, rows, readErrs, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import foods"})
+		return
+	}
+	if len(result.Errors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Import has invalid rows", "result": result})
+		return
+	}
+
+	message := "Foods imported successfully"
+	if opts.DryRun {
+		message = "Dry run completed successfully"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "result": result})
+}
+
+// ExportFoods downloads the store's foods as CSV or JSON
+func ExportFoods(c *gin.Context) {
+	format := c.DefaultQuery("format", menu.FormatCSV)
+	if format != menu.FormatCSV && format != menu.FormatJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv or json"})
+		return
+	}
+
+	foods, err := menu.Export(context.TODO(), Repos.Foods, middleware.StoreID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
+		return
+	}
+
+	contentType := "text/csv"
+	if format == menu.FormatJSON {
+		contentType = "application/json"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", "attachment; filename=foods."+format)
+	c.Status(http.StatusOK)
+	if err := menu.Write(format, c.Writer, foods); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,333 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"go_backend/middleware"
+	"go_backend/models"
+	"go_backend/repository"
+	"go_backend/uow"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errInsufficientStock = repository.ErrInsufficientStock
+
+type StockAdjustmentRequest struct {
+	TargetType string  `json:"targetType"`
+	TargetID   string  `json:"targetId"`
+	Delta      float64 `json:"delta"`
+	Reason     string  `json:"reason"`
+}
+
+// stockChange is a pending change to one food's or ingredient's stock
+type stockChange struct {
+	storeID    string
+	targetType string
+	targetID   string
+	delta      float64
+}
+
+// GetIngredients lists all ingredients with their stock levels
+func GetIngredients(c *gin.Context) {
+	ingredients, err := Repos.Inventory.Ingredients(context.TODO(), middleware.StoreID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredients"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ingredients)
+}
+
+// AddIngredient creates a new ingredient. Its initial stock is recorded as
+// an adjustment.
+func AddIngredient(c *gin.Context) {
+	var ingredient models.Ingredient
+	if err := c.ShouldBindJSON(&ingredient); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if ingredient.Name == "" || ingredient.Stock < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ingredient needs a name and a non-negative stock"})
+		return
+	}
+
+	ingredient.ID = primitive.NewObjectID().Hex()
+	ingredient.StoreID = middleware.StoreID(c)
+	ingredient.CreatedAt = time.Now()
+	ingredient.UpdatedAt = time.Now()
+
+	if err := Repos.Inventory.CreateIngredient(context.TODO(), &ingredient); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add ingredient"})
+		return
+	}
+	recordAdjustment(context.TODO(), stockChange{ingredient.StoreID, models.StockTargetIngredient, ingredient.ID, ingredient.Stock}, ingredient.Stock, "Initial stock", c.GetString("userId"), "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ingredient added successfully", "ingredient": ingredient})
+}
+
+// AdjustStock changes a food's or an ingredient's stock by a delta and
+// records who made the change and why
+func AdjustStock(c *gin.Context) {
+	var req StockAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.TargetType != models.StockTargetFood && req.TargetType != models.StockTargetIngredient {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "targetType must be food or ingredient"})
+		return
+	}
+	if req.Delta == 0 || req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A non-zero delta and a reason are required"})
+		return
+	}
+	if req.TargetType == models.StockTargetFood && req.Delta != float64(int(req.Delta)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Food stock is counted in whole portions"})
+		return
+	}
+
+	change := stockChange{middleware.StoreID(c), req.TargetType, req.TargetID, req.Delta}
+	after, err := applyStockChange(context.TODO(), change)
+	switch {
+	case errors.Is(err, errInsufficientStock):
+		c.JSON(http.StatusConflict, gin.H{"error": "Stock can't go below zero"})
+		return
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock item not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock"})
+		return
+	}
+
+	recordAdjustment(context.TODO(), change, after, req.Reason, c.GetString("userId"), "")
+	refreshSoldOut(context.TODO(), []stockChange{change})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Stock adjusted successfully", "stock": after})
+}
+
+// GetStockAdjustments returns the audit trail, optionally for one target
+func GetStockAdjustments(c *gin.Context) {
+	adjustments, err := Repos.Inventory.Adjustments(context.TODO(), middleware.StoreID(c), c.Query("targetId"), 500)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch adjustments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, adjustments)
+}
+
+// GetLowStock lists tracked foods and ingredients at or below their
+// low-stock threshold
+func GetLowStock(c *gin.Context) {
+	storeID := middleware.StoreID(c)
+	foods, err := Repos.Foods.LowStock(context.TODO(), storeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch foods"})
+		return
+	}
+
+	ingredients, err := Repos.Inventory.LowStockIngredients(context.TODO(), storeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ingredients"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"foods": foods, "ingredients": ingredients})
+}
+
+// reserveStock takes the stock needed by an order within the unit of work
+// running ctx. Each food and ingredient is decremented only if enough is
+// left; if any of them runs short, errInsufficientStock is returned and the
+// unit of work puts back the changes already made.
+func reserveStock(ctx context.Context, order *models.Order) error {
+	changes := orderStockChanges(order, -1)
+	for _, change := range changes {
+		after, err := applyStockChange(ctx, change)
+		if err != nil {
+			if errors.Is(err, errInsufficientStock) {
+				return fmt.Errorf("%w for %s", errInsufficientStock, stockName(order, change))
+			}
+			return err
+		}
+		uow.OnRollback(ctx, func() {
+			undo := change
+			undo.delta = -undo.delta
+			if _, err := applyStockChange(context.TODO(), undo); err != nil {
+				log.Printf("Failed to roll back stock for %s %s: %v", undo.targetType, undo.targetID, err)
+			}
+			refreshSoldOut(context.TODO(), []stockChange{undo})
+		})
+		recordAdjustment(ctx, change, after, "Reserved for order", order.UserID, order.ID)
+	}
+
+	refreshSoldOut(ctx, changes)
+	order.StockReserved = len(changes) > 0
+	return nil
+}
+
+// releaseStock returns an order's reserved stock within the unit of work
+// running ctx. The order's reservation flag is cleared first so stock is
+// released at most once.
+func releaseStock(ctx context.Context, orderID string, reason string) error {
+	order, err := Repos.Orders.UnreserveStock(ctx, orderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	changes := orderStockChanges(&order, 1)
+	for _, change := range changes {
+		after, err := applyStockChange(ctx, change)
+		if err != nil {
+			return err
+		}
+		recordAdjustment(ctx, change, after, reason, order.UserID, order.ID)
+	}
+	refreshSoldOut(ctx, changes)
+	return nil
+}
+
+// orderStockChanges totals the food and ingredient stock used by an order,
+// multiplied by sign
+func orderStockChanges(order *models.Order, sign float64) []stockChange {
+	changes := []stockChange{}
+	index := map[string]int{}
+	add := func(targetType, targetID string, amount float64) {
+		key := targetType + "/" + targetID
+		if i, ok := index[key]; ok {
+			changes[i].delta += sign * amount
+			return
+		}
+		index[key] = len(changes)
+		changes = append(changes, stockChange{order.StoreID, targetType, targetID, sign * amount})
+	}
+
+	for _, item := range order.Items {
+		if item.Food.TrackStock {
+			add(models.StockTargetFood, item.Food.ID.Hex(), float64(item.Quantity))
+		}
+		for _, ingredient := range item.Food.Ingredients {
+			add(models.StockTargetIngredient, ingredient.IngredientID, ingredient.Quantity*float64(item.Quantity))
+		}
+	}
+	return changes
+}
+
+// applyStockChange applies a delta to one stock level, refusing to go below
+// zero, and returns the new level
+func applyStockChange(ctx context.Context, change stockChange) (float64, error) {
+	var name string
+	var stock, threshold float64
+	if change.targetType == models.StockTargetFood {
+		id, err := primitive.ObjectIDFromHex(change.targetID)
+		if err != nil {
+			return 0, repository.ErrNotFound
+		}
+		food, err := Repos.Foods.AdjustStock(ctx, change.storeID, id, int(change.delta))
+		if err != nil {
+			return 0, err
+		}
+		name, stock, threshold = food.Name, float64(food.Stock), float64(food.LowStockThreshold)
+	} else {
+		ingredient, err := Repos.Inventory.AdjustIngredient(ctx, change.storeID, change.targetID, change.delta)
+		if err != nil {
+			return 0, err
+		}
+		name, stock, threshold = ingredient.Name, ingredient.Stock, ingredient.LowStockThreshold
+	}
+
+	before := stock - change.delta
+	if stock <= threshold && before > threshold {
+		log.Printf("Low stock alert: %s %q is down to %v", change.targetType, name, stock)
+	}
+	return stock, nil
+}
+
+// refreshSoldOut recomputes the SoldOut flag of every food affected by the
+// given changes
+func refreshSoldOut(ctx context.Context, changes []stockChange) {
+	foodIDs := []primitive.ObjectID{}
+	ingredientIDs := []string{}
+	for _, change := range changes {
+		if change.targetType == models.StockTargetFood {
+			if id, err := primitive.ObjectIDFromHex(change.targetID); err == nil {
+				foodIDs = append(foodIDs, id)
+			}
+		} else {
+			ingredientIDs = append(ingredientIDs, change.targetID)
+		}
+	}
+
+	foods, err := Repos.Foods.Stocked(ctx, foodIDs, ingredientIDs)
+	if err != nil {
+		log.Println("Failed to refresh sold out foods:", err)
+		return
+	}
+
+	used := []string{}
+	for _, food := range foods {
+		for _, fi := range food.Ingredients {
+			used = append(used, fi.IngredientID)
+		}
+	}
+	ingredients, err := Repos.Inventory.IngredientsByID(ctx, used)
+	if err != nil {
+		log.Println("Failed to refresh sold out foods:", err)
+		return
+	}
+	stock := map[string]float64{}
+	for _, ingredient := range ingredients {
+		stock[ingredient.ID] = ingredient.Stock
+	}
+
+	for _, food := range foods {
+		soldOut := food.TrackStock && food.Stock <= 0
+		for _, fi := range food.Ingredients {
+			if left, ok := stock[fi.IngredientID]; !ok || left < fi.Quantity {
+				soldOut = true
+			}
+		}
+		if soldOut != food.SoldOut {
+			if err := Repos.Foods.SetSoldOut(ctx, food.ID, soldOut); err != nil {
+				log.Println("Failed to update sold out flag:", err)
+			}
+		}
+	}
+}
+
+func recordAdjustment(ctx context.Context, change stockChange, after float64, reason, adjustedBy, orderID string) {
+	err := Repos.Inventory.AddAdjustment(ctx, &models.StockAdjustment{
+		ID:         primitive.NewObjectID().Hex(),
+		StoreID:    change.storeID,
+		TargetType: change.targetType,
+		TargetID:   change.targetID,
+		Delta:      change.delta,
+		StockAfter: after,
+		Reason:     reason,
+		AdjustedBy: adjustedBy,
+		OrderID:    orderID,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		log.Println("Failed to record stock adjustment:", err)
+	}
+}
+
+func stockName(order *models.Order, change stockChange) string {
+	for _, item := range order.Items {
+		if change.targetType == models.StockTargetFood && item.Food.ID.Hex() == change.targetID {
+			return item.Food.Name
+		}
+	}
+	return change.targetType + " " + change.targetID
+}
@@ -2,24 +2,29 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
-	"go_backend/data"
+	"go_backend/events"
+	"go_backend/middleware"
 	"go_backend/models"
+	"go_backend/repository"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var errNotYourOrder = errors.New("you can only update your own orders")
+
 type CreateOrderRequest struct {
 	Name          string             `json:"name"`
 	Address       string             `json:"address"`
 	AddressLatLng models.LatLng      `json:"addressLatLng"`
 	TotalPrice    float64            `json:"totalPrice"`
 	Items         []models.OrderItem `json:"items"`
-	UserID        string             `json:"userId"`
 }
 
 type PaymentRequest struct {
@@ -31,38 +36,173 @@ type TrackOrderResponse struct {
 	Status string       `json:"status"`
 }
 
-func CreateOrder(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("orders")
+// publish adds an event to the outbox. Called within a unit of work, the
+// event is only kept if the unit of work commits.
+func publish(ctx context.Context, eventType, aggregateID, storeID string, data interface{}) error {
+	event, err := events.New(eventType, aggregateID, storeID, data)
+	if err != nil {
+		return err
+	}
+	return Repos.Outbox.Add(ctx, event)
+}
 
+func CreateOrder(c *gin.Context) {
 	var req models.Order
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	store, ok := storeOrAbort(c)
+	if !ok {
+		return
+	}
+	schedule := store.Schedule
+	req.StoreID = store.ID
+	req.UserID = c.GetString("userId")
+
+	zone, ok := store.ZoneFor(req.AddressLatLng)
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The address is outside our delivery area"})
+		return
+	}
+
+	now := Clock.Now()
+	fulfillAt := now
+	if req.ScheduledFor != nil {
+		if err := validateSlot(schedule, *req.ScheduledFor, now); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		fulfillAt = *req.ScheduledFor
+	} else if !schedule.IsOpen(now) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The store is closed"})
+		return
+	}
+
+	if err := priceOrder(&req, fulfillAt, schedule.Location()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.DeliveryFee = 0
+	if zone != nil {
+		req.DeliveryFee = zone.DeliveryFee
+	}
+	req.TotalPrice += req.DeliveryFee
+
 	req.ID = primitive.NewObjectID().Hex()
 	req.CreatedAt = time.Now()
 	req.UpdatedAt = time.Now()
 	req.Status = "Pending"
+	req.ReleasedAt = nil
+	if req.ScheduledFor == nil {
+		req.ReleasedAt = &now
+	}
 
-	_, err := collection.InsertOne(context.TODO(), req)
+	// The slot, the stock and the order are written together or not at all
+	err := Transactions.Do(context.TODO(), func(ctx context.Context) error {
+		if req.ScheduledFor != nil {
+			if err := reserveSlot(ctx, store, *req.ScheduledFor); err != nil {
+				return err
+			}
+		}
+		if err := reserveStock(ctx, &req); err != nil {
+			return err
+		}
+		if err := Repos.Orders.Create(ctx, &req); err != nil {
+			return err
+		}
+		return publish(ctx, events.OrderCreated, req.ID, req.StoreID, req)
+	})
+	if errors.Is(err, errSlotFull) || errors.Is(err, errInsufficientStock) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Order created successfully", "order": req})
+	foods := make([]models.Food, len(req.Items))
+	for i, item := range req.Items {
+		foods[i] = item.Food
+	}
+	warnings, err := allergenWarnings(req.UserID, foods)
+	if err != nil {
+		log.Println("Failed to check allergens:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order created successfully", "order": req, "allergenWarnings": warnings})
 }
 
-func GetNewOrderForCurrentUser(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("orders")
+// priceOrder replaces the client-supplied foods and prices with the menu's,
+// validating each item's availability and variant and modifier choices
+func priceOrder(order *models.Order, at time.Time, loc *time.Location) error {
+	if len(order.Items) == 0 {
+		return fmt.Errorf("order has no items")
+	}
+
+	ids := make([]primitive.ObjectID, len(order.Items))
+	for i, item := range order.Items {
+		ids[i] = item.Food.ID
+	}
+	menu, err := Repos.Foods.ByIDs(context.TODO(), ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[primitive.ObjectID]models.Food, len(menu))
+	for _, food := range menu {
+		byID[food.ID] = food
+	}
+
+	order.TotalPrice = 0
+	for i := range order.Items {
+		item := &order.Items[i]
+		if item.Quantity < 1 {
+			return fmt.Errorf("quantity must be at least 1")
+		}
+
+		food, ok := byID[item.Food.ID]
+		if !ok {
+			return fmt.Errorf("food %s not found", item.Food.ID.Hex())
+		}
+		if food.StoreID != order.StoreID {
+			return fmt.Errorf("%s is not on this store's menu", food.Name)
+		}
+
+		if food.SoldOut {
+			return fmt.Errorf("%s is sold out", food.Name)
+		}
+		if !food.AvailableAt(at, loc) {
+			return fmt.Errorf("%s is not available right now", food.Name)
+		}
+
+		// Orders keep the price in effect when they are placed
+		food.Price, item.PromotionID = food.CurrentPrice(Clock.Now())
+		item.BasePrice = food.Price
+
+		unitPrice, variant, modifiers, err := food.PriceFor(item.VariantID, item.Modifiers)
+		if err != nil {
+			return err
+		}
+
+		item.Food = food
+		item.VariantName = ""
+		if variant != nil {
+			item.VariantName = variant.Name
+		}
+		item.Modifiers = modifiers
+		item.UnitPrice = unitPrice
+		item.Price = unitPrice * float64(item.Quantity)
+		order.TotalPrice += item.Price
+	}
+	return nil
+}
 
-	userID := c.Query("userId")
+func GetNewOrderForCurrentUser(c *gin.Context) {
+	userID := c.GetString("userId")
 
-	var order models.Order
-	err := collection.FindOne(context.TODO(), bson.M{"userId": userID, "status": "Pending"}).Decode(&order)
+	order, err := Repos.Orders.Pending(context.TODO(), middleware.StoreID(c), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "No new order found"})
 		return
@@ -72,9 +212,6 @@ func GetNewOrderForCurrentUser(c *gin.Context) {
 }
 
 func Pay(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("orders")
-
 	var req struct {
 		PaymentID string `json:"paymentId"`
 	}
@@ -84,11 +221,22 @@ func Pay(c *gin.Context) {
 		return
 	}
 
-	filter := bson.M{"paymentId": req.PaymentID}
-	update := bson.M{"$set": bson.M{"status": "Paid", "updatedAt": time.Now()}}
-
-	result, err := collection.UpdateOne(context.TODO(), filter, update)
-	if err != nil || result.ModifiedCount == 0 {
+	err := Transactions.Do(context.TODO(), func(ctx context.Context) error {
+		order, err := Repos.Orders.Pay(ctx, req.PaymentID)
+		if err != nil {
+			return err
+		}
+		change := events.StatusChange{OrderID: order.ID, UserID: order.UserID, From: order.Status, To: "Paid"}
+		if err := publish(ctx, events.OrderPaid, order.ID, order.StoreID, change); err != nil {
+			return err
+		}
+		return publish(ctx, events.OrderStatusChanged, order.ID, order.StoreID, change)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending orders can be paid"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
 		return
 	}
@@ -96,43 +244,140 @@ func Pay(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Payment successful"})
 }
 
-func TrackOrderById(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("orders")
+// CancelOrder cancels an unpaid order and releases its reserved stock
+func CancelOrder(c *gin.Context) {
+	setFailedStatus(c, "Cancelled", "Order cancelled")
+}
+
+// PaymentFailed marks an order's payment as failed and releases its
+// reserved stock
+func PaymentFailed(c *gin.Context) {
+	setFailedStatus(c, "PaymentFailed", "Payment failed")
+}
 
+func setFailedStatus(c *gin.Context, status, reason string) {
 	orderID := c.Param("orderId")
 
-	var order models.Order
-	err := collection.FindOne(context.TODO(), bson.M{"id": orderID}).Decode(&order)
+	store, ok := storeOrAbort(c)
+	if !ok {
+		return
+	}
+
+	// The status change and the release of the order's slot and stock are
+	// written together or not at all
+	err := Transactions.Do(context.TODO(), func(ctx context.Context) error {
+		order, err := Repos.Orders.ByID(ctx, orderID)
+		if err != nil || order.StoreID != store.ID {
+			return repository.ErrNotFound
+		}
+		if order.UserID != c.GetString("userId") && !managesStore(c, store) {
+			return errNotYourOrder
+		}
+
+		order, err = Repos.Orders.Transition(ctx, store.ID, orderID, "Pending", status)
+		if err != nil {
+			return err
+		}
+		if order.ScheduledFor != nil {
+			if err := Repos.Stores.ReleaseSlot(ctx, order.StoreID, *order.ScheduledFor); err != nil {
+				return err
+			}
+		}
+		if err := releaseStock(ctx, orderID, reason); err != nil {
+			return err
+		}
+		change := events.StatusChange{OrderID: order.ID, UserID: order.UserID, From: order.Status, To: status}
+		return publish(ctx, events.OrderStatusChanged, order.ID, order.StoreID, change)
+	})
+	if errors.Is(err, errNotYourOrder) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending orders can be updated"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"order": order, "status": order.Status})
+	c.JSON(http.StatusOK, gin.H{"message": reason})
 }
 
-func GetAll(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("orders")
+// managesStore reports whether the caller is a super admin or an admin on
+// the store's staff
+func managesStore(c *gin.Context, store models.Store) bool {
+	if c.GetBool("isSuperAdmin") {
+		return true
+	}
+	return c.GetBool("isAdmin") && store.HasStaff(c.GetString("userId"))
+}
 
-	state := c.Query("state")
+// DeliverOrder marks a paid order as delivered, which lets the customer
+// review its foods
+func DeliverOrder(c *gin.Context) {
+	orderID := c.Param("orderId")
 
-	filter := bson.M{}
-	if state != "" {
-		filter["status"] = state
+	err := Transactions.Do(context.TODO(), func(ctx context.Context) error {
+		order, err := Repos.Orders.Transition(ctx, middleware.StoreID(c), orderID, "Paid", "Delivered")
+		if err != nil {
+			return err
+		}
+		change := events.StatusChange{OrderID: order.ID, UserID: order.UserID, From: order.Status, To: "Delivered"}
+		return publish(ctx, events.OrderStatusChanged, order.ID, order.StoreID, change)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only paid orders can be delivered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+		return
 	}
 
-	cursor, err := collection.Find(context.TODO(), filter)
+	c.JSON(http.StatusOK, gin.H{"message": "Order delivered successfully"})
+}
+
+// GetKitchenOrders lists paid orders that have been released to the
+// kitchen, oldest first
+func GetKitchenOrders(c *gin.Context) {
+	orders, err := Repos.Orders.Kitchen(context.TODO(), middleware.StoreID(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve orders"})
 		return
 	}
-	defer cursor.Close(context.TODO())
 
-	var orders []models.Order
-	if err = cursor.All(context.TODO(), &orders); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode orders"})
+	c.JSON(http.StatusOK, gin.H{"orders": orders})
+}
+
+func TrackOrderById(c *gin.Context) {
+	orderID := c.Param("orderId")
+
+	order, err := Repos.Orders.ByID(context.TODO(), orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.UserID != c.GetString("userId") {
+		store, err := loadStore(order.StoreID)
+		if err != nil || !managesStore(c, store) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"order": order, "status": order.Status})
+}
+
+// GetAll lists the store's orders, only those in the state given in the
+// path if there is one
+func GetAll(c *gin.Context) {
+	state := c.Param("state")
+
+	orders, err := Repos.Orders.List(context.TODO(), middleware.StoreID(c), state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve orders"})
 		return
 	}
 
@@ -140,14 +385,11 @@ func GetAll(c *gin.Context) {
 }
 
 func GetAllStatus(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("orders")
-
-	cursor, err := collection.Distinct(context.TODO(), "status", bson.M{})
+	statuses, err := Repos.Orders.Statuses(context.TODO(), middleware.StoreID(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve statuses"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"statuses": cursor})
+	c.JSON(http.StatusOK, gin.H{"statuses": statuses})
 }
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go_backend/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetAllFiltersByStoreAndState(t *testing.T) {
+	useTestRepositories(t)
+	for _, order := range []models.Order{
+		{StoreID: models.DefaultStoreID, Status: "Paid"},
+		{StoreID: models.DefaultStoreID, Status: "Pending"},
+		{StoreID: "uptown", Status: "Paid"},
+	} {
+		order.ID = primitive.NewObjectID().Hex()
+		order.UserID, order.Name, order.Address = "ada", "Ada", "1 Main St"
+		order.CreatedAt, order.UpdatedAt = testSlot, testSlot
+		if err := Repos.Orders.Create(context.Background(), &order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for state, want := range map[string]int{"": 2, "Paid": 1, "Delivered": 0} {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Params = gin.Params{{Key: "state", Value: state}}
+		GetAll(c)
+
+		var body struct {
+			Orders []models.Order `json:"orders"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || recorder.Code != http.StatusOK {
+			t.Fatalf("GetAll(%q) = %d %s", state, recorder.Code, recorder.Body)
+		}
+		if len(body.Orders) != want {
+			t.Errorf("GetAll(%q) listed %d orders, want %d", state, len(body.Orders), want)
+		}
+		for _, order := range body.Orders {
+			if order.StoreID != models.DefaultStoreID || (state != "" && order.Status != state) {
+				t.Errorf("GetAll(%q) listed %+v", state, order)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go_backend/middleware"
+	"go_backend/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const defaultPasswordResetTTL = time.Hour
+
+// resetEmailLimiter caps the reset emails sent to one address, whoever
+// asks for them.
+var resetEmailLimiter = middleware.NewLimiter(3, time.Hour)
+
+// passwordResetTTL is how long reset links stay valid, set with
+// PASSWORD_RESET_TTL (default 1h).
+func passwordResetTTL() time.Duration {
+	if raw := os.Getenv("PASSWORD_RESET_TTL"); raw != "" {
+		if ttl, err := time.ParseDuration(raw); err == nil && ttl > 0 {
+			return ttl
+		}
+		log.Printf("Ignoring invalid PASSWORD_RESET_TTL %q", raw)
+	}
+	return defaultPasswordResetTTL
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ForgotPassword emails a reset link to the account with the given email.
+// It responds the same way whether or not the account exists.
+func ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+
+	// Sending in the background keeps the response time the same whether
+	// or not the account exists
+	if ok, _ := resetEmailLimiter.Allow(strings.ToLower(email)); ok {
+		go sendPasswordReset(email)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for this email, a password reset link has been sent"})
+}
+
+// sendPasswordReset stores a new reset token for the account with email,
+// if there is one, and emails it the link. Failures are logged only, so
+// the response can't reveal whether the account exists.
+func sendPasswordReset(email string) {
+	user, err := Repos.Users.ByEmail(context.TODO(), email)
+	if err != nil || Mailer == nil {
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		log.Printf("Failed to create password reset token: %v", err)
+		return
+	}
+	token := hex.EncodeToString(raw)
+	ttl := passwordResetTTL()
+
+	reset := models.PasswordReset{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    user.ID,
+		TokenHash: hashResetToken(token),
+		ExpiresAt: Clock.Now().Add(ttl),
+		CreatedAt: Clock.Now(),
+	}
+	if err := Repos.PasswordResets.Create(context.TODO(), &reset); err != nil {
+		log.Printf("Failed to store password reset token: %v", err)
+		return
+	}
+
+	err = Mailer.Send(user, "password_reset", map[string]interface{}{
+		"Link":         accountLink("RESET_PASSWORD_URL", "http://localhost:3000/reset-password", token),
+		"ValidMinutes": int(ttl.Minutes()),
+	})
+	if err != nil {
+		log.Printf("Failed to send password reset email to %s: %v", user.Email, err)
+	}
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword.
+// The token is used up, the account's other outstanding tokens are
+// discarded and every existing login token is revoked.
+func ResetPassword(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is required", "field": "password"})
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	// Claim the token atomically so it can only be used once
+	now := Clock.Now()
+	reset, err := Repos.PasswordResets.Claim(context.TODO(), hashResetToken(req.Token), now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This password reset link is invalid or has expired"})
+		return
+	}
+
+	user, err := Repos.Users.ByID(context.TODO(), reset.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This password reset link is invalid or has expired"})
+		return
+	}
+
+	user.Password = hashedPassword
+	user.TokenVersion++
+	// Following the emailed link proves the user owns the address
+	user.EmailVerified = true
+	user.UpdatedAt = now
+	if err := Repos.Users.Update(context.TODO(), &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := Repos.PasswordResets.Discard(context.TODO(), user.ID, now); err != nil {
+		log.Printf("Failed to discard password reset tokens for %s: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go_backend/clock"
+	"go_backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveJSON runs handler with body as the request's JSON, as the user
+// with userID when it isn't empty
+func serveJSON(handler gin.HandlerFunc, userID, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if userID != "" {
+		c.Set("userId", userID)
+	}
+	handler(c)
+	return recorder
+}
+
+func addTestUser(t *testing.T, password string) models.User {
+	t.Helper()
+	hashed, err := hashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{ID: "ada", Name: "Ada", Email: "ada@example.com", Password: hashed, CreatedAt: testSlot, UpdatedAt: testSlot}
+	if err := Repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func addTestReset(t *testing.T, token string, expiresAt time.Time) {
+	t.Helper()
+	reset := models.PasswordReset{ID: token, UserID: "ada", TokenHash: hashResetToken(token), ExpiresAt: expiresAt, CreatedAt: testSlot}
+	if err := Repos.PasswordResets.Create(context.Background(), &reset); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func storedUser(t *testing.T) models.User {
+	t.Helper()
+	user, err := Repos.Users.ByID(context.Background(), "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func useTestClock(t *testing.T, at time.Time) {
+	t.Helper()
+	previous := Clock
+	Clock = clock.Fixed(at)
+	t.Cleanup(func() { Clock = previous })
+}
+
+func TestResetPasswordUsesTokensOnce(t *testing.T) {
+	useTestRepositories(t)
+	useTestClock(t, testSlot)
+	addTestUser(t, "old-password")
+	addTestReset(t, "expired", testSlot.Add(-time.Second))
+	addTestReset(t, "first", testSlot.Add(time.Hour))
+	addTestReset(t, "second", testSlot.Add(time.Hour))
+
+	reset := func(token string) int {
+		return serveJSON(ResetPassword, "", `{"token":"`+token+`","password":"new-password"}`).Code
+	}
+	if code := reset("expired"); code != http.StatusBadRequest {
+		t.Errorf("reset with an expired token = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := reset("first"); code != http.StatusOK {
+		t.Fatalf("reset = %d, want %d", code, http.StatusOK)
+	}
+
+	user := storedUser(t)
+	if !checkPasswordHash("new-password", user.Password) || user.TokenVersion != 1 || !user.EmailVerified {
+		t.Errorf("after the reset user = %+v, want the new password, a bumped token version and a verified email", user)
+	}
+
+	// The used token and the account's other tokens are gone
+	for _, token := range []string{"first", "second"} {
+		if code := reset(token); code != http.StatusBadRequest {
+			t.Errorf("reset with the %s token afterwards = %d, want %d", token, code, http.StatusBadRequest)
+		}
+	}
+	if user := storedUser(t); user.TokenVersion != 1 {
+		t.Errorf("token version = %d after refused resets, want 1", user.TokenVersion)
+	}
+}
+
+func TestChangePasswordRevokesSessions(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	useTestRepositories(t)
+	useTestClock(t, testSlot)
+	addTestUser(t, "old-password")
+	addTestReset(t, "pending", testSlot.Add(time.Hour))
+
+	if code := serveJSON(ChangePassword, "ada", `{"oldPassword":"wrong","newPassword":"new-password"}`).Code; code != http.StatusUnauthorized {
+		t.Errorf("change with the wrong password = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	recorder := serveJSON(ChangePassword, "ada", `{"oldPassword":"old-password","newPassword":"new-password"}`)
+	var body struct {
+		Token string `json:"token"`
+	}
+	if recorder.Code != http.StatusOK || json.Unmarshal(recorder.Body.Bytes(), &body) != nil || body.Token == "" {
+		t.Fatalf("change = %d %s, want a new token", recorder.Code, recorder.Body)
+	}
+
+	user := storedUser(t)
+	if !checkPasswordHash("new-password", user.Password) || user.TokenVersion != 1 {
+		t.Errorf("after the change user = %+v, want the new password and a bumped token version", user)
+	}
+	if _, err := Repos.PasswordResets.Claim(context.Background(), hashResetToken("pending"), testSlot); err == nil {
+		t.Error("a reset link sent before the change still works")
+	}
+}
+
+func TestLoginRejectsBlockedUsers(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	useTestRepositories(t)
+	user := addTestUser(t, "password")
+
+	login := func(password string) int {
+		return serveJSON(Login, "", `{"email":"ada@example.com","password":"`+password+`"}`).Code
+	}
+	if code := login("password"); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+
+	user.IsBlocked = true
+	if err := Repos.Users.Update(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if code := login("password"); code != http.StatusForbidden {
+		t.Errorf("login when blocked = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := login("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("login when blocked with the wrong password = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
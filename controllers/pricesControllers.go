@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go_backend/middleware"
+	"go_backend/models"
+	"go_backend/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetPriceHistory lists a food's price changes, newest first, along with its
+// price schedules
+func GetPriceHistory(c *gin.Context) {
+	food, ok := storeFoodOrAbort(c)
+	if !ok {
+		return
+	}
+
+	history, err := Repos.Prices.History(context.TODO(), food.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+		return
+	}
+
+	schedules, err := Repos.Prices.Schedules(context.TODO(), food.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price schedules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"price": food.Price, "promotion": food.Promotion, "history": history, "schedules": schedules})
+}
+
+// SchedulePrice schedules a price change. With endsAt the price is a
+// promotion and the regular price returns when it ends.
+func SchedulePrice(c *gin.Context) {
+	var schedule models.PriceSchedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := Clock.Now()
+	if err := schedule.Validate(now); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	food, ok := storeFoodOrAbort(c)
+	if !ok {
+		return
+	}
+
+	schedule.ID = primitive.NewObjectID().Hex()
+	schedule.FoodID = food.ID.Hex()
+	schedule.StoreID = food.StoreID
+	schedule.Status = models.PriceScheduled
+	schedule.CreatedBy = c.GetString("userId")
+	schedule.CreatedAt = now
+	schedule.UpdatedAt = now
+
+	if err := Repos.Prices.CreateSchedule(context.TODO(), &schedule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule price"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Price scheduled successfully", "schedule": schedule})
+}
+
+// CancelPriceSchedule cancels a schedule that has not started, or ends a
+// running promotion now
+func CancelPriceSchedule(c *gin.Context) {
+	food, ok := storeFoodOrAbort(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := Repos.Prices.Schedule(context.TODO(), food.ID.Hex(), c.Param("scheduleId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Price schedule not found"})
+		return
+	}
+
+	from := schedule.Status
+	switch schedule.Status {
+	case models.PriceScheduled:
+		schedule.Status = models.PriceCancelled
+	case models.PriceActive:
+		// The scheduler restores the regular price on its next run
+		now := Clock.Now()
+		schedule.EndsAt = &now
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": "Price schedule has already finished"})
+		return
+	}
+
+	err = Repos.Prices.UpdateSchedule(context.TODO(), &schedule, from)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Price schedule was modified concurrently"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel price schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Price schedule cancelled successfully"})
+}
+
+// storeFoodOrAbort loads the :foodId food of the current store, responding
+// with an error when it can't
+func storeFoodOrAbort(c *gin.Context) (models.Food, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("foodId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid food ID"})
+		return models.Food{}, false
+	}
+
+	food, err := Repos.Foods.ByID(context.TODO(), middleware.StoreID(c), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food not found"})
+		return food, false
+	}
+	return food, true
+}
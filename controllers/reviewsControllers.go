@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go_backend/middleware"
+	"go_backend/models"
+	"go_backend/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxReviewImages = 5
+
+type CreateReviewRequest struct {
+	Rating  int      `json:"rating"`
+	Comment string   `json:"comment"`
+	Images  []string `json:"images"`
+}
+
+// GetFoodReviews lists the approved reviews of a food, most helpful first
+func GetFoodReviews(c *gin.Context) {
+	reviews, err := Repos.Reviews.Approved(context.TODO(), c.Param("foodId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// CreateReview submits a review for moderation. The logged-in user must have
+// a delivered order containing the food.
+func CreateReview(c *gin.Context) {
+	userID := c.GetString("userId")
+	foodID, err := primitive.ObjectIDFromHex(c.Param("foodId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid food ID"})
+		return
+	}
+
+	var req CreateReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Rating < 1 || req.Rating > 5 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rating must be between 1 and 5"})
+		return
+	}
+	if len(req.Images) > maxReviewImages {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many images"})
+		return
+	}
+
+	foods, err := Repos.Foods.ByIDs(context.TODO(), []primitive.ObjectID{foodID})
+	if err != nil || len(foods) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Food not found"})
+		return
+	}
+	food := foods[0]
+
+	order, err := Repos.Orders.Delivered(context.TODO(), userID, foodID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only review foods from your delivered orders"})
+		return
+	}
+
+	if _, err := Repos.Reviews.ByUser(context.TODO(), foodID.Hex(), userID); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already reviewed this food"})
+		return
+	}
+
+	user, _ := Repos.Users.ByID(context.TODO(), userID)
+
+	review := models.Review{
+		ID:        primitive.NewObjectID().Hex(),
+		FoodID:    foodID.Hex(),
+		StoreID:   food.StoreID,
+		UserID:    userID,
+		UserName:  user.Name,
+		OrderID:   order.ID,
+		Rating:    req.Rating,
+		Comment:   req.Comment,
+		Images:    req.Images,
+		Status:    models.ReviewPending,
+		HelpfulBy: []string{},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if err := Repos.Reviews.Create(context.TODO(), &review); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create review"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Review submitted for moderation", "review": review})
+}
+
+// GetPendingReviews lists reviews awaiting moderation
+func GetPendingReviews(c *gin.Context) {
+	reviews, err := Repos.Reviews.Pending(context.TODO(), middleware.StoreID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// ModerateReview approves or rejects a review and keeps the food's rating
+// in step with its approved reviews
+func ModerateReview(c *gin.Context) {
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status != models.ReviewApproved && req.Status != models.ReviewRejected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be Approved or Rejected"})
+		return
+	}
+
+	review, err := Repos.Reviews.ByID(context.TODO(), middleware.StoreID(c), c.Param("reviewId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+	if review.Status == req.Status {
+		c.JSON(http.StatusOK, gin.H{"message": "Review already " + req.Status})
+		return
+	}
+
+	// Only move from the status we read, so concurrent moderation can't
+	// apply the same rating change twice.
+	err = Repos.Reviews.Moderate(context.TODO(), review.ID, review.Status, req.Status, c.GetString("userId"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Review was modified concurrently"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate review"})
+		return
+	}
+
+	switch {
+	case req.Status == models.ReviewApproved:
+		err = applyRating(review.FoodID, review.Rating, 1)
+	case review.Status == models.ReviewApproved:
+		err = applyRating(review.FoodID, -review.Rating, -1)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update food rating"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Review " + req.Status})
+}
+
+// VoteReviewHelpful records the logged-in user's helpful vote, once per user
+func VoteReviewHelpful(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	err := Repos.Reviews.VoteHelpful(context.TODO(), c.Param("reviewId"), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record vote"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote recorded"})
+}
+
+// applyRating adjusts a food's rating totals and recomputes Stars in a
+// single update
+func applyRating(foodID string, sumDelta, countDelta int) error {
+	id, err := primitive.ObjectIDFromHex(foodID)
+	if err != nil {
+		return err
+	}
+
+	return Repos.Foods.ApplyRating(context.TODO(), id, sumDelta, countDelta)
+}
@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"go_backend/clock"
+	"go_backend/middleware"
+	"go_backend/models"
+	"go_backend/repository"
+	"go_backend/uow"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Clock is the time source for opening hours and availability checks.
+var Clock clock.Clock = clock.System{}
+
+// Repos stores the application's data.
+var Repos = repository.NewMongo()
+
+// Transactions runs checkout's writes as one unit of work. It must belong
+// to the same backend as Repos.
+var Transactions uow.UnitOfWork = Repos.Transactions
+
+var errSlotFull = errors.New("the requested time slot is full")
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// GetStores lists all stores
+func GetStores(c *gin.Context) {
+	stores, err := Repos.Stores.List(context.TODO())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stores"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stores)
+}
+
+// GetStore retrieves a store by its ID
+func GetStore(c *gin.Context) {
+	store, ok := storeOrAbort(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, store)
+}
+
+// CreateStore adds a new store
+func CreateStore(c *gin.Context) {
+	var store models.Store
+	if err := c.ShouldBindJSON(&store); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if store.Name == "" || !slugPattern.MatchString(store.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Store needs a name and a lowercase slug"})
+		return
+	}
+	if err := store.Schedule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateStaff(store.Staff); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	store.ID = primitive.NewObjectID().Hex()
+	store.CreatedAt = time.Now()
+	store.UpdatedAt = time.Now()
+
+	var duplicate *repository.DuplicateError
+	err := Repos.Stores.Create(context.TODO(), &store)
+	if errors.As(err, &duplicate) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A store with this slug already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create store"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Store created successfully", "store": store})
+}
+
+// UpdateStore updates a store's details and delivery zones
+func UpdateStore(c *gin.Context) {
+	var req models.Store
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Store needs a name"})
+		return
+	}
+	for _, zone := range req.DeliveryZones {
+		if zone.RadiusKm <= 0 || zone.DeliveryFee < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Delivery zones need a positive radius and a non-negative fee"})
+			return
+		}
+	}
+
+	req.ID = middleware.StoreID(c)
+	updateStore(c, &req, "Store updated successfully", "name", "address", "phone", "deliveryZones")
+}
+
+// UpdateStoreStaff replaces the list of admins who work at a store
+func UpdateStoreStaff(c *gin.Context) {
+	var staff []models.StoreStaff
+	if err := c.ShouldBindJSON(&staff); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateStaff(staff); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	store := models.Store{ID: middleware.StoreID(c), Staff: staff}
+	updateStore(c, &store, "Store staff updated successfully", "staff")
+}
+
+// GetStoreHours returns the store's opening hours and holiday exceptions
+func GetStoreHours(c *gin.Context) {
+	store, ok := storeOrAbort(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, store.Schedule)
+}
+
+// UpdateStoreHours replaces the store's opening hours, exceptions and slot
+// settings
+func UpdateStoreHours(c *gin.Context) {
+	var schedule models.StoreSchedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := schedule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	store := models.Store{ID: middleware.StoreID(c), Schedule: schedule}
+	updateStore(c, &store, "Store hours updated successfully", "schedule")
+}
+
+// GetStoreStatus reports whether the store is open right now
+func GetStoreStatus(c *gin.Context) {
+	store, ok := storeOrAbort(c)
+	if !ok {
+		return
+	}
+
+	now := Clock.Now()
+	c.JSON(http.StatusOK, gin.H{"open": store.Schedule.IsOpen(now), "time": now.In(store.Schedule.Location())})
+}
+
+// GetSlots lists the fulfillment slots on a date with their remaining
+// capacity. Remaining is -1 when slots are unlimited.
+func GetSlots(c *gin.Context) {
+	store, ok := storeOrAbort(c)
+	if !ok {
+		return
+	}
+	schedule := store.Schedule
+
+	date := c.Query("date")
+	if date == "" {
+		date = Clock.Now().In(schedule.Location()).Format("2006-01-02")
+	}
+	slots, err := schedule.SlotsOn(date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	type slotInfo struct {
+		Start     time.Time `json:"start"`
+		Remaining int       `json:"remaining"`
+	}
+	now := Clock.Now()
+	result := []slotInfo{}
+	for _, slot := range slots {
+		if validateSlot(schedule, slot, now) != nil {
+			continue
+		}
+		remaining := -1
+		if schedule.SlotCapacity > 0 {
+			taken, _ := Repos.Stores.SlotCount(context.TODO(), store.ID, slot)
+			remaining = schedule.SlotCapacity - taken
+			if remaining <= 0 {
+				continue
+			}
+		}
+		result = append(result, slotInfo{Start: slot, Remaining: remaining})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"date": date, "slots": result})
+}
+
+// validateSlot checks that a requested slot start is in the future, within
+// the advance-booking window and during opening hours
+func validateSlot(schedule models.StoreSchedule, slot, now time.Time) error {
+	switch {
+	case !slot.Equal(schedule.SlotStart(slot)):
+		return fmt.Errorf("scheduled time must be the start of a %v slot", schedule.SlotLength())
+	case !slot.After(now):
+		return fmt.Errorf("scheduled time must be in the future")
+	case schedule.MaxAdvanceDays > 0 && slot.After(now.AddDate(0, 0, schedule.MaxAdvanceDays)):
+		return fmt.Errorf("orders can be scheduled at most %d days ahead", schedule.MaxAdvanceDays)
+	case !schedule.IsOpen(slot):
+		return fmt.Errorf("the store is closed at the requested time")
+	}
+	return nil
+}
+
+// reserveSlot takes one place in a slot within the unit of work running
+// ctx, failing with errSlotFull once the slot's capacity is used up
+func reserveSlot(ctx context.Context, store models.Store, slot time.Time) error {
+	if store.Schedule.SlotCapacity <= 0 {
+		return nil
+	}
+
+	taken, err := Repos.Stores.TakeSlot(ctx, store.ID, slot)
+	if err != nil {
+		return err
+	}
+	uow.OnRollback(ctx, func() {
+		if err := Repos.Stores.ReleaseSlot(context.Background(), store.ID, slot); err != nil {
+			log.Println("Failed to release order slot:", err)
+		}
+	})
+	if taken > store.Schedule.SlotCapacity {
+		return errSlotFull
+	}
+	return nil
+}
+
+// loadStore reads a store by its ID
+func loadStore(storeID string) (models.Store, error) {
+	return Repos.Stores.ByID(context.TODO(), storeID)
+}
+
+// storeOrAbort loads the request's store, writing a 404 or 500 response
+// when it can't
+func storeOrAbort(c *gin.Context) (models.Store, bool) {
+	store, err := loadStore(middleware.StoreID(c))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		return store, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store"})
+		return store, false
+	}
+	return store, true
+}
+
+// updateStore saves the named fields of store, given by their JSON names
+func updateStore(c *gin.Context, store *models.Store, message string, fields ...string) {
+	err := Repos.Stores.Update(context.TODO(), store, fields...)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update store"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// validateStaff checks that every staff member is an existing admin with a
+// known role
+func validateStaff(staff []models.StoreStaff) error {
+	for _, member := range staff {
+		if member.Role != models.StaffManager && member.Role != models.StaffMember {
+			return fmt.Errorf("role must be %s or %s", models.StaffManager, models.StaffMember)
+		}
+		user, err := Repos.Users.ByID(context.TODO(), member.UserID)
+		if err != nil {
+			return fmt.Errorf("user %s not found", member.UserID)
+		}
+		if !user.IsAdmin {
+			return fmt.Errorf("user %s is not an admin", member.UserID)
+		}
+	}
+	return nil
+}
+
+// applyAvailability flags each food's current availability and drops the
+// unavailable ones unless the request asks for includeUnavailable=true
+func applyAvailability(c *gin.Context, foods []models.Food) []models.Food {
+	loc := time.UTC
+	if store, err := loadStore(middleware.StoreID(c)); err == nil {
+		loc = store.Schedule.Location()
+	}
+
+	now := Clock.Now()
+	keepAll := c.Query("includeUnavailable") == "true"
+
+	visible := make([]models.Food, 0, len(foods))
+	for _, food := range foods {
+		food.IsAvailable = food.AvailableAt(now, loc)
+		if food.IsAvailable || keepAll {
+			visible = append(visible, food)
+		}
+	}
+	return visible
+}
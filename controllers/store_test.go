@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go_backend/clock"
+	"go_backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetStoreStatusUsesClock(t *testing.T) {
+	useTestRepositories(t)
+	gin.SetMode(gin.TestMode)
+	store := models.Store{ID: models.DefaultStoreID, Schedule: models.StoreSchedule{
+		TimeZone:     "Europe/Paris",
+		OpeningHours: []models.DayHours{{Weekday: 5, Open: "18:00", Close: "01:00"}},
+	}}
+	if err := Repos.Stores.Update(context.Background(), &store, "schedule"); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := Clock
+	t.Cleanup(func() { Clock = previous })
+
+	// 2024-03-01 is a Friday; Paris is an hour ahead of UTC
+	for at, want := range map[time.Time]bool{
+		time.Date(2024, 3, 1, 16, 59, 0, 0, time.UTC): false,
+		time.Date(2024, 3, 1, 17, 0, 0, 0, time.UTC):  true,
+		time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC): true,
+		time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC):   false,
+	} {
+		Clock = clock.Fixed(at)
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		GetStoreStatus(c)
+
+		var body struct {
+			Open bool `json:"open"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatalf("at %v: %v in %s", at, err, recorder.Body)
+		}
+		if body.Open != want {
+			t.Errorf("at %v open = %v, want %v", at, body.Open, want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go_backend/middleware"
+	"go_backend/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// moveToTrash soft-deletes the record named by the route parameter
+func moveToTrash(c *gin.Context, trash repository.Trash, param, name string) {
+	err := trash.Delete(context.TODO(), middleware.StoreID(c), c.Param(param))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": name + " not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete " + name})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": name + " moved to trash"})
+}
+
+// restoreFromTrash restores the soft-deleted record named by the route
+// parameter
+func restoreFromTrash(c *gin.Context, trash repository.Trash, param, name string) {
+	err := trash.Restore(context.TODO(), middleware.StoreID(c), c.Param(param))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": name + " not found in trash"})
+		return
+	}
+	if duplicateKeyConflict(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore " + name})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": name + " restored successfully"})
+}
+
+// DeleteFood moves a food to the trash. Past orders keep their copy of it.
+func DeleteFood(c *gin.Context) {
+	moveToTrash(c, Repos.Foods, "foodId", "Food")
+}
+
+// RestoreFood brings a food back from the trash
+func RestoreFood(c *gin.Context) {
+	restoreFromTrash(c, Repos.Foods, "foodId", "Food")
+}
+
+// GetFoodTrash lists the store's deleted foods
+func GetFoodTrash(c *gin.Context) {
+	foods, err := Repos.Foods.Deleted(context.TODO(), middleware.StoreID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deleted foods"})
+		return
+	}
+
+	c.JSON(http.StatusOK, foods)
+}
+
+// DeleteUser moves a user to the trash. Deleted users can't log in.
+func DeleteUser(c *gin.Context) {
+	if c.Param("userId") == c.GetString("userId") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't delete your own account"})
+		return
+	}
+	moveToTrash(c, Repos.Users, "userId", "User")
+}
+
+// RestoreUser brings a user back from the trash unless their email has
+// been registered again in the meantime
+func RestoreUser(c *gin.Context) {
+	err := Repos.Users.Restore(context.TODO(), "", c.Param("userId"))
+	var duplicate *repository.DuplicateError
+	if errors.As(err, &duplicate) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another user has registered with this email"})
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found in trash"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore User"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User restored successfully"})
+}
+
+// GetUserTrash lists deleted users
+func GetUserTrash(c *gin.Context) {
+	users, err := Repos.Users.Deleted(context.TODO())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deleted users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// DeleteOrder moves a finished order to the trash. Pending orders still
+// hold stock and must be cancelled first.
+func DeleteOrder(c *gin.Context) {
+	order, err := Repos.Orders.ByID(context.TODO(), c.Param("orderId"))
+	if err == nil && order.StoreID == middleware.StoreID(c) && order.Status == "Pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Pending orders must be cancelled before they are deleted"})
+		return
+	}
+
+	moveToTrash(c, Repos.Orders, "orderId", "Order")
+}
+
+// RestoreOrder brings an order back from the trash
+func RestoreOrder(c *gin.Context) {
+	restoreFromTrash(c, Repos.Orders, "orderId", "Order")
+}
+
+// GetOrderTrash lists the store's deleted orders
+func GetOrderTrash(c *gin.Context) {
+	orders, err := Repos.Orders.Deleted(context.TODO(), middleware.StoreID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deleted orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
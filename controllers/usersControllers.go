@@ -2,14 +2,18 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
-	"go_backend/data"
+	"go_backend/events"
+	"go_backend/middleware"
 	"go_backend/models"
+	"go_backend/repository"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -24,10 +28,24 @@ func checkPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-func Login(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("users")
+// duplicateKeyConflict responds with 409 when err is a duplicate key error
+// and reports whether it did. The response names the field when it is
+// known.
+func duplicateKeyConflict(c *gin.Context, err error) bool {
+	var duplicate *repository.DuplicateError
+	if !errors.As(err, &duplicate) {
+		return false
+	}
+	field := duplicate.Field
+	if field == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "A record with these details already exists"})
+		return true
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": "This " + field + " is already in use", "field": field})
+	return true
+}
 
+func Login(c *gin.Context) {
 	var req struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -37,8 +55,7 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	err := collection.FindOne(context.TODO(), bson.M{"email": req.Email}).Decode(&user)
+	user, err := Repos.Users.ByEmail(context.TODO(), req.Email)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
@@ -48,22 +65,50 @@ func Login(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
+	// Checked after the password so the block isn't revealed to guessers
+	if user.IsBlocked {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account has been blocked"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	token, err := middleware.GenerateToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user, "token": token})
 }
 
-func Register(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("users")
+// RegisterRequest is the account a visitor signs up with. Roles and flags
+// are never taken from it.
+type RegisterRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Address  string `json:"address"`
+	Locale   string `json:"locale"`
+}
 
-	var req models.User
-	if err := c.ShouldBindJSON(&req); err != nil {
+func Register(c *gin.Context) {
+	var body RegisterRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	req := models.User{
+		Name:    body.Name,
+		Email:   strings.TrimSpace(body.Email),
+		Address: body.Address,
+		Locale:  body.Locale,
+	}
+	if !validEmail(req.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Please enter a valid email address", "field": "email"})
+		return
+	}
 
 	// Hash the password
-	hashedPassword, err := hashPassword(req.Password)
+	hashedPassword, err := hashPassword(body.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
@@ -73,50 +118,88 @@ func Register(c *gin.Context) {
 	req.CreatedAt = time.Now()
 	req.UpdatedAt = time.Now()
 
-	_, err = collection.InsertOne(context.TODO(), req)
+	err = Transactions.Do(context.TODO(), func(ctx context.Context) error {
+		if err := Repos.Users.Create(ctx, &req); err != nil {
+			return err
+		}
+		registration := events.Registration{UserID: req.ID, Name: req.Name, Email: req.Email}
+		return publish(ctx, events.UserRegistered, req.ID, "", registration)
+	})
+	if duplicateKeyConflict(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
+	sendVerificationEmail(req)
 
-	c.JSON(http.StatusOK, gin.H{"message": "User registered successfully", "user": req})
+	token, err := middleware.GenerateToken(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User registered successfully", "user": req, "token": token})
 }
 
-func UpdateProfile(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("users")
+// ProfileRequest holds the details users may change on their own account.
+type ProfileRequest struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Address string `json:"address"`
+	Locale  string `json:"locale"`
+}
 
-	var req models.User
+// UpdateProfile updates the caller's own account
+func UpdateProfile(c *gin.Context) {
+	var req ProfileRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	req.Email = strings.TrimSpace(req.Email)
 
-	filter := bson.M{"id": req.ID}
-	update := bson.M{
-		"$set": bson.M{
-			"name":      req.Name,
-			"email":     req.Email,
-			"address":   req.Address,
-			"updatedAt": time.Now(),
-		},
+	user, err := Repos.Users.ByID(context.TODO(), c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if req.Email != user.Email && !validEmail(req.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Please enter a valid email address", "field": "email"})
+		return
+	}
+	emailChanged := req.Email != user.Email
+	user.Name = req.Name
+	user.Email = req.Email
+	user.Address = req.Address
+	if emailChanged {
+		user.EmailVerified = false
 	}
+	if req.Locale != "" {
+		user.Locale = req.Locale
+	}
+	user.UpdatedAt = time.Now()
 
-	_, err := collection.UpdateOne(context.TODO(), filter, update)
+	err = Repos.Users.Update(context.TODO(), &user)
+	if duplicateKeyConflict(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
+	if emailChanged {
+		sendVerificationEmail(user)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
 }
 
+// ChangePassword changes the caller's own password. Other sessions are
+// logged out and the caller gets a new token.
 func ChangePassword(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("users")
-
 	var req struct {
-		UserID      string `json:"userId"`
 		OldPassword string `json:"oldPassword"`
 		NewPassword string `json:"newPassword"`
 	}
@@ -125,8 +208,7 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	err := collection.FindOne(context.TODO(), bson.M{"id": req.UserID}).Decode(&user)
+	user, err := Repos.Users.ByID(context.TODO(), c.GetString("userId"))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -143,32 +225,52 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
-	update := bson.M{"$set": bson.M{"password": hashedPassword, "updatedAt": time.Now()}}
-	_, err = collection.UpdateOne(context.TODO(), bson.M{"id": req.UserID}, update)
-	if err != nil {
+	user.Password = hashedPassword
+	// Log out every other session; the caller gets a fresh token below
+	user.TokenVersion++
+	user.UpdatedAt = time.Now()
+	if err := Repos.Users.Update(context.TODO(), &user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+	// Reset links sent for the old password must not override the new one
+	if err := Repos.PasswordResets.Discard(context.TODO(), user.ID, Clock.Now()); err != nil {
+		log.Printf("Failed to discard password reset tokens for %s: %v", user.ID, err)
+	}
+
+	token, err := middleware.GenerateToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully", "token": token})
 }
 
-func ToggleBlock(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("users")
+// GetAllUsers lists the users whose name or email contains the search term
+func GetAllUsers(c *gin.Context) {
+	users, err := Repos.Users.Search(context.TODO(), c.Param("searchTerm"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
 
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+func ToggleBlock(c *gin.Context) {
 	userID := c.Param("userId")
 
-	var user models.User
-	err := collection.FindOne(context.TODO(), bson.M{"id": userID}).Decode(&user)
+	user, err := Repos.Users.ByID(context.TODO(), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	update := bson.M{"$set": bson.M{"isBlocked": !user.IsBlocked, "updatedAt": time.Now()}}
-	_, err = collection.UpdateOne(context.TODO(), bson.M{"id": userID}, update)
-	if err != nil {
+	user.IsBlocked = !user.IsBlocked
+	user.UpdatedAt = time.Now()
+	if err := Repos.Users.Update(context.TODO(), &user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to toggle block status"})
 		return
 	}
@@ -177,13 +279,9 @@ func ToggleBlock(c *gin.Context) {
 }
 
 func GetById(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("users")
-
 	userID := c.Param("userId")
 
-	var user models.User
-	err := collection.FindOne(context.TODO(), bson.M{"id": userID}).Decode(&user)
+	user, err := Repos.Users.ByID(context.TODO(), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -192,33 +290,55 @@ func GetById(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
-func UpdateUser(c *gin.Context) {
-	client := data.GetMongoClient()
-	collection := client.Database("foodstoreDB").Collection("users")
+// UserUpdateRequest is an admin's edit of another account. Passwords and
+// super admin are never changed through it.
+type UserUpdateRequest struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Address   string `json:"address"`
+	IsAdmin   bool   `json:"isAdmin"`
+	IsBlocked bool   `json:"isBlocked"`
+}
 
-	var req models.User
+func UpdateUser(c *gin.Context) {
+	var req UserUpdateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	filter := bson.M{"id": req.ID}
-	update := bson.M{
-		"$set": bson.M{
-			"name":      req.Name,
-			"email":     req.Email,
-			"address":   req.Address,
-			"isAdmin":   req.IsAdmin,
-			"isBlocked": req.IsBlocked,
-			"updatedAt": time.Now(),
-		},
+	user, err := Repos.Users.ByID(context.TODO(), req.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if req.Email != user.Email && !validEmail(req.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Please enter a valid email address", "field": "email"})
+		return
 	}
+	emailChanged := req.Email != user.Email
+	user.Name = req.Name
+	user.Email = req.Email
+	user.Address = req.Address
+	if emailChanged {
+		user.EmailVerified = false
+	}
+	user.IsAdmin = req.IsAdmin
+	user.IsBlocked = req.IsBlocked
+	user.UpdatedAt = time.Now()
 
-	_, err := collection.UpdateOne(context.TODO(), filter, update)
+	err = Repos.Users.Update(context.TODO(), &user)
+	if duplicateKeyConflict(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
+	if emailChanged {
+		sendVerificationEmail(user)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
 }
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go_backend/middleware"
+	"go_backend/models"
+	"go_backend/notifications"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Mailer sends account emails such as verification links. Nothing is sent
+// while it is nil.
+var Mailer *notifications.Mailer
+
+// validEmail reports whether email is a bare address such as
+// "name@example.com".
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// accountLink builds a link to the frontend page configured by envVar,
+// falling back to fallback, with token in its query string.
+func accountLink(envVar, fallback, token string) string {
+	base := os.Getenv(envVar)
+	if base == "" {
+		base = fallback
+	}
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "token=" + url.QueryEscape(token)
+}
+
+// sendVerificationEmail emails user a link that verifies their current
+// address. Failures are logged; the user can ask for another link.
+func sendVerificationEmail(user models.User) {
+	if Mailer == nil {
+		return
+	}
+	token, err := middleware.GenerateVerificationToken(user)
+	if err != nil {
+		log.Printf("Failed to create verification token for %s: %v", user.ID, err)
+		return
+	}
+	err = Mailer.Send(user, "verify_email", map[string]interface{}{
+		"Link":       accountLink("VERIFY_EMAIL_URL", "http://localhost:3000/verify-email", token),
+		"ValidHours": int(middleware.VerificationTTL().Hours()),
+	})
+	if err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+	}
+}
+
+func VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, email, err := middleware.ParseVerificationToken(req.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This verification link is invalid or has expired"})
+		return
+	}
+
+	user, err := Repos.Users.ByID(context.TODO(), userID)
+	// A link sent before an email change must not verify the new address
+	if err != nil || user.Email != email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This verification link is invalid or has expired"})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+		return
+	}
+
+	user.EmailVerified = true
+	user.UpdatedAt = time.Now()
+	if err := Repos.Users.Update(context.TODO(), &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+func ResendVerification(c *gin.Context) {
+	user, err := Repos.Users.ByID(context.TODO(), c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already verified"})
+		return
+	}
+
+	sendVerificationEmail(user)
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent successfully"})
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go_backend/middleware"
+	"go_backend/models"
+	"go_backend/repository"
+	"go_backend/webhooks"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type webhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+	Active     *bool    `json:"active"`
+}
+
+// GetWebhooks lists the store's webhooks
+func GetWebhooks(c *gin.Context) {
+	hooks, err := Repos.Webhooks.List(context.TODO(), middleware.StoreID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": hooks, "eventTypes": webhooks.EventTypes})
+}
+
+// CreateWebhook registers an endpoint for the store's events. The signing
+// secret is returned only in this response.
+func CreateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hook := models.Webhook{
+		ID:         primitive.NewObjectID().Hex(),
+		StoreID:    middleware.StoreID(c),
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		Active:     req.Active == nil || *req.Active,
+		CreatedBy:  c.GetString("userId"),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if hook.EventTypes == nil {
+		hook.EventTypes = []string{}
+	}
+	if err := webhooks.Validate(context.TODO(), hook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	hook.Secret = secret
+
+	if err := Repos.Webhooks.Create(context.TODO(), &hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook added successfully", "webhook": hook, "secret": secret})
+}
+
+// UpdateWebhook changes a webhook's URL, event types or active flag
+func UpdateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hook, err := Repos.Webhooks.ByID(context.TODO(), middleware.StoreID(c), c.Param("webhookId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if req.URL != "" {
+		hook.URL = req.URL
+	}
+	if req.EventTypes != nil {
+		hook.EventTypes = req.EventTypes
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	if err := webhooks.Validate(context.TODO(), hook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := Repos.Webhooks.Update(context.TODO(), &hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook updated successfully"})
+}
+
+// DeleteWebhook removes a webhook. Its delivery log is kept, and pending
+// deliveries are dead-lettered when they come up.
+func DeleteWebhook(c *gin.Context) {
+	err := Repos.Webhooks.Delete(context.TODO(), middleware.StoreID(c), c.Param("webhookId"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// GetWebhookDeliveries lists a webhook's deliveries, newest first. The
+// status query parameter narrows them down, for example to DeadLetter.
+func GetWebhookDeliveries(c *gin.Context) {
+	limit := 100
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := Repos.Webhooks.Deliveries(context.TODO(), middleware.StoreID(c), c.Param("webhookId"), c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RedeliverWebhook queues a delivery to be sent again straight away with
+// a fresh set of attempts, whatever its current status
+func RedeliverWebhook(c *gin.Context) {
+	err := Repos.Webhooks.Redeliver(context.TODO(), middleware.StoreID(c), c.Param("deliveryId"), time.Now())
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeliver"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Delivery queued"})
+}
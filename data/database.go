@@ -6,6 +6,7 @@ import (
 	"os"
 	"sync"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -15,7 +16,13 @@ var (
 	once        sync.Once
 )
 
+// InitMongo connects to Mongo. Only the first call connects, so every
+// caller shares one client; sessions and transactions need that.
 func InitMongo() {
+	once.Do(connect)
+}
+
+func connect() {
 	var err error
 	mongoURI := os.Getenv("MONGO_URL")
 	if mongoURI == "" {
@@ -35,3 +42,15 @@ func GetMongoClient() *mongo.Client {
 	}
 	return mongoClient
 }
+
+// SupportsTransactions reports whether the Mongo server runs transactions.
+// Replica set members and sharded clusters do; standalone servers don't.
+func SupportsTransactions(ctx context.Context) (bool, error) {
+	var hello bson.M
+	err := GetMongoClient().Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false, err
+	}
+	_, replicaSet := hello["setName"]
+	return replicaSet || hello["msg"] == "isdbgrid", nil
+}
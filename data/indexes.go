@@ -0,0 +1,275 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Index declares a Mongo index. EnsureIndexes creates, rebuilds or drops
+// indexes so each collection has exactly the ones declared for it.
+type Index struct {
+	Name   string
+	Keys   bson.D
+	Unique bool
+	// Partial limits the index to matching documents. Unique indexes on
+	// soft-deleted collections use it so trashed documents don't count.
+	Partial bson.M
+	// Weights sets the relevance of each field of a text index. Fields
+	// left out weigh 1.
+	Weights bson.M
+	// TTL makes a TTL index on a date field: the server removes documents
+	// once the date is TTL in the past. Zero means documents never expire.
+	TTL time.Duration
+	// Field is the request field a duplicate key on a unique index is
+	// reported against.
+	Field string
+}
+
+// UserIndexes are the indexes on the users collection.
+var UserIndexes = []Index{
+	{
+		Name:    "email_unique",
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Unique:  true,
+		Partial: bson.M{"deletedAt.valid": false},
+		Field:   "email",
+	},
+}
+
+// OrderIndexes are the indexes on the orders collection.
+var OrderIndexes = []Index{
+	{Name: "userId_status", Keys: bson.D{{Key: "userId", Value: 1}, {Key: "status", Value: 1}}},
+	{Name: "createdAt", Keys: bson.D{{Key: "createdAt", Value: -1}}},
+}
+
+// FoodIndexes are the indexes on the foods collection.
+var FoodIndexes = []Index{
+	{
+		Name:    "text_search",
+		Keys:    bson.D{{Key: "name", Value: "text"}, {Key: "tags", Value: "text"}, {Key: "origins", Value: "text"}},
+		Weights: bson.M{"name": 10, "tags": 5},
+	},
+}
+
+// OutboxIndexes are the indexes on the outbox collection.
+var OutboxIndexes = []Index{
+	{Name: "id_unique", Keys: bson.D{{Key: "id", Value: 1}}, Unique: true},
+	{Name: "due", Keys: bson.D{{Key: "dispatchedAt", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+}
+
+// WebhookDeliveryIndexes are the indexes on the webhook_deliveries
+// collection. The unique index keeps one delivery per webhook and event.
+var WebhookDeliveryIndexes = []Index{
+	{Name: "webhook_event_unique", Keys: bson.D{{Key: "webhookId", Value: 1}, {Key: "eventId", Value: 1}}, Unique: true},
+	{Name: "due", Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+	{Name: "webhook_created", Keys: bson.D{{Key: "webhookId", Value: 1}, {Key: "createdAt", Value: -1}}},
+}
+
+// PasswordResetIndexes are the indexes on the password_resets collection.
+// Tokens are looked up by hash and removed a day after they expire.
+var PasswordResetIndexes = []Index{
+	{Name: "tokenHash_unique", Keys: bson.D{{Key: "tokenHash", Value: 1}}, Unique: true},
+	{Name: "expiry", Keys: bson.D{{Key: "expiresAt", Value: 1}}, TTL: 24 * time.Hour},
+}
+
+// Indexes maps each managed collection to its declared indexes.
+// Collections missing from it are left alone.
+var Indexes = map[string][]Index{
+	"users":  UserIndexes,
+	"orders": OrderIndexes,
+	"foods":  FoodIndexes,
+	"outbox": OutboxIndexes,
+
+	"password_resets":    PasswordResetIndexes,
+	"webhook_deliveries": WebhookDeliveryIndexes,
+}
+
+// EnsureIndexes reconciles the indexes of every collection in Indexes. A
+// failure on one index, such as a unique index over existing duplicates,
+// doesn't stop the others; all failures are returned together.
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	var errs []error
+	for name, declared := range Indexes {
+		if err := ensureIndexes(ctx, db.Collection(name), declared); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// indexSpec is an index as listed by the server.
+type indexSpec struct {
+	Name    string `bson:"name"`
+	Key     bson.D `bson:"key"`
+	Unique  bool   `bson:"unique"`
+	Partial bson.M `bson:"partialFilterExpression"`
+	Weights bson.M `bson:"weights"`
+	TTL     *int64 `bson:"expireAfterSeconds"`
+}
+
+func ensureIndexes(ctx context.Context, collection *mongo.Collection, declared []Index) error {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	var specs []indexSpec
+	if err := cursor.All(ctx, &specs); err != nil {
+		return err
+	}
+
+	existing := map[string]indexSpec{}
+	for _, spec := range specs {
+		existing[spec.Name] = spec
+	}
+	wanted := map[string]bool{"_id_": true}
+	for _, index := range declared {
+		wanted[index.Name] = true
+	}
+
+	var errs []error
+	drop := func(name string) bool {
+		if _, err := collection.Indexes().DropOne(ctx, name); err != nil {
+			errs = append(errs, fmt.Errorf("drop index %s: %w", name, err))
+			return false
+		}
+		return true
+	}
+
+	for name := range existing {
+		if !wanted[name] && drop(name) {
+			log.Printf("Dropped index %s.%s", collection.Name(), name)
+		}
+	}
+
+	for _, index := range declared {
+		if spec, ok := existing[index.Name]; ok {
+			if index.matches(spec) {
+				continue
+			}
+			if !drop(index.Name) {
+				continue
+			}
+		}
+		if _, err := collection.Indexes().CreateOne(ctx, index.model()); err != nil {
+			errs = append(errs, fmt.Errorf("create index %s: %w", index.Name, err))
+			continue
+		}
+		log.Printf("Created index %s.%s", collection.Name(), index.Name)
+	}
+	return errors.Join(errs...)
+}
+
+func (index Index) model() mongo.IndexModel {
+	opts := options.Index().SetName(index.Name)
+	if index.Unique {
+		opts.SetUnique(true)
+	}
+	if index.Partial != nil {
+		opts.SetPartialFilterExpression(index.Partial)
+	}
+	if index.Weights != nil {
+		opts.SetWeights(index.Weights)
+	}
+	if index.TTL > 0 {
+		opts.SetExpireAfterSeconds(int32(index.TTL.Seconds()))
+	}
+	return mongo.IndexModel{Keys: index.Keys, Options: opts}
+}
+
+// matches reports whether the server's index spec is the one declared.
+// The server lists a text index's fields as weights rather than keys.
+func (index Index) matches(spec indexSpec) bool {
+	if spec.Unique != index.Unique {
+		return false
+	}
+	if !reflect.DeepEqual(normalize(spec.Partial), normalize(index.Partial)) {
+		return false
+	}
+	if (spec.TTL != nil) != (index.TTL > 0) || spec.TTL != nil && *spec.TTL != int64(index.TTL.Seconds()) {
+		return false
+	}
+
+	weights := bson.M{}
+	keys := bson.D{}
+	for _, key := range index.Keys {
+		if key.Value == "text" {
+			weights[key.Key] = 1
+			if weight, ok := index.Weights[key.Key]; ok {
+				weights[key.Key] = weight
+			}
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(weights) > 0 {
+		keys = append(bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: 1}}, keys...)
+	} else {
+		weights = nil
+	}
+
+	return reflect.DeepEqual(normalize(spec.Key), normalize(keys)) &&
+		reflect.DeepEqual(normalize(spec.Weights), normalize(weights))
+}
+
+// normalize converts the numbers in an index document to float64, since
+// the server may list them as any numeric type. Empty documents become nil.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.M:
+		if len(v) == 0 {
+			return nil
+		}
+		m := map[string]interface{}{}
+		for key, item := range v {
+			m[key] = normalize(item)
+		}
+		return m
+	case bson.D:
+		if len(v) == 0 {
+			return nil
+		}
+		d := []interface{}{}
+		for _, item := range v {
+			d = append(d, item.Key, normalize(item.Value))
+		}
+		return d
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return value
+}
+
+var duplicateIndex = regexp.MustCompile(`index: (\S+) dup key`)
+
+// DuplicateKeyField reports whether err is a duplicate key error and, when
+// the index that rejected it is declared, the request field it covers.
+func DuplicateKeyField(err error) (string, bool) {
+	if !mongo.IsDuplicateKeyError(err) {
+		return "", false
+	}
+	match := duplicateIndex.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", true
+	}
+	for _, declared := range Indexes {
+		for _, index := range declared {
+			if index.Name == match[1] {
+				return index.Field, true
+			}
+		}
+	}
+	return "", true
+}
@@ -0,0 +1,102 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Handler reacts to an event. Delivery is at least once, so handlers must
+// tolerate seeing the same event ID again.
+type Handler func(ctx context.Context, event Event) error
+
+// Sink receives every event, for example to forward it to another
+// system.
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, event Event) error
+}
+
+type subscriber struct {
+	name    string
+	handler Handler
+}
+
+// Bus delivers events to in-process subscribers and sinks.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[string][]subscriber
+	sinks       []Sink
+}
+
+// NewBus returns a Bus with no subscribers.
+func NewBus() *Bus {
+	return &Bus{subscribers: map[string][]subscriber{}}
+}
+
+// Subscribe calls handler for events of eventType, or for every event when
+// eventType is "*". The name, unique among the bus's subscribers and
+// sinks, records which of them have handled an event so a retry skips
+// them.
+func (b *Bus) Subscribe(eventType, name string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[eventType] = append(b.subscribers[eventType], subscriber{name, handler})
+}
+
+// AddSink delivers every event to sink.
+func (b *Bus) AddSink(sink Sink) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sinks = append(b.sinks, sink)
+}
+
+// Publish delivers event to every matching subscriber and sink. All of
+// them are tried; the failures are returned together.
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	_, err := b.Deliver(ctx, event, nil)
+	return err
+}
+
+// Deliver is Publish skipping the subscribers and sinks named in
+// delivered. It returns delivered along with the names of those that
+// handled the event this time.
+func (b *Bus) Deliver(ctx context.Context, event Event, delivered []string) ([]string, error) {
+	b.mu.RLock()
+	subscribers := append(append([]subscriber(nil), b.subscribers[event.Type]...), b.subscribers["*"]...)
+	for _, sink := range b.sinks {
+		subscribers = append(subscribers, subscriber{sink.Name(), sink.Deliver})
+	}
+	b.mu.RUnlock()
+
+	done := map[string]bool{}
+	for _, name := range delivered {
+		done[name] = true
+	}
+	delivered = append([]string(nil), delivered...)
+	var errs []error
+	for _, s := range subscribers {
+		if done[s.name] {
+			continue
+		}
+		if err := s.handler(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+			continue
+		}
+		done[s.name] = true
+		delivered = append(delivered, s.name)
+	}
+	return delivered, errors.Join(errs...)
+}
+
+// LogSink writes each event to the server log.
+type LogSink struct{}
+
+func (LogSink) Name() string { return "log" }
+
+func (LogSink) Deliver(ctx context.Context, event Event) error {
+	log.Printf("Event %s %s %s: %s", event.ID, event.Type, event.AggregateID, event.Data)
+	return nil
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go_backend/clock"
+)
+
+const (
+	defaultBatchSize = 100
+	// claimLease is how long a claimed event is hidden from other
+	// dispatchers while it is being delivered.
+	claimLease = time.Minute
+	maxBackoff = time.Hour
+	// defaultMaxAttempts gives an event about half a day of retries once
+	// the backoff reaches an hour.
+	defaultMaxAttempts = 20
+	defaultRetention   = 7 * 24 * time.Hour
+)
+
+// Record is an event in the outbox along with its delivery state.
+type Record struct {
+	Event         `bson:",inline"`
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt" bson:"nextAttemptAt"`
+	DispatchedAt  *time.Time `json:"dispatchedAt" bson:"dispatchedAt"`
+	LastError     string     `json:"lastError" bson:"lastError"`
+	// Delivered names the subscribers and sinks that have handled the
+	// event, which retries skip.
+	Delivered []string `json:"delivered" bson:"delivered"`
+	// DeadAt is when the dispatcher gave up on the event. Dead events are
+	// no longer claimed and are kept for inspection.
+	DeadAt *time.Time `json:"deadAt" bson:"deadAt"`
+}
+
+// NewRecord is the outbox entry for a freshly published event, due at
+// once.
+func NewRecord(event Event) Record {
+	return Record{Event: event, NextAttemptAt: event.OccurredAt}
+}
+
+// Outbox stores events until they have been dispatched.
+type Outbox interface {
+	// Add stores event. Called with a unit of work's context, it is part
+	// of that unit of work.
+	Add(ctx context.Context, event Event) error
+	// Claim returns up to limit undispatched, live events due at now,
+	// oldest first, and hides them from other claims until until.
+	Claim(ctx context.Context, now, until time.Time, limit int) ([]Record, error)
+	MarkDispatched(ctx context.Context, id string, at time.Time) error
+	// MarkFailed saves a failed delivery: the record's attempts, next
+	// attempt, last error, delivered subscribers and, once the dispatcher
+	// gives up, DeadAt.
+	MarkFailed(ctx context.Context, record Record) error
+	// Prune removes the events dispatched before before and returns how
+	// many it removed.
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// Dispatcher moves events from an Outbox to a Bus.
+type Dispatcher struct {
+	Outbox    Outbox
+	Bus       *Bus
+	Clock     clock.Clock
+	BatchSize int
+	// MaxAttempts is how many failed deliveries make an event dead.
+	MaxAttempts int
+	// Retention is how long dispatched events are kept before Prune
+	// removes them.
+	Retention time.Duration
+}
+
+// Run delivers the events that are due. An event whose delivery fails is
+// retried with exponential backoff, only to the subscribers and sinks that
+// haven't handled it yet, until MaxAttempts.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	batch := d.BatchSize
+	if batch <= 0 {
+		batch = defaultBatchSize
+	}
+	maxAttempts := d.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	now := d.Clock.Now()
+	records, err := d.Outbox.Claim(ctx, now, now.Add(claimLease), batch)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		delivered, err := d.Bus.Deliver(ctx, record.Event, record.Delivered)
+		if err != nil {
+			record.Attempts++
+			record.Delivered = delivered
+			record.LastError = err.Error()
+			record.NextAttemptAt = d.Clock.Now().Add(Backoff(record.Attempts))
+			if record.Attempts >= maxAttempts {
+				deadAt := d.Clock.Now()
+				record.DeadAt = &deadAt
+				log.Printf("Giving up on event %s %s after %d attempts: %v", record.ID, record.Type, record.Attempts, err)
+			} else {
+				log.Printf("Failed to dispatch event %s %s (attempt %d): %v", record.ID, record.Type, record.Attempts, err)
+			}
+			if err := d.Outbox.MarkFailed(ctx, record); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.Outbox.MarkDispatched(ctx, record.ID, d.Clock.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune removes the events dispatched longer than Retention ago. Dead
+// events are kept.
+func (d *Dispatcher) Prune(ctx context.Context) error {
+	retention := d.Retention
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+	pruned, err := d.Outbox.Prune(ctx, d.Clock.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d dispatched events", pruned)
+	}
+	return nil
+}
+
+// Backoff is the delay before retrying after the given number of failed
+// attempts: 10s, 20s, 40s and so on, capped at an hour.
+func Backoff(attempts int) time.Duration {
+	delay := 10 * time.Second
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
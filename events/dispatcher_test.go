@@ -0,0 +1,213 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go_backend/clock"
+)
+
+var testTime = time.Date(2024, 3, 1, 18, 30, 0, 0, time.UTC)
+
+// testOutbox hands out its records on the first claim and remembers what
+// the dispatcher made of them
+type testOutbox struct {
+	records    []Record
+	claims     []time.Time
+	limit      int
+	dispatched map[string]time.Time
+	failed     map[string]Record
+	prunedTo   time.Time
+}
+
+func (o *testOutbox) Add(ctx context.Context, event Event) error {
+	o.records = append(o.records, NewRecord(event))
+	return nil
+}
+
+func (o *testOutbox) Claim(ctx context.Context, now, until time.Time, limit int) ([]Record, error) {
+	o.claims = append(o.claims, now, until)
+	o.limit = limit
+	records := o.records
+	o.records = nil
+	return records, nil
+}
+
+func (o *testOutbox) MarkDispatched(ctx context.Context, id string, at time.Time) error {
+	o.dispatched[id] = at
+	return nil
+}
+
+func (o *testOutbox) MarkFailed(ctx context.Context, record Record) error {
+	o.failed[record.ID] = record
+	return nil
+}
+
+func (o *testOutbox) Prune(ctx context.Context, before time.Time) (int, error) {
+	o.prunedTo = before
+	return 0, nil
+}
+
+func newTestDispatcher(records ...Record) (*Dispatcher, *testOutbox) {
+	outbox := &testOutbox{records: records, dispatched: map[string]time.Time{}, failed: map[string]Record{}}
+	return &Dispatcher{Outbox: outbox, Bus: NewBus(), Clock: clock.Fixed(testTime)}, outbox
+}
+
+func testRecord(id, eventType string, attempts int) Record {
+	return Record{Event: Event{ID: id, Type: eventType, OccurredAt: testTime}, Attempts: attempts, NextAttemptAt: testTime}
+}
+
+func TestDispatcherClaimsDueEventsWithALease(t *testing.T) {
+	d, outbox := newTestDispatcher()
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(outbox.claims) != 2 || !outbox.claims[0].Equal(testTime) || !outbox.claims[1].Equal(testTime.Add(claimLease)) {
+		t.Errorf("claimed with now and until %v, want %v and %v", outbox.claims, testTime, testTime.Add(claimLease))
+	}
+	if outbox.limit != defaultBatchSize {
+		t.Errorf("claimed %d events, want the default batch of %d", outbox.limit, defaultBatchSize)
+	}
+
+	d.BatchSize = 5
+	d.Run(context.Background())
+	if outbox.limit != 5 {
+		t.Errorf("claimed %d events, want the batch size of 5", outbox.limit)
+	}
+}
+
+func TestDispatcherMarksDeliveredEvents(t *testing.T) {
+	d, outbox := newTestDispatcher(testRecord("paid", OrderPaid, 0), testRecord("created", OrderCreated, 2))
+	delivered := []string{}
+	d.Bus.Subscribe("*", "test", func(ctx context.Context, event Event) error {
+		delivered = append(delivered, event.ID)
+		return nil
+	})
+
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 2 || delivered[0] != "paid" || delivered[1] != "created" {
+		t.Errorf("delivered %v, want paid then created", delivered)
+	}
+	for _, id := range delivered {
+		if at, ok := outbox.dispatched[id]; !ok || !at.Equal(testTime) {
+			t.Errorf("%s dispatched at %v, want %v", id, at, testTime)
+		}
+	}
+	if len(outbox.failed) != 0 {
+		t.Errorf("marked failed: %v", outbox.failed)
+	}
+}
+
+func TestDispatcherRetriesFailedEvents(t *testing.T) {
+	d, outbox := newTestDispatcher(testRecord("first", OrderPaid, 0), testRecord("again", OrderPaid, 3), testRecord("other", OrderCreated, 0))
+	d.Bus.Subscribe(OrderPaid, "email", func(ctx context.Context, event Event) error {
+		return errors.New("mail server down")
+	})
+
+	// One event failing doesn't stop the others from being delivered
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := outbox.dispatched["other"]; !ok || len(outbox.dispatched) != 1 {
+		t.Errorf("dispatched %v, want only other", outbox.dispatched)
+	}
+
+	for id, attempts := range map[string]int{"first": 1, "again": 4} {
+		got, ok := outbox.failed[id]
+		if !ok || got.Attempts != attempts || !got.NextAttemptAt.Equal(testTime.Add(Backoff(attempts))) || got.LastError != "email: mail server down" || got.DeadAt != nil {
+			t.Errorf("%s marked failed with %+v, want attempt %d retried after %v", id, got, attempts, Backoff(attempts))
+		}
+	}
+}
+
+func TestDispatcherRetriesOnlyUndeliveredSubscribers(t *testing.T) {
+	d, outbox := newTestDispatcher(testRecord("paid", OrderPaid, 0))
+	emails, calls := 0, 0
+	d.Bus.Subscribe(OrderPaid, "email", func(ctx context.Context, event Event) error {
+		emails++
+		return nil
+	})
+	d.Bus.Subscribe(OrderPaid, "flaky", func(ctx context.Context, event Event) error {
+		calls++
+		if calls == 1 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	failed := outbox.failed["paid"]
+	if len(failed.Delivered) != 1 || failed.Delivered[0] != "email" {
+		t.Fatalf("delivered to %v, want email", failed.Delivered)
+	}
+
+	// The retry skips the subscriber that already sent its email
+	outbox.records = []Record{failed}
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if emails != 1 || calls != 2 {
+		t.Errorf("emails = %d, flaky calls = %d, want 1 and 2", emails, calls)
+	}
+	if _, ok := outbox.dispatched["paid"]; !ok {
+		t.Error("paid wasn't dispatched after the retry")
+	}
+}
+
+func TestDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	d, outbox := newTestDispatcher(testRecord("paid", OrderPaid, 2))
+	d.MaxAttempts = 3
+	d.Bus.Subscribe(OrderPaid, "email", func(ctx context.Context, event Event) error {
+		return errors.New("mail server down")
+	})
+
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := outbox.failed["paid"]
+	if got.Attempts != 3 || got.DeadAt == nil || !got.DeadAt.Equal(testTime) {
+		t.Errorf("marked failed with %+v, want dead after 3 attempts", got)
+	}
+}
+
+func TestDispatcherPrunesDispatchedEvents(t *testing.T) {
+	d, outbox := newTestDispatcher()
+	if err := d.Prune(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := testTime.Add(-defaultRetention); !outbox.prunedTo.Equal(want) {
+		t.Errorf("pruned up to %v, want %v", outbox.prunedTo, want)
+	}
+
+	d.Retention = time.Hour
+	d.Prune(context.Background())
+	if want := testTime.Add(-time.Hour); !outbox.prunedTo.Equal(want) {
+		t.Errorf("pruned up to %v, want %v", outbox.prunedTo, want)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
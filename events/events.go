@@ -0,0 +1,68 @@
+// Package events publishes domain events through a transactional outbox.
+// State changes add their events to the outbox in the same unit of work,
+// and a Dispatcher later delivers them at least once to the subscribers
+// and sinks of a Bus.
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Event types.
+const (
+	OrderCreated       = "order.created"
+	OrderPaid          = "order.paid"
+	OrderStatusChanged = "order.status_changed"
+	UserRegistered     = "user.registered"
+)
+
+// Event is something that happened to an order or user. Data is the JSON
+// encoding of the type's payload.
+type Event struct {
+	ID          string          `json:"id" bson:"id"`
+	Type        string          `json:"type" bson:"type"`
+	AggregateID string          `json:"aggregateId" bson:"aggregateId"`
+	StoreID     string          `json:"storeId" bson:"storeId"`
+	Data        json.RawMessage `json:"data" bson:"data"`
+	OccurredAt  time.Time       `json:"occurredAt" bson:"occurredAt"`
+}
+
+// StatusChange is the payload of OrderStatusChanged and OrderPaid.
+type StatusChange struct {
+	OrderID string `json:"orderId"`
+	UserID  string `json:"userId"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// Registration is the payload of UserRegistered. It leaves out the
+// password hash.
+type Registration struct {
+	UserID string `json:"userId"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+}
+
+// New builds an event of the given type with data as its payload.
+func New(eventType, aggregateID, storeID string, data interface{}) (Event, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:          primitive.NewObjectID().Hex(),
+		Type:        eventType,
+		AggregateID: aggregateID,
+		StoreID:     storeID,
+		Data:        encoded,
+		OccurredAt:  time.Now(),
+	}, nil
+}
+
+// Decode unmarshals the event's payload into v.
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
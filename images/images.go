@@ -0,0 +1,129 @@
+// Package images validates uploaded photos and renders the resized JPEG,
+// PNG and WebP variants served to clients. Re-encoding drops all metadata,
+// including EXIF, after the EXIF orientation has been applied.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxUploadBytes is the largest accepted upload.
+const MaxUploadBytes = 10 << 20
+
+// maxPixels guards against decompression bombs.
+const maxPixels = 40_000_000
+
+var ErrUnsupportedType = errors.New("only JPEG, PNG, GIF and WebP images are accepted")
+
+// Size is a named variant whose longest side is at most MaxDim pixels.
+type Size struct {
+	Name   string
+	MaxDim int
+}
+
+// Sizes are the variants generated for every upload.
+var Sizes = []Size{
+	{Name: "thumbnail", MaxDim: 150},
+	{Name: "medium", MaxDim: 600},
+	{Name: "large", MaxDim: 1200},
+}
+
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Variant is one encoded rendition of an uploaded image.
+type Variant struct {
+	Size        string
+	Format      string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// Process checks the upload's real content type, decodes it and returns
+// every size in the source's web format (JPEG, or PNG for images that may
+// carry transparency) and in WebP.
+func Process(data []byte) ([]Variant, error) {
+	contentType := http.DetectContentType(data)
+	if !allowedTypes[contentType] {
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("image is too large")
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+	if contentType == "image/jpeg" {
+		src = applyOrientation(src, jpegOrientation(data))
+	}
+
+	lossless := contentType == "image/png" || contentType == "image/gif"
+
+	variants := []Variant{}
+	for _, size := range Sizes {
+		img := resize(src, size.MaxDim)
+		bounds := img.Bounds()
+
+		var buf bytes.Buffer
+		format, mime := "jpg", "image/jpeg"
+		if lossless {
+			format, mime = "png", "image/png"
+			err = png.Encode(&buf, img)
+		} else {
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		}
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, Variant{size.Name, format, mime, bounds.Dx(), bounds.Dy(), buf.Bytes()})
+
+		var webp bytes.Buffer
+		if err := nativewebp.Encode(&webp, img, nil); err != nil {
+			return nil, err
+		}
+		variants = append(variants, Variant{size.Name, "webp", "image/webp", bounds.Dx(), bounds.Dy(), webp.Bytes()})
+	}
+	return variants, nil
+}
+
+// resize scales img down so its longest side is at most maxDim. Smaller
+// images are copied at their original size.
+func resize(img image.Image, maxDim int) *image.NRGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxDim || h > maxDim {
+		if w >= h {
+			w, h = maxDim, max(1, h*maxDim/w)
+		} else {
+			w, h = max(1, w*maxDim/h), maxDim
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,225 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// testImage is a w by h image, red in its top-left pixel and blue
+// elsewhere
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{B: 255, A: 255})
+		}
+	}
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeGIF(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// exifTIFF is a TIFF header holding only an orientation tag
+func exifTIFF(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+	return tiff
+}
+
+// withExif inserts an EXIF segment with the orientation after the JPEG's
+// start marker
+func withExif(data []byte, orientation uint16) []byte {
+	payload := append([]byte("Exif\x00\x00"), exifTIFF(binary.BigEndian, orientation)...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+len(payload)))
+	segment = append(segment, payload...)
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+		sizes  map[string][2]int
+	}{
+		{"wide JPEG", encodeJPEG(t, testImage(2000, 1000)), "jpg",
+			map[string][2]int{"thumbnail": {150, 75}, "medium": {600, 300}, "large": {1200, 600}}},
+		{"tall PNG", encodePNG(t, testImage(300, 900)), "png",
+			map[string][2]int{"thumbnail": {50, 150}, "medium": {200, 600}, "large": {300, 900}}},
+		{"small GIF", encodeGIF(t, testImage(100, 40)), "png",
+			map[string][2]int{"thumbnail": {100, 40}, "medium": {100, 40}, "large": {100, 40}}},
+		{"rotated JPEG", withExif(encodeJPEG(t, testImage(400, 200)), 6), "jpg",
+			map[string][2]int{"thumbnail": {75, 150}, "medium": {200, 400}, "large": {200, 400}}},
+	}
+	for _, tt := range tests {
+		variants, err := Process(tt.data)
+		if err != nil {
+			t.Errorf("%s: Process = %v", tt.name, err)
+			continue
+		}
+		if len(variants) != 2*len(Sizes) {
+			t.Errorf("%s: %d variants, want %d", tt.name, len(variants), 2*len(Sizes))
+		}
+		for _, v := range variants {
+			if v.Format != tt.format && v.Format != "webp" {
+				t.Errorf("%s: %s variant in %s, want %s or webp", tt.name, v.Size, v.Format, tt.format)
+			}
+			// Every variant decodes, WebP included, to the size it reports
+			img, format, err := image.Decode(bytes.NewReader(v.Data))
+			if err != nil {
+				t.Errorf("%s: %s %s doesn't decode: %v", tt.name, v.Size, v.Format, err)
+				continue
+			}
+			want := tt.sizes[v.Size]
+			got := [2]int{img.Bounds().Dx(), img.Bounds().Dy()}
+			if got != want || v.Width != want[0] || v.Height != want[1] {
+				t.Errorf("%s: %s %s is %v and says %dx%d, want %v", tt.name, v.Size, v.Format, got, v.Width, v.Height, want)
+			}
+			if wantFormat := map[string]string{"jpg": "jpeg", "png": "png", "webp": "webp"}[v.Format]; format != wantFormat {
+				t.Errorf("%s: %s %s decodes as %s", tt.name, v.Size, v.Format, format)
+			}
+		}
+	}
+}
+
+func TestProcessDropsExif(t *testing.T) {
+	variants, err := Process(withExif(encodeJPEG(t, testImage(40, 20)), 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range variants {
+		if bytes.Contains(v.Data, []byte("Exif\x00\x00")) {
+			t.Errorf("%s %s still carries EXIF", v.Size, v.Format)
+		}
+	}
+}
+
+// withSize rewrites the dimensions in a PNG's header chunk
+func withSize(data []byte, w, h uint32) []byte {
+	out := append([]byte{}, data...)
+	ihdr := out[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	binary.BigEndian.PutUint32(out[8+8+13:], crc32.ChecksumIEEE(out[8+4:8+8+13]))
+	return out
+}
+
+func TestProcessRejects(t *testing.T) {
+	png := encodePNG(t, testImage(10, 10))
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"text", []byte("<svg xmlns='http://www.w3.org/2000/svg'></svg>"), ErrUnsupportedType.Error()},
+		{"empty", nil, ErrUnsupportedType.Error()},
+		{"truncated PNG", png[:30], "invalid image"},
+		{"decompression bomb", withSize(png, 10000, 10000), "too large"},
+	}
+	for _, tt := range tests {
+		if _, err := Process(tt.data); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Process = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	plain := encodeJPEG(t, testImage(4, 2))
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no EXIF", plain, 1},
+		{"rotated", withExif(plain, 6), 6},
+		{"mirrored", withExif(plain, 2), 2},
+		{"out of range", withExif(plain, 9), 1},
+		{"not a JPEG", []byte("GIF89a"), 1},
+		{"truncated segment", withExif(plain, 6)[:10], 1},
+	}
+	for _, tt := range tests {
+		if got := jpegOrientation(tt.data); got != tt.want {
+			t.Errorf("%s: jpegOrientation = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		if got := tiffOrientation(exifTIFF(order, 8)); got != 8 {
+			t.Errorf("%v tiffOrientation = %d, want 8", order, got)
+		}
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// Where the top-left red pixel of a 3x2 image ends up
+	tests := []struct {
+		orientation int
+		size        [2]int
+		red         image.Point
+	}{
+		{1, [2]int{3, 2}, image.Pt(0, 0)},
+		{2, [2]int{3, 2}, image.Pt(2, 0)},
+		{3, [2]int{3, 2}, image.Pt(2, 1)},
+		{4, [2]int{3, 2}, image.Pt(0, 1)},
+		{5, [2]int{2, 3}, image.Pt(0, 0)},
+		{6, [2]int{2, 3}, image.Pt(1, 0)},
+		{7, [2]int{2, 3}, image.Pt(1, 2)},
+		{8, [2]int{2, 3}, image.Pt(0, 2)},
+	}
+	for _, tt := range tests {
+		img := applyOrientation(testImage(3, 2), tt.orientation)
+		if size := [2]int{img.Bounds().Dx(), img.Bounds().Dy()}; size != tt.size {
+			t.Errorf("orientation %d: size %v, want %v", tt.orientation, size, tt.size)
+			continue
+		}
+		if r, _, _, _ := img.At(tt.red.X, tt.red.Y).RGBA(); r != 0xFFFF {
+			t.Errorf("orientation %d: red pixel isn't at %v", tt.orientation, tt.red)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"go_backend/clock"
+	"go_backend/repository"
+	"go_backend/storage"
+)
+
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashPurger permanently removes foods, users and orders that have been
+// in the trash for longer than Retention.
+type TrashPurger struct {
+	Clock     clock.Clock
+	Repos     repository.Repositories
+	Retention time.Duration
+	// Storage holds the purged foods' uploaded images.
+	Storage storage.Storage
+}
+
+// NewTrashPurger reads the retention in days from TRASH_RETENTION_DAYS,
+// defaulting to 30.
+func NewTrashPurger(c clock.Clock, repos repository.Repositories, s storage.Storage) *TrashPurger {
+	retention := defaultTrashRetention
+	if raw := os.Getenv("TRASH_RETENTION_DAYS"); raw != "" {
+		if days, err := strconv.Atoi(raw); err == nil && days >= 0 {
+			retention = time.Duration(days) * 24 * time.Hour
+		} else {
+			log.Printf("Ignoring invalid TRASH_RETENTION_DAYS %q", raw)
+		}
+	}
+	return &TrashPurger{Clock: c, Repos: repos, Retention: retention, Storage: s}
+}
+
+// Run purges everything deleted before the retention cutoff.
+func (p *TrashPurger) Run(ctx context.Context) error {
+	cutoff := p.Clock.Now().Add(-p.Retention)
+	if err := p.purgeFoods(ctx, cutoff); err != nil {
+		return err
+	}
+	if err := p.purgeUsers(ctx, cutoff); err != nil {
+		return err
+	}
+
+	purged, err := p.Repos.Orders.Purge(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Printf("Purged %d deleted orders", purged)
+	}
+	return nil
+}
+
+// purgeFoods removes foods along with their images and favorites
+func (p *TrashPurger) purgeFoods(ctx context.Context, cutoff time.Time) error {
+	purged, err := p.Repos.Foods.Purge(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, len(purged))
+	for i, food := range purged {
+		ids[i] = food.ID.Hex()
+	}
+	if err := p.Repos.Favorites.RemoveFoods(ctx, ids); err != nil {
+		return err
+	}
+	for _, food := range purged {
+		for _, image := range food.Images {
+			for _, variant := range image.Variants {
+				if err := p.Storage.Delete(ctx, variant.Key); err != nil {
+					log.Printf("Failed to delete image %s: %v", variant.Key, err)
+				}
+			}
+		}
+	}
+	if len(purged) > 0 {
+		log.Printf("Purged %d deleted foods", len(purged))
+	}
+	return nil
+}
+
+// purgeUsers removes users and their favorites. Their orders and reviews
+// are kept.
+func (p *TrashPurger) purgeUsers(ctx context.Context, cutoff time.Time) error {
+	ids, err := p.Repos.Users.Purge(ctx, cutoff)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	if err := p.Repos.Favorites.RemoveUsers(ctx, ids); err != nil {
+		return err
+	}
+	log.Printf("Purged %d deleted users", len(ids))
+	return nil
+}
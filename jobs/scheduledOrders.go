@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"go_backend/clock"
+	"go_backend/repository"
+)
+
+const defaultReleaseLeadTime = 30 * time.Minute
+
+// OrderReleaser releases scheduled orders to the kitchen LeadTime before
+// their fulfillment slot.
+type OrderReleaser struct {
+	Clock    clock.Clock
+	Orders   repository.Orders
+	LeadTime time.Duration
+}
+
+// NewOrderReleaser reads the lead time in minutes from
+// ORDER_RELEASE_LEAD_MINUTES, defaulting to 30.
+func NewOrderReleaser(c clock.Clock, orders repository.Orders) *OrderReleaser {
+	lead := defaultReleaseLeadTime
+	if raw := os.Getenv("ORDER_RELEASE_LEAD_MINUTES"); raw != "" {
+		if minutes, err := strconv.Atoi(raw); err == nil && minutes >= 0 {
+			lead = time.Duration(minutes) * time.Minute
+		} else {
+			log.Printf("Ignoring invalid ORDER_RELEASE_LEAD_MINUTES %q", raw)
+		}
+	}
+	return &OrderReleaser{Clock: c, Orders: orders, LeadTime: lead}
+}
+
+// Run releases every scheduled order whose slot starts within the lead time.
+func (r *OrderReleaser) Run(ctx context.Context) error {
+	now := r.Clock.Now()
+	released, err := r.Orders.ReleaseDue(ctx, now.Add(r.LeadTime), now)
+	if err != nil {
+		return err
+	}
+	if released > 0 {
+		log.Printf("Released %d scheduled orders to the kitchen", released)
+	}
+	return nil
+}
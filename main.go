@@ -1,29 +1,138 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata"
 
+	"go_backend/controllers"
 	"go_backend/data"
+	"go_backend/events"
+	"go_backend/jobs"
+	"go_backend/middleware"
+	"go_backend/migrations"
+	"go_backend/notifications"
+	"go_backend/pricing"
+	"go_backend/repository"
 	"go_backend/routes"
+	"go_backend/storage"
+	"go_backend/webhooks"
 
 	"github.com/rs/cors"
 )
 
 func main() {
-	data.InitMongo()
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
+	if err := middleware.CheckSecret(); err != nil {
+		log.Fatal("Auth configuration error:", err)
+	}
+
+	// Everything is stored in Mongo unless DB_DRIVER picks a SQL database
+	backend, err := repository.FromEnv()
+	if err != nil {
+		log.Fatal("Database configuration error:", err)
+	}
+	if repository.UsesMongo() {
+		data.InitMongo()
+
+		// Apply pending migrations unless they are run separately with
+		// the migrate command
+		if os.Getenv("MIGRATE_ON_START") != "false" {
+			if _, err := migrations.Up(context.Background(), data.GetMongoClient().Database("foodstoreDB")); err != nil {
+				log.Fatal("Migration failed:", err)
+			}
+		}
+		if err := data.EnsureIndexes(context.Background(), data.GetMongoClient().Database("foodstoreDB")); err != nil {
+			log.Println("Failed to reconcile indexes:", err)
+		}
+	}
+	controllers.Repos = backend
+	controllers.Transactions = backend.Transactions
+	middleware.Users = backend.Users
+	middleware.Stores = backend.Stores
+
 	router := routes.SetupRouter()
 
+	uploads, err := storage.FromEnv()
+	if err != nil {
+		log.Fatal("Storage configuration error:", err)
+	}
+	controllers.Storage = uploads
+	if local, ok := uploads.(*storage.Local); ok && strings.HasPrefix(local.BaseURL, "/") {
+		router.Static(local.BaseURL, local.Dir)
+	}
+
+	// Release scheduled orders to the kitchen ahead of their slot
+	jobs.Every(context.Background(), "release-scheduled-orders", time.Minute, jobs.NewOrderReleaser(controllers.Clock, backend.Orders).Run)
+
+	// Start scheduled prices and end promotions
+	jobs.Every(context.Background(), "apply-price-schedules", time.Minute, (&pricing.Scheduler{Clock: controllers.Clock, Foods: backend.Foods, Prices: backend.Prices}).Run)
+
+	// Deliver outbox events to subscribers and sinks
+	bus := events.NewBus()
+	if os.Getenv("EVENT_LOG") == "true" {
+		bus.AddSink(events.LogSink{})
+	}
+	bus.AddSink(webhooks.Sink{Webhooks: backend.Webhooks})
+
+	// Email customers about their registration and orders
+	mailSender, err := notifications.SenderFromEnv()
+	if err != nil {
+		log.Fatal("Mail configuration error:", err)
+	}
+	templates, err := notifications.LoadTemplates()
+	if err != nil {
+		log.Fatal("Failed to load email templates:", err)
+	}
+	mailQueue := notifications.NewQueue(mailSender)
+	mailQueue.Start(context.Background(), 2)
+	mailer := &notifications.Mailer{Templates: templates, Queue: mailQueue}
+	controllers.Mailer = mailer
+	(&notifications.Notifier{Mailer: mailer, Users: backend.Users, Orders: backend.Orders}).Subscribe(bus)
+
+	dispatcher := &events.Dispatcher{Outbox: backend.Outbox, Bus: bus, Clock: controllers.Clock}
+	jobs.Every(context.Background(), "dispatch-events", 2*time.Second, dispatcher.Run)
+	jobs.Every(context.Background(), "prune-events", time.Hour, dispatcher.Prune)
+
+	// Send queued webhook deliveries
+	jobs.Every(context.Background(), "send-webhooks", 5*time.Second, webhooks.NewSender(controllers.Clock, backend.Webhooks).Run)
+
+	// Purge foods, users and orders that have been in the trash too long
+	jobs.Every(context.Background(), "purge-trash", time.Hour, jobs.NewTrashPurger(controllers.Clock, backend, uploads).Run)
+
 	// Add user routes
 	routes.UserRoutes(router)
 
 	// Add food routes
 	routes.SetupFoodsRouter(router)
 
+	// Add category and menu routes
+	routes.SetupCategoriesRouter(router)
+
+	// Add review routes
+	routes.SetupReviewsRouter(router)
+
+	// Add inventory routes
+	routes.SetupInventoryRouter(router)
+
+	// Add store routes
+	routes.SetupStoreRouter(router)
+
+	// Add webhook routes
+	routes.SetupWebhooksRouter(router)
+
 	corsMiddleware := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000", "http://localhost:3001"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization", "Accept", "X-Requested-With", "Origin"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "Accept", "X-Requested-With", "Origin", "If-Match"},
+		ExposedHeaders:   []string{"ETag"},
 		AllowCredentials: true,
 	})
 
@@ -0,0 +1,226 @@
+package menu
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"go_backend/models"
+)
+
+// csvColumns maps CSV headers to the food document fields they set. Lists
+// are separated by "|".
+var csvColumns = []struct {
+	header string
+	field  string
+}{
+	{"name", "name"},
+	{"sku", "sku"},
+	{"price", "price"},
+	{"tags", "tags"},
+	{"origins", "origins"},
+	{"cookTime", "cookTime"},
+	{"imageUrl", "imageUrl"},
+	{"trackStock", "trackStock"},
+	{"stock", "stock"},
+	{"allergens", "allergens"},
+	{"dietLabels", "dietLabels"},
+}
+
+// jsonFields are the document fields a JSON import sets. Ratings, images
+// and sold-out state are left alone.
+var jsonFields = []string{
+	"name", "sku", "price", "tags", "imageUrl", "origins", "cookTime",
+	"variants", "modifierGroups", "availabilityWindows",
+	"nutrition", "allergens", "dietLabels",
+	"trackStock", "stock", "lowStockThreshold", "ingredients",
+}
+
+// Read parses an import file in the given format. Rows that can't be
+// parsed are reported as errors alongside the rows that could.
+func Read(format string, r io.Reader) ([]Row, []RowError, error) {
+	switch format {
+	case FormatCSV:
+		return ReadCSV(r)
+	case FormatJSON:
+		return ReadJSON(r)
+	}
+	return nil, nil, fmt.Errorf("unknown format %q", format)
+}
+
+// ReadCSV parses a CSV file with a header line. Only the columns present
+// are updated on existing foods.
+func ReadCSV(r io.Reader) ([]Row, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	if _, ok := index["name"]; !ok {
+		return nil, nil, fmt.Errorf("the CSV header has no name column")
+	}
+
+	var fields []string
+	for _, column := range csvColumns {
+		if _, ok := index[column.header]; ok {
+			fields = append(fields, column.field)
+		}
+	}
+
+	rows := []Row{}
+	errs := []RowError{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, nil, err
+			}
+			errs = append(errs, RowError{Line: line, Message: err.Error()})
+			continue
+		}
+
+		value := func(header string) (string, bool) {
+			i, ok := index[header]
+			if !ok || i >= len(record) {
+				return "", false
+			}
+			return strings.TrimSpace(record[i]), true
+		}
+
+		row := Row{Line: line, Fields: fields}
+		food := &row.Food
+		food.Name, _ = value("name")
+		food.SKU, _ = value("sku")
+		food.CookTime, _ = value("cookTime")
+		food.ImageUrl, _ = value("imageUrl")
+		if v, ok := value("tags"); ok {
+			food.Tags = splitList(v)
+		}
+		if v, ok := value("origins"); ok {
+			food.Origins = splitList(v)
+		}
+		if v, ok := value("allergens"); ok {
+			food.Allergens = splitList(v)
+		}
+		if v, ok := value("dietLabels"); ok {
+			food.DietLabels = splitList(v)
+		}
+
+		bad := false
+		if v, ok := value("price"); ok {
+			if food.Price, err = strconv.ParseFloat(v, 64); err != nil {
+				errs = append(errs, RowError{Line: line, Field: "price", Message: "must be a number"})
+				bad = true
+			}
+		}
+		if v, ok := value("trackStock"); ok && v != "" {
+			if food.TrackStock, err = strconv.ParseBool(v); err != nil {
+				errs = append(errs, RowError{Line: line, Field: "trackStock", Message: "must be true or false"})
+				bad = true
+			}
+		}
+		if v, ok := value("stock"); ok && v != "" {
+			if food.Stock, err = strconv.Atoi(v); err != nil || food.Stock < 0 {
+				errs = append(errs, RowError{Line: line, Field: "stock", Message: "must be a whole number of at least 0"})
+				bad = true
+			}
+		}
+		if !bad {
+			rows = append(rows, row)
+		}
+	}
+	return rows, errs, nil
+}
+
+// ReadJSON parses a JSON array of foods in the same shape the API returns.
+func ReadJSON(r io.Reader) ([]Row, []RowError, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, nil, fmt.Errorf("expected a JSON array of foods: %w", err)
+	}
+
+	rows := []Row{}
+	errs := []RowError{}
+	for i, item := range raw {
+		row := Row{Line: i + 1, Fields: jsonFields}
+		if err := json.Unmarshal(item, &row.Food); err != nil {
+			errs = append(errs, RowError{Line: row.Line, Message: err.Error()})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, errs, nil
+}
+
+// Write encodes foods in the given format.
+func Write(format string, w io.Writer, foods []models.Food) error {
+	switch format {
+	case FormatCSV:
+		return WriteCSV(w, foods)
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(foods)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// WriteCSV writes the CSV columns of each food. Variants, modifiers and
+// other nested options are only exported as JSON.
+func WriteCSV(w io.Writer, foods []models.Food) error {
+	writer := csv.NewWriter(w)
+
+	header := make([]string, len(csvColumns))
+	for i, column := range csvColumns {
+		header[i] = column.header
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, food := range foods {
+		record := []string{
+			food.Name,
+			food.SKU,
+			strconv.FormatFloat(food.Price, 'f', -1, 64),
+			strings.Join(food.Tags, "|"),
+			strings.Join(food.Origins, "|"),
+			food.CookTime,
+			food.ImageUrl,
+			strconv.FormatBool(food.TrackStock),
+			strconv.Itoa(food.Stock),
+			strings.Join(food.Allergens, "|"),
+			strings.Join(food.DietLabels, "|"),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, "|") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,147 @@
+package menu
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go_backend/models"
+)
+
+func TestReadCSV(t *testing.T) {
+	input := strings.Join([]string{
+		"name, price, tags, stock",
+		"Pizza, 9.5, italian| cheese ,3",
+		"Pasta, cheap, italian, 1",
+		"Salad, 4, , -2",
+		"Soup, 5",
+		`"Curry, hot", 12, spicy|, `,
+	}, "\n")
+
+	rows, errs, err := ReadCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFields := []string{"name", "price", "tags", "stock"}
+	want := []Row{
+		{Line: 2, Food: models.Food{Name: "Pizza", Price: 9.5, Tags: []string{"italian", "cheese"}, Stock: 3}, Fields: wantFields},
+		{Line: 6, Food: models.Food{Name: "Curry, hot", Price: 12, Tags: []string{"spicy"}}, Fields: wantFields},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %+v\nwant %+v", rows, want)
+	}
+
+	wantErrs := []struct {
+		line  int
+		field string
+	}{{3, "price"}, {4, "stock"}, {5, ""}}
+	if len(errs) != len(wantErrs) {
+		t.Fatalf("errors = %v, want %d", errs, len(wantErrs))
+	}
+	for i, e := range wantErrs {
+		if errs[i].Line != e.line || errs[i].Field != e.field {
+			t.Errorf("error %d = %+v, want line %d field %q", i, errs[i], e.line, e.field)
+		}
+	}
+}
+
+func TestReadCSVNeedsAHeaderWithName(t *testing.T) {
+	for name, input := range map[string]string{
+		"empty":   "",
+		"no name": "sku,price\nP1,3\n",
+	} {
+		if _, _, err := ReadCSV(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: ReadCSV succeeded", name)
+		}
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	input := `[{"name":"Pizza","price":9.5,"variants":[{"name":"Large","price":14}]},{"name":"Pasta","price":"cheap"},{"name":"Salad","price":4}]`
+	rows, errs, err := ReadJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Line != 1 || rows[1].Line != 3 || rows[1].Food.Name != "Salad" {
+		t.Errorf("rows = %+v, want Pizza on 1 and Salad on 3", rows)
+	}
+	if len(rows) > 0 && (len(rows[0].Food.Variants) != 1 || !reflect.DeepEqual(rows[0].Fields, jsonFields)) {
+		t.Errorf("Pizza = %+v, want its variant and every JSON field", rows[0])
+	}
+	if len(errs) != 1 || errs[0].Line != 2 {
+		t.Errorf("errors = %+v, want one on line 2", errs)
+	}
+
+	if _, _, err := ReadJSON(strings.NewReader(`{"name":"Pizza"}`)); err == nil {
+		t.Error("ReadJSON of an object succeeded")
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	foods := []models.Food{
+		{Name: "Pizza", SKU: "P1", Price: 9.5, Tags: []string{"italian", "cheese"}, Origins: []string{"italy"},
+			CookTime: "15 min", ImageUrl: "https://example.com/pizza.jpg", TrackStock: true, Stock: 3,
+			Allergens: []string{"gluten", "milk"}, DietLabels: []string{"vegetarian"}},
+		{Name: "Water, still", Price: 1, Tags: []string{}, Origins: []string{}, Allergens: []string{}, DietLabels: []string{}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(FormatCSV, &buf, foods); err != nil {
+		t.Fatal(err)
+	}
+	rows, errs, err := Read(FormatCSV, &buf)
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("Read = %v, %v", errs, err)
+	}
+	for i, row := range rows {
+		if !reflect.DeepEqual(row.Food, foods[i]) {
+			t.Errorf("row %d = %+v\nwant %+v", i, row.Food, foods[i])
+		}
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, _, err := Read("xml", strings.NewReader("")); err == nil {
+		t.Error("Read of xml succeeded")
+	}
+	if err := Write("xml", &bytes.Buffer{}, nil); err == nil {
+		t.Error("Write of xml succeeded")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	food := func(name, sku string, price float64) Row {
+		return Row{Food: models.Food{Name: name, SKU: sku, Price: price}}
+	}
+	tests := []struct {
+		name string
+		mode string
+		rows []Row
+		want []RowError
+	}{
+		{"valid", ModeInsert, []Row{food("Pizza", "", 9), food("Pasta", "", 8)}, nil},
+		{"unknown mode", "replace", []Row{food("Pizza", "", 9)}, []RowError{{}}},
+		{"no rows", ModeInsert, nil, []RowError{{}}},
+		{"invalid food", ModeInsert, []Row{food("", "", 9), food("Pasta", "", -1)}, []RowError{{Line: 1}, {Line: 2}}},
+		{"duplicate name", ModeUpsertName, []Row{food("Pizza", "", 9), food("Pizza", "", 8)}, []RowError{{Line: 2, Field: "name"}}},
+		{"duplicate SKU", ModeUpsertSKU, []Row{food("Pizza", "P1", 9), food("Pasta", "P1", 8)}, []RowError{{Line: 2, Field: "sku"}}},
+		{"missing SKU", ModeUpsertSKU, []Row{food("Pizza", "P1", 9), food("Pasta", "", 8)}, []RowError{{Line: 2, Field: "sku"}}},
+	}
+	for _, tt := range tests {
+		for i := range tt.rows {
+			tt.rows[i].Line = i + 1
+		}
+		got := Validate(tt.rows, tt.mode)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: Validate = %+v, want %d errors", tt.name, got, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if got[i].Line != want.Line || got[i].Field != want.Field || got[i].Message == "" {
+				t.Errorf("%s: error %d = %+v, want line %d field %q", tt.name, i, got[i], want.Line, want.Field)
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package menu imports and exports a store's foods as CSV or JSON. It is
+// shared by the admin endpoints and the command line.
+package menu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go_backend/models"
+	"go_backend/pricing"
+	"go_backend/repository"
+	"go_backend/uow"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Import modes decide what happens to a row that matches an existing food.
+const (
+	ModeInsert     = "insert"
+	ModeUpsertName = "upsert-name"
+	ModeUpsertSKU  = "upsert-sku"
+)
+
+// Row is one food read from an import file. Line is the CSV line or the
+// 1-based position in a JSON array.
+type Row struct {
+	Line int
+	Food models.Food
+	// Fields are the document fields the row sets when it updates an
+	// existing food.
+	Fields []string
+}
+
+// RowError reports a problem with one row.
+type RowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e RowError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+type Options struct {
+	StoreID string
+	Mode    string
+	DryRun  bool
+	// UserID is recorded as the author of imported price changes.
+	UserID string
+}
+
+// Result summarises an import. With errors nothing is written.
+type Result struct {
+	Created int        `json:"created"`
+	Updated int        `json:"updated"`
+	DryRun  bool       `json:"dryRun"`
+	Errors  []RowError `json:"errors"`
+}
+
+var errAborted = errors.New("import has row errors")
+
+// Import validates every row and then writes them all in one unit of
+// work. readErrs are the rows Read could not parse. If any row is invalid,
+// or with DryRun, nothing is written and the result shows what would have
+// happened.
+func Import(ctx context.Context, repos repository.Repositories, rows []Row, readErrs []RowError, opts Options) (Result, error) {
+	result := Result{DryRun: opts.DryRun, Errors: append(readErrs, Validate(rows, opts.Mode)...)}
+	if len(result.Errors) > 0 {
+		return result, nil
+	}
+
+	// Rows clashing with existing foods are found before anything is
+	// written, so they can't leave the rows before them behind
+	if err := apply(ctx, repos, rows, opts, &result, false); err != nil || opts.DryRun {
+		return result, err
+	}
+	if len(result.Errors) > 0 {
+		result.Created, result.Updated = 0, 0
+		return result, nil
+	}
+
+	err := repos.Transactions.Do(ctx, func(ctx context.Context) error {
+		result.Created, result.Updated, result.Errors = 0, 0, []RowError{}
+		if err := apply(ctx, repos, rows, opts, &result, true); err != nil {
+			return err
+		}
+		if len(result.Errors) > 0 {
+			return errAborted
+		}
+		return nil
+	})
+	if errors.Is(err, errAborted) {
+		result.Created, result.Updated = 0, 0
+		err = nil
+	}
+	return result, err
+}
+
+// Validate checks each row on its own and against the other rows.
+func Validate(rows []Row, mode string) []RowError {
+	errs := []RowError{}
+	if mode != ModeInsert && mode != ModeUpsertName && mode != ModeUpsertSKU {
+		return append(errs, RowError{Message: fmt.Sprintf("unknown mode %q", mode)})
+	}
+	if len(rows) == 0 {
+		return append(errs, RowError{Message: "the file has no foods"})
+	}
+
+	names := map[string]int{}
+	skus := map[string]int{}
+	for i := range rows {
+		row := &rows[i]
+		if err := row.Food.Validate(); err != nil {
+			errs = append(errs, RowError{Line: row.Line, Message: err.Error()})
+		}
+		if mode == ModeUpsertSKU && row.Food.SKU == "" {
+			errs = append(errs, RowError{Line: row.Line, Field: "sku", Message: "is required in upsert-sku mode"})
+		}
+		if first, ok := names[row.Food.Name]; ok && row.Food.Name != "" {
+			errs = append(errs, RowError{Line: row.Line, Field: "name", Message: fmt.Sprintf("duplicates line %d", first)})
+		} else {
+			names[row.Food.Name] = row.Line
+		}
+		if first, ok := skus[row.Food.SKU]; ok && row.Food.SKU != "" {
+			errs = append(errs, RowError{Line: row.Line, Field: "sku", Message: fmt.Sprintf("duplicates line %d", first)})
+		} else {
+			skus[row.Food.SKU] = row.Line
+		}
+	}
+	return errs
+}
+
+// apply inserts or updates each row, or only counts what it would do when
+// write is false. Rows that clash with existing foods are reported as
+// errors.
+func apply(ctx context.Context, repos repository.Repositories, rows []Row, opts Options, result *Result, write bool) error {
+	foods := repos.Foods
+	now := time.Now()
+	for _, row := range rows {
+		food := row.Food
+
+		var existing models.Food
+		var err error
+		if opts.Mode == ModeUpsertSKU {
+			existing, err = foods.BySKU(ctx, opts.StoreID, food.SKU)
+		} else {
+			existing, err = foods.ByName(ctx, opts.StoreID, food.Name)
+		}
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			result.Created++
+			if !write {
+				continue
+			}
+			food.ID = primitive.NewObjectID()
+			food.StoreID = opts.StoreID
+			food.CreatedAt = now
+			food.UpdatedAt = now
+			food.Version = 1
+			if err := foods.Create(ctx, &food); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case opts.Mode == ModeInsert:
+			result.Errors = append(result.Errors, RowError{Line: row.Line, Field: "name", Message: "a food with this name already exists"})
+		default:
+			result.Updated++
+			if !write {
+				continue
+			}
+			fields := row.Fields
+			priceChanged := hasField(fields, "price") && food.Price != existing.Price
+			if priceChanged {
+				// Like a manual edit, an imported price ends any promotion
+				food.Promotion = nil
+				fields = append(fields[:len(fields):len(fields)], "promotion")
+			}
+			food.ID = existing.ID
+			food.StoreID = existing.StoreID
+			food.Version = existing.Version
+			if err := foods.Update(ctx, &food, fields...); err != nil {
+				return err
+			}
+			undoUpdate(ctx, foods, existing, food.Version, fields)
+			if priceChanged {
+				if err := pricing.Record(ctx, repos.Prices, existing, food.Price, opts.UserID, "imported"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// undoUpdate puts back the fields of existing, now at version, if the unit
+// of work running ctx fails without a transaction to discard the update
+func undoUpdate(ctx context.Context, foods repository.Foods, existing models.Food, version int, fields []string) {
+	uow.OnRollback(ctx, func() {
+		existing.Version = version
+		if err := foods.Update(context.Background(), &existing, fields...); err != nil {
+			log.Printf("Failed to undo the import of %s: %v", existing.Name, err)
+		}
+	})
+}
+
+func hasField(fields []string, name string) bool {
+	for _, field := range fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Export returns every food of a store.
+func Export(ctx context.Context, foods repository.Foods, storeID string) ([]models.Food, error) {
+	return foods.Find(ctx, models.FoodQuery{StoreID: storeID})
+}
@@ -0,0 +1,103 @@
+package menu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go_backend/models"
+	"go_backend/repository"
+	"go_backend/uow"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// failingFoods fails updates to the food named fail.
+type failingFoods struct {
+	repository.Foods
+	fail string
+}
+
+func (f failingFoods) Update(ctx context.Context, food *models.Food, fields ...string) error {
+	if food.Name == f.fail {
+		return errors.New("update failed")
+	}
+	return f.Foods.Update(ctx, food, fields...)
+}
+
+func openTestRepositories(t *testing.T) repository.Repositories {
+	t.Helper()
+	repos, err := repository.OpenSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	repos.Transactions = &uow.Memory{}
+	return repos
+}
+
+func addFood(t *testing.T, repos repository.Repositories, name string, price float64) models.Food {
+	t.Helper()
+	now := time.Now()
+	food := models.Food{ID: primitive.NewObjectID(), StoreID: models.DefaultStoreID, Name: name, Price: price, Version: 1, CreatedAt: now, UpdatedAt: now}
+	if err := repos.Foods.Create(context.Background(), &food); err != nil {
+		t.Fatalf("Create(%s): %v", name, err)
+	}
+	return food
+}
+
+func row(line int, name string, price float64) Row {
+	return Row{Line: line, Food: models.Food{Name: name, Price: price}, Fields: []string{"name", "price"}}
+}
+
+func TestImportReportsClashesBeforeWriting(t *testing.T) {
+	repos := openTestRepositories(t)
+	addFood(t, repos, "Soup", 5)
+
+	rows := []Row{row(2, "Salad", 7), row(3, "Soup", 6)}
+	result, err := Import(context.Background(), repos, rows, nil, Options{StoreID: models.DefaultStoreID, Mode: ModeInsert})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Line != 3 {
+		t.Fatalf("Errors = %+v, want one error on line 3", result.Errors)
+	}
+	if result.Created != 0 || result.Updated != 0 {
+		t.Errorf("Created, Updated = %d, %d, want 0, 0", result.Created, result.Updated)
+	}
+	if _, err := repos.Foods.ByName(context.Background(), models.DefaultStoreID, "Salad"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("ByName(Salad) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestImportUndoesWritesWithoutTransaction(t *testing.T) {
+	repos := openTestRepositories(t)
+	soup := addFood(t, repos, "Soup", 5)
+	addFood(t, repos, "Stew", 9)
+	repos.Foods = failingFoods{Foods: repos.Foods, fail: "Stew"}
+
+	rows := []Row{row(2, "Salad", 7), row(3, "Soup", 6), row(4, "Stew", 10)}
+	_, err := Import(context.Background(), repos, rows, nil, Options{StoreID: models.DefaultStoreID, Mode: ModeUpsertName})
+	if err == nil {
+		t.Fatal("Import succeeded, want the update error")
+	}
+
+	ctx := context.Background()
+	if _, err := repos.Foods.ByName(ctx, models.DefaultStoreID, "Salad"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("ByName(Salad) error = %v, want ErrNotFound", err)
+	}
+	got, err := repos.Foods.ByName(ctx, models.DefaultStoreID, "Soup")
+	if err != nil {
+		t.Fatalf("ByName(Soup): %v", err)
+	}
+	if got.Price != 5 {
+		t.Errorf("Soup price = %v, want 5", got.Price)
+	}
+	history, err := repos.Prices.History(ctx, soup.ID.Hex())
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("History = %+v, want none", history)
+	}
+}
@@ -0,0 +1,61 @@
+// Package mergepatch applies JSON Merge Patches (RFC 7396).
+package mergepatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Apply merges patch into doc and returns the patched document. Keys in
+// the patch match document keys case-insensitively, the way encoding/json
+// matches struct fields, so "price" patches "Price".
+func Apply(doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	if _, ok := p.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("merge patch must be a JSON object")
+	}
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for key, value := range p {
+		existing := matchKey(t, key)
+		if value == nil {
+			delete(t, existing)
+			continue
+		}
+		t[existing] = merge(t[existing], value)
+	}
+	return t
+}
+
+// matchKey returns the key of m that key refers to, or key itself when m
+// has no such key.
+func matchKey(m map[string]interface{}, key string) string {
+	if _, ok := m[key]; ok {
+		return key
+	}
+	for existing := range m {
+		if strings.EqualFold(existing, key) {
+			return existing
+		}
+	}
+	return key
+}
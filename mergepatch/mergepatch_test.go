@@ -0,0 +1,59 @@
+package mergepatch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+	}{
+		{"replaces a value", `{"name":"Pizza","price":10}`, `{"price":12}`, `{"name":"Pizza","price":12}`},
+		{"adds a key", `{"name":"Pizza"}`, `{"sku":"P1"}`, `{"name":"Pizza","sku":"P1"}`},
+		{"null deletes a key", `{"name":"Pizza","promotion":{"price":8}}`, `{"promotion":null}`, `{"name":"Pizza"}`},
+		{"null for a missing key", `{"name":"Pizza"}`, `{"sku":null}`, `{"name":"Pizza"}`},
+		{"merges nested objects", `{"nutrition":{"calories":800,"protein":30}}`, `{"nutrition":{"protein":35,"fat":null}}`, `{"nutrition":{"calories":800,"protein":35}}`},
+		{"deletes nested keys", `{"nutrition":{"calories":800,"protein":30}}`, `{"nutrition":{"protein":null}}`, `{"nutrition":{"calories":800}}`},
+		{"replaces arrays whole", `{"tags":["a","b"]}`, `{"tags":["c"]}`, `{"tags":["c"]}`},
+		{"object replaces a scalar", `{"promotion":"none"}`, `{"promotion":{"price":8}}`, `{"promotion":{"price":8}}`},
+		{"matches keys case-insensitively", `{"Name":"Pizza","Price":10}`, `{"price":12,"NAME":null}`, `{"Price":12}`},
+		{"prefers the exact key", `{"price":10,"Price":11}`, `{"Price":12}`, `{"price":10,"Price":12}`},
+		{"empty patch", `{"name":"Pizza"}`, `{}`, `{"name":"Pizza"}`},
+	}
+	for _, tt := range tests {
+		got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("%s: Apply = %v", tt.name, err)
+			continue
+		}
+		var gotValue, wantValue interface{}
+		if err := json.Unmarshal(got, &gotValue); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(tt.want), &wantValue); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(gotValue, wantValue) {
+			t.Errorf("%s: Apply = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name, doc, patch string
+	}{
+		{"invalid document", `{`, `{}`},
+		{"invalid patch", `{}`, `{`},
+		{"array patch", `{}`, `[]`},
+		{"null patch", `{}`, `null`},
+		{"scalar patch", `{}`, `3`},
+	}
+	for _, tt := range tests {
+		if got, err := Apply([]byte(tt.doc), []byte(tt.patch)); err == nil {
+			t.Errorf("%s: Apply = %s, want an error", tt.name, got)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go_backend/models"
+	"go_backend/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+type testUsers map[string]models.User
+
+func (u testUsers) ByID(ctx context.Context, id string) (models.User, error) {
+	user, ok := u[id]
+	if !ok {
+		return models.User{}, repository.ErrNotFound
+	}
+	return user, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	gin.SetMode(gin.TestMode)
+	ada := models.User{ID: "ada", IsAdmin: true, TokenVersion: 1}
+	token, err := GenerateToken(ada)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, blocked := ada, ada
+	revoked.TokenVersion = 2
+	blocked.IsBlocked = true
+	tests := []struct {
+		name string
+		user models.User
+		want string
+	}{
+		{"current", ada, "ada"},
+		{"revoked", revoked, ""},
+		{"blocked", blocked, ""},
+	}
+	previous := Users
+	defer func() { Users = previous }()
+	for _, tt := range tests {
+		Users = testUsers{"ada": tt.user}
+		router := gin.New()
+		var userID string
+		router.GET("/", Authenticate(), func(c *gin.Context) { userID = c.GetString("userId") })
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		if userID != tt.want {
+			t.Errorf("%s: userId = %q, want %q", tt.name, userID, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limiter allows each key a fixed number of requests per window. Counts
+// are kept in memory, so every instance limits on its own.
+type Limiter struct {
+	Limit  int
+	Window time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*limiterWindow
+}
+
+type limiterWindow struct {
+	start time.Time
+	count int
+}
+
+// NewLimiter returns a limiter allowing limit requests per window.
+func NewLimiter(limit int, window time.Duration) *Limiter {
+	return &Limiter{Limit: limit, Window: window, windows: map[string]*limiterWindow{}}
+}
+
+// Allow counts a request for key and reports whether it is within the
+// limit. When it isn't, retryAfter is how long until the window resets.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w := l.windows[key]
+	if w == nil || now.Sub(w.start) >= l.Window {
+		l.sweep(now)
+		w = &limiterWindow{start: now}
+		l.windows[key] = w
+	}
+	if w.count >= l.Limit {
+		return false, w.start.Add(l.Window).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// sweep forgets windows that have ended so the map doesn't grow without
+// bound.
+func (l *Limiter) sweep(now time.Time) {
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.Window {
+			delete(l.windows, key)
+		}
+	}
+}
+
+// RateLimit rejects requests with 429 once the key returned by key has
+// used up its allowance. Requests with an empty key are not limited.
+func RateLimit(l *Limiter, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+		if ok, retryAfter := l.Allow(k); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ByUser keys rate limits on the authenticated caller.
+func ByUser(c *gin.Context) string {
+	return c.GetString("userId")
+}
+
+// ByIP keys rate limits on the client's address.
+func ByIP(c *gin.Context) string {
+	return c.ClientIP()
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"go_backend/models"
+	"go_backend/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StoreLookup loads a request's store.
+type StoreLookup interface {
+	ByID(ctx context.Context, id string) (models.Store, error)
+}
+
+// Stores is where RequireStoreAdmin looks up the staff of a store.
+var Stores StoreLookup = repository.NewMongo().Stores
+
+// StoreID returns the store a request is scoped to: the :storeId route
+// parameter, or the default store for the unscoped routes.
+func StoreID(c *gin.Context) string {
+	if id := c.Param("storeId"); id != "" {
+		return id
+	}
+	return models.DefaultStoreID
+}
+
+// RequireSuperAdmin rejects requests from callers that can't manage every
+// store.
+func RequireSuperAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("userId") == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		if !c.GetBool("isSuperAdmin") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Super admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireStoreAdmin rejects requests from admins who are not staff of the
+// request's store. Super admins may manage any store. Passing roles limits
+// access to staff with one of those roles.
+func RequireStoreAdmin(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userId")
+		if userID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		if c.GetBool("isSuperAdmin") {
+			c.Next()
+			return
+		}
+		if !c.GetBool("isAdmin") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+
+		store, err := Stores.ByID(context.TODO(), StoreID(c))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+			return
+		}
+		if !store.HasStaff(userID, roles...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You can only manage your own store"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,482 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go_backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+// all lists every migration. Append new ones with the next version; never
+// renumber or remove applied ones.
+var all = []Migration{
+	{Version: 1, Name: "rename-model-fields", Up: renameModelFields},
+	{Version: 2, Name: "drop-global-favorites", Up: dropGlobalFavorites},
+	{Version: 3, Name: "reset-food-ratings", Up: resetFoodRatings},
+	{Version: 4, Name: "create-default-store", Up: createDefaultStore},
+	{Version: 5, Name: "add-food-versions", Up: addFoodVersions, Down: removeFoodVersions},
+	{Version: 6, Name: "add-user-deleted-at", Up: addUserDeletedAt},
+	{Version: 7, Name: "verify-existing-users", Up: verifyExistingUsers},
+	{Version: 8, Name: "limit-super-admins", Up: limitSuperAdmins},
+	{Version: 9, Name: "camel-case-fields", Up: camelCaseFields, Down: lowerCaseFields},
+}
+
+// legacyFoodFields are the legacy field names of foods, which orders also
+// embed in their items.
+var legacyFoodFields = map[string]string{
+	"storeid":             "storeId",
+	"imageurl":            "imageUrl",
+	"cooktime":            "cookTime",
+	"modifiergroups":      "modifierGroups",
+	"availabilitywindows": "availabilityWindows",
+	"dietlabels":          "dietLabels",
+	"trackstock":          "trackStock",
+	"lowstockthreshold":   "lowStockThreshold",
+	"soldout":             "soldOut",
+	"ratingcount":         "ratingCount",
+	"ratingsum":           "ratingSum",
+	"createdat":           "createdAt",
+	"updatedat":           "updatedAt",
+	"deletedat":           "deletedAt",
+}
+
+// legacyModelFields maps users, orders and foods to the lowercased names
+// their fields were stored under before the models had bson tags, and the
+// tagged names. The names are fixed here so later model changes don't
+// alter what renameModelFields does.
+var legacyModelFields = map[string]map[string]string{
+	"users": {
+		"isadmin":      "isAdmin",
+		"isblocked":    "isBlocked",
+		"issuperadmin": "isSuperAdmin",
+		"createdat":    "createdAt",
+		"updatedat":    "updatedAt",
+		"deletedat":    "deletedAt",
+	},
+	"orders": withPrefix("items.food.", legacyFoodFields, map[string]string{
+		"storeid":           "storeId",
+		"addresslatlng":     "addressLatLng",
+		"deliveryfee":       "deliveryFee",
+		"totalprice":        "totalPrice",
+		"userid":            "userId",
+		"paymentid":         "paymentId",
+		"stockreserved":     "stockReserved",
+		"scheduledfor":      "scheduledFor",
+		"releasedat":        "releasedAt",
+		"createdat":         "createdAt",
+		"updatedat":         "updatedAt",
+		"deletedat":         "deletedAt",
+		"items.baseprice":   "basePrice",
+		"items.promotionid": "promotionId",
+		"items.variantid":   "variantId",
+		"items.variantname": "variantName",
+		"items.unitprice":   "unitPrice",
+	}),
+	"foods": legacyFoodFields,
+}
+
+// renameModelFields renames the fields of users, orders and foods written
+// before the models had bson tags. Those documents used the driver's
+// default lowercased field names, and foods nested their timestamps under
+// "model".
+func renameModelFields(ctx context.Context, db *mongo.Database) error {
+	if err := liftModelTimestamps(ctx, db.Collection("foods"), ""); err != nil {
+		return err
+	}
+	if err := liftModelTimestamps(ctx, db.Collection("orders"), "items.food"); err != nil {
+		return err
+	}
+	for name, renames := range legacyModelFields {
+		if err := renameCollectionFields(ctx, db.Collection(name), renames); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// liftModelTimestamps moves the timestamps foods nested under "model" onto
+// the food itself. path is where the foods are in the collection's
+// documents; empty means the documents are the foods.
+func liftModelTimestamps(ctx context.Context, collection *mongo.Collection, path string) error {
+	field := "model"
+	if path != "" {
+		field = path + ".model"
+	}
+	cursor, err := collection.Find(ctx, bson.M{field: bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		eachDocument(doc, path, func(food bson.M) {
+			model, ok := food["model"].(bson.M)
+			if !ok {
+				return
+			}
+			for _, key := range []string{"createdat", "updatedat", "deletedat"} {
+				if value, ok := model[key]; ok {
+					food[key] = value
+				}
+			}
+			delete(food, "model")
+		})
+		if _, err := collection.ReplaceOne(ctx, bson.M{"_id": doc["_id"]}, doc); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// dropGlobalFavorites drops the old global favorite flag from foods.
+// Favorites are now stored per user in user_favorites.
+func dropGlobalFavorites(ctx context.Context, db *mongo.Database) error {
+	result, err := db.Collection("foods").UpdateMany(ctx,
+		bson.M{"favorite": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"favorite": ""}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Removed global favorite flag from %d foods", result.ModifiedCount)
+	}
+	return nil
+}
+
+// resetFoodRatings resets the admin-set star values on foods that predate
+// review-based ratings. Stars is now the average of approved reviews.
+func resetFoodRatings(ctx context.Context, db *mongo.Database) error {
+	result, err := db.Collection("foods").UpdateMany(ctx,
+		bson.M{"ratingCount": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"stars": 0, "ratingCount": 0, "ratingSum": 0}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Reset ratings on %d foods", result.ModifiedCount)
+	}
+	return nil
+}
+
+// createDefaultStore creates the default store for data that predates
+// multi-store support. The old store_settings schedule moves onto it,
+// existing admins become its managers, the SUPER_ADMIN_EMAIL account
+// becomes a super admin, and every store-scoped document without a store
+// is assigned to it.
+func createDefaultStore(ctx context.Context, db *mongo.Database) error {
+	stores := db.Collection("stores")
+
+	if err := stores.FindOne(ctx, bson.M{"id": models.DefaultStoreID}).Err(); errors.Is(err, mongo.ErrNoDocuments) {
+		schedule := bson.M{}
+		if err := db.Collection("store_settings").FindOne(ctx, bson.M{"id": models.DefaultStoreID}).Decode(&schedule); err == nil {
+			delete(schedule, "_id")
+			delete(schedule, "id")
+			delete(schedule, "updatedat")
+		}
+
+		staff := bson.A{}
+		admins, err := db.Collection("users").Distinct(ctx, "id", bson.M{"isAdmin": true})
+		if err != nil {
+			return err
+		}
+		for _, id := range admins {
+			staff = append(staff, bson.M{"userid": id, "role": "manager"})
+		}
+
+		_, err = stores.InsertOne(ctx, bson.M{
+			"id":            models.DefaultStoreID,
+			"name":          "Main store",
+			"slug":          "main",
+			"schedule":      schedule,
+			"deliveryzones": bson.A{},
+			"staff":         staff,
+			"createdat":     time.Now(),
+			"updatedat":     time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if err := promoteSuperAdmin(ctx, db); err != nil {
+			return err
+		}
+		log.Printf("Created default store with %d managers", len(staff))
+	} else if err != nil {
+		return err
+	}
+
+	// Foods and orders have tagged field names; the rest still used the
+	// driver's lowercased defaults, which camelCaseFields renames later
+	for name, field := range map[string]string{
+		"foods":             "storeId",
+		"orders":            "storeId",
+		"ingredients":       "storeid",
+		"stock_adjustments": "storeid",
+		"reviews":           "storeid",
+	} {
+		_, err := db.Collection(name).UpdateMany(ctx,
+			bson.M{field: bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{field: models.DefaultStoreID}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFoodVersions starts foods that predate optimistic concurrency at
+// version 1.
+func addFoodVersions(ctx context.Context, db *mongo.Database) error {
+	result, err := db.Collection("foods").UpdateMany(ctx,
+		bson.M{"version": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"version": 1}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Set version on %d foods", result.ModifiedCount)
+	}
+	return nil
+}
+
+func removeFoodVersions(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("foods").UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"version": ""}})
+	return err
+}
+
+// addUserDeletedAt gives users that predate soft delete an unset DeletedAt,
+// so the partial unique index on email covers them.
+func addUserDeletedAt(ctx context.Context, db *mongo.Database) error {
+	result, err := db.Collection("users").UpdateMany(ctx,
+		bson.M{models.UserDeletedAt: bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{models.UserDeletedAt: gorm.DeletedAt{}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Set deletedAt on %d users", result.ModifiedCount)
+	}
+	return nil
+}
+
+// verifyExistingUsers marks accounts created before email verification as
+// verified, so the new policy doesn't lock out existing customers.
+func verifyExistingUsers(ctx context.Context, db *mongo.Database) error {
+	result, err := db.Collection("users").UpdateMany(ctx,
+		bson.M{"emailVerified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"emailVerified": true}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Marked %d existing users as verified", result.ModifiedCount)
+	}
+	return nil
+}
+
+// limitSuperAdmins revokes super admin from everyone but the
+// SUPER_ADMIN_EMAIL account. An earlier version of createDefaultStore made
+// every admin a super admin.
+func limitSuperAdmins(ctx context.Context, db *mongo.Database) error {
+	filter := bson.M{"isSuperAdmin": true}
+	if email := os.Getenv("SUPER_ADMIN_EMAIL"); email != "" {
+		filter["email"] = bson.M{"$ne": email}
+	}
+	result, err := db.Collection("users").UpdateMany(ctx, filter, bson.M{"$set": bson.M{"isSuperAdmin": false}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Revoked super admin from %d users", result.ModifiedCount)
+	}
+	return promoteSuperAdmin(ctx, db)
+}
+
+// promoteSuperAdmin makes the SUPER_ADMIN_EMAIL account a super admin.
+// Without it nobody is promoted; use the super-admin command instead.
+func promoteSuperAdmin(ctx context.Context, db *mongo.Database) error {
+	email := os.Getenv("SUPER_ADMIN_EMAIL")
+	if email == "" {
+		log.Println("SUPER_ADMIN_EMAIL is not set; no super admin was promoted")
+		return nil
+	}
+	result, err := db.Collection("users").UpdateOne(ctx,
+		bson.M{"email": email},
+		bson.M{"$set": bson.M{"isAdmin": true, "isSuperAdmin": true}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		log.Printf("SUPER_ADMIN_EMAIL %s matches no user; no super admin was promoted", email)
+	}
+	return nil
+}
+
+// foodSubdocumentFields are the fields of the untagged types nested in a
+// food, keyed by their lowercased path.
+var foodSubdocumentFields = map[string]string{
+	"modifierGroups.minselect": "minSelect",
+	"modifierGroups.maxselect": "maxSelect",
+	"promotion.scheduleid":     "scheduleId",
+	"promotion.regularprice":   "regularPrice",
+	"promotion.endsat":         "endsAt",
+	"categories.categoryid":    "categoryId",
+	"nutrition.saturatedfat":   "saturatedFat",
+	"images.uploadedby":        "uploadedBy",
+	"images.createdat":         "createdAt",
+	"ingredients.ingredientid": "ingredientId",
+}
+
+// camelCaseRenames maps each collection to the lowercased paths of the
+// fields it stored before its model had bson tags and their new names.
+// The names are fixed here so later model changes don't alter what the
+// migration does.
+var camelCaseRenames = map[string]map[string]string{
+	"stores": {
+		"schedule.timezone":         "timeZone",
+		"schedule.openinghours":     "openingHours",
+		"schedule.slotminutes":      "slotMinutes",
+		"schedule.slotcapacity":     "slotCapacity",
+		"schedule.maxadvancedays":   "maxAdvanceDays",
+		"deliveryzones":             "deliveryZones",
+		"deliveryzones.radiuskm":    "radiusKm",
+		"deliveryzones.deliveryfee": "deliveryFee",
+		"staff.userid":              "userId",
+		"createdat":                 "createdAt",
+		"updatedat":                 "updatedAt",
+	},
+	"categories": {
+		"storeid":   "storeId",
+		"parentid":  "parentId",
+		"imageurl":  "imageUrl",
+		"createdat": "createdAt",
+		"updatedat": "updatedAt",
+	},
+	"user_favorites": {
+		"userid":    "userId",
+		"foodid":    "foodId",
+		"createdat": "createdAt",
+	},
+	"ingredients": {
+		"storeid":           "storeId",
+		"lowstockthreshold": "lowStockThreshold",
+		"createdat":         "createdAt",
+		"updatedat":         "updatedAt",
+	},
+	"stock_adjustments": {
+		"storeid":    "storeId",
+		"targettype": "targetType",
+		"targetid":   "targetId",
+		"stockafter": "stockAfter",
+		"adjustedby": "adjustedBy",
+		"orderid":    "orderId",
+		"createdat":  "createdAt",
+	},
+	"price_history": {
+		"foodid":    "foodId",
+		"storeid":   "storeId",
+		"oldprice":  "oldPrice",
+		"newprice":  "newPrice",
+		"changedby": "changedBy",
+		"createdat": "createdAt",
+	},
+	"price_schedules": {
+		"foodid":    "foodId",
+		"storeid":   "storeId",
+		"startsat":  "startsAt",
+		"endsat":    "endsAt",
+		"createdby": "createdBy",
+		"createdat": "createdAt",
+		"updatedat": "updatedAt",
+	},
+	"reviews": {
+		"foodid":       "foodId",
+		"storeid":      "storeId",
+		"userid":       "userId",
+		"username":     "userName",
+		"orderid":      "orderId",
+		"helpfulvotes": "helpfulVotes",
+		"helpfulby":    "helpfulBy",
+		"moderatedby":  "moderatedBy",
+		"createdat":    "createdAt",
+		"updatedat":    "updatedAt",
+	},
+	"webhooks": {
+		"storeid":    "storeId",
+		"eventtypes": "eventTypes",
+		"createdby":  "createdBy",
+		"createdat":  "createdAt",
+		"updatedat":  "updatedAt",
+	},
+	"webhook_deliveries": {
+		"webhookid":      "webhookId",
+		"storeid":        "storeId",
+		"eventid":        "eventId",
+		"eventtype":      "eventType",
+		"nextattemptat":  "nextAttemptAt",
+		"lastattemptat":  "lastAttemptAt",
+		"laststatuscode": "lastStatusCode",
+		"lasterror":      "lastError",
+		"createdat":      "createdAt",
+		"updatedat":      "updatedAt",
+	},
+	"password_resets": {
+		"userid":    "userId",
+		"tokenhash": "tokenHash",
+		"expiresat": "expiresAt",
+		"usedat":    "usedAt",
+		"createdat": "createdAt",
+	},
+	"foods": foodSubdocumentFields,
+	"orders": withPrefix("items.food.", foodSubdocumentFields, map[string]string{
+		"items.modifiers.groupid":  "groupId",
+		"items.modifiers.optionid": "optionId",
+	}),
+}
+
+// withPrefix adds fields to extra with prefix prepended to their paths.
+func withPrefix(prefix string, fields, extra map[string]string) map[string]string {
+	for path, name := range fields {
+		extra[prefix+path] = name
+	}
+	return extra
+}
+
+// camelCaseFields renames the fields of documents stored before every
+// model had camelCase bson tags.
+func camelCaseFields(ctx context.Context, db *mongo.Database) error {
+	for name, renames := range camelCaseRenames {
+		if err := renameCollectionFields(ctx, db.Collection(name), renames); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// lowerCaseFields reverts camelCaseFields.
+func lowerCaseFields(ctx context.Context, db *mongo.Database) error {
+	for name, renames := range camelCaseRenames {
+		if err := renameCollectionFields(ctx, db.Collection(name), invertRenames(renames)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
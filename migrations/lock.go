@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// lockTTL bounds how long a crashed instance can keep others from
+// migrating.
+const lockTTL = 10 * time.Minute
+
+const lockID = "migrations"
+
+// ErrLocked is returned when another instance holds the migration lock.
+var ErrLocked = errors.New("another instance is running migrations")
+
+type lockDocument struct {
+	ID        string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	LockedAt  time.Time `bson:"lockedAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// Lock takes the migration lock, waiting up to a minute for another
+// instance to release it. Call the returned function to release it.
+func Lock(ctx context.Context, db *mongo.Database) (func(), error) {
+	collection := db.Collection("migration_lock")
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s/%d/%s", host, os.Getpid(), primitive.NewObjectID().Hex())
+
+	deadline := time.Now().Add(time.Minute)
+	for {
+		now := time.Now()
+		_, err := collection.InsertOne(ctx, lockDocument{ID: lockID, Owner: owner, LockedAt: now, ExpiresAt: now.Add(lockTTL)})
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		// Take over a lock its owner never released
+		expired := bson.M{"_id": lockID, "expiresAt": bson.M{"$lt": now}}
+		update := bson.M{"$set": bson.M{"owner": owner, "lockedAt": now, "expiresAt": now.Add(lockTTL)}}
+		result, err := collection.UpdateOne(ctx, expired, update)
+		if err != nil {
+			return nil, err
+		}
+		if result.ModifiedCount > 0 {
+			break
+		}
+
+		if now.After(deadline) {
+			return nil, ErrLocked
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	return func() {
+		if _, err := collection.DeleteOne(context.Background(), bson.M{"_id": lockID, "owner": owner}); err != nil {
+			log.Println("Failed to release migration lock:", err)
+		}
+	}, nil
+}
@@ -0,0 +1,161 @@
+// Package migrations applies versioned schema and data migrations to the
+// Mongo database and records them in the migrations collection.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrIrreversible is returned by Down for a migration without a Down step.
+var ErrIrreversible = errors.New("migration can't be reverted")
+
+// Migration is one versioned change. Up must be safe to run again on data
+// it has already migrated.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	// Down reverts Up. Nil marks the migration irreversible.
+	Down func(ctx context.Context, db *mongo.Database) error
+}
+
+// Record is a migration's entry in the migrations collection.
+type Record struct {
+	Version   int       `bson:"version" json:"version"`
+	Name      string    `bson:"name" json:"name"`
+	AppliedAt time.Time `bson:"appliedAt" json:"appliedAt"`
+}
+
+// State reports whether a known migration has been applied.
+type State struct {
+	Version    int        `json:"version"`
+	Name       string     `json:"name"`
+	AppliedAt  *time.Time `json:"appliedAt"`
+	Reversible bool       `json:"reversible"`
+}
+
+// All returns the registered migrations in version order.
+func All() []Migration {
+	sorted := append([]Migration(nil), all...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return sorted
+}
+
+// Up applies every pending migration in version order and returns how many
+// it applied.
+func Up(ctx context.Context, db *mongo.Database) (int, error) {
+	unlock, err := Lock(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range All() {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		log.Printf("Applying migration %d %s", m.Version, m.Name)
+		if err := m.Up(ctx, db); err != nil {
+			return count, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		record := Record{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+		if _, err := db.Collection("migrations").InsertOne(ctx, record); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Down reverts the latest steps applied migrations, newest first. When one
+// of them is irreversible it fails with ErrIrreversible and reverts none.
+func Down(ctx context.Context, db *mongo.Database, steps int) (int, error) {
+	unlock, err := Lock(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	// Check the whole plan first, so an irreversible migration stops the
+	// command before anything is reverted
+	known := All()
+	var plan []Migration
+	for i := len(known) - 1; i >= 0 && len(plan) < steps; i-- {
+		if _, ok := applied[known[i].Version]; ok {
+			plan = append(plan, known[i])
+		}
+	}
+	for _, m := range plan {
+		if m.Down == nil {
+			return 0, fmt.Errorf("migration %d %s: %w; nothing was reverted", m.Version, m.Name, ErrIrreversible)
+		}
+	}
+
+	count := 0
+	for _, m := range plan {
+		log.Printf("Reverting migration %d %s", m.Version, m.Name)
+		if err := m.Down(ctx, db); err != nil {
+			return count, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		if _, err := db.Collection("migrations").DeleteOne(ctx, bson.M{"version": m.Version}); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Status lists every known migration and when it was applied.
+func Status(ctx context.Context, db *mongo.Database) ([]State, error) {
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := []State{}
+	for _, m := range All() {
+		state := State{Version: m.Version, Name: m.Name, Reversible: m.Down != nil}
+		if record, ok := applied[m.Version]; ok {
+			state.AppliedAt = &record.AppliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func appliedVersions(ctx context.Context, db *mongo.Database) (map[int]Record, error) {
+	cursor, err := db.Collection("migrations").Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"version": 1}))
+	if err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := map[int]Record{}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
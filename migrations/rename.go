@@ -0,0 +1,124 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// renameCollectionFields renames fields on every document of collection.
+// renames maps a field's dotted path to its new name; paths run through
+// arrays, so "items.food.sku" names the sku of the food of each item.
+//
+// The collection's indexes are dropped first, since unique indexes on the
+// old names would reject the renamed documents. EnsureIndexes rebuilds
+// the declared ones at startup.
+func renameCollectionFields(ctx context.Context, collection *mongo.Collection, renames map[string]string) error {
+	legacy := bson.A{}
+	for path := range renames {
+		legacy = append(legacy, bson.M{path: bson.M{"$exists": true}})
+	}
+	filter := bson.M{"$or": legacy}
+
+	if err := collection.FindOne(ctx, filter).Err(); errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err := collection.Indexes().DropAll(ctx); err != nil {
+		return err
+	}
+
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	renamed := 0
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		renameKeys(doc, "", renames)
+		if _, err := collection.ReplaceOne(ctx, bson.M{"_id": doc["_id"]}, doc); err != nil {
+			return err
+		}
+		renamed++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	log.Printf("Renamed fields on %d %s", renamed, collection.Name())
+	return nil
+}
+
+// renameKeys renames the fields of doc, whose path is prefix, in place.
+// Nested documents are renamed first so their paths are still the old ones.
+func renameKeys(doc bson.M, prefix string, renames map[string]string) {
+	for key, value := range doc {
+		path := prefix + key
+		renameNested(value, path+".", renames)
+		if name, ok := renames[path]; ok && name != key {
+			doc[name] = value
+			delete(doc, key)
+		}
+	}
+}
+
+func renameNested(value interface{}, prefix string, renames map[string]string) {
+	switch v := value.(type) {
+	case bson.M:
+		renameKeys(v, prefix, renames)
+	case bson.A:
+		for _, item := range v {
+			renameNested(item, prefix, renames)
+		}
+	}
+}
+
+// invertRenames returns the renames that undo renames, keyed by the new
+// paths.
+func invertRenames(renames map[string]string) map[string]string {
+	inverted := map[string]string{}
+	for path := range renames {
+		segments := strings.Split(path, ".")
+		renamed := make([]string, len(segments))
+		for i, segment := range segments {
+			renamed[i] = segment
+			if name, ok := renames[strings.Join(segments[:i+1], ".")]; ok {
+				renamed[i] = name
+			}
+		}
+		inverted[strings.Join(renamed, ".")] = segments[len(segments)-1]
+	}
+	return inverted
+}
+
+// eachDocument calls fn with every document at path within doc, descending
+// through arrays. An empty path is doc itself.
+func eachDocument(doc bson.M, path string, fn func(bson.M)) {
+	if path == "" {
+		fn(doc)
+		return
+	}
+	key, rest, _ := strings.Cut(path, ".")
+	var visit func(value interface{})
+	visit = func(value interface{}) {
+		switch v := value.(type) {
+		case bson.M:
+			eachDocument(v, rest, fn)
+		case bson.A:
+			for _, item := range v {
+				visit(item)
+			}
+		}
+	}
+	visit(doc[key])
+}
@@ -0,0 +1,103 @@
+package migrations
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRenameKeys(t *testing.T) {
+	renames := map[string]string{
+		"storeid":                  "storeId",
+		"items.baseprice":          "basePrice",
+		"items.food.storeid":       "storeId",
+		"items.modifiers.optionid": "optionId",
+	}
+	doc := bson.M{
+		"storeid": "main",
+		"status":  "Paid",
+		"items": bson.A{
+			bson.M{
+				"baseprice": 9.5,
+				"food":      bson.M{"storeid": "main", "name": "Pizza"},
+				"modifiers": bson.A{bson.M{"optionid": "cheese"}},
+			},
+		},
+	}
+	want := bson.M{
+		"storeId": "main",
+		"status":  "Paid",
+		"items": bson.A{
+			bson.M{
+				"basePrice": 9.5,
+				"food":      bson.M{"storeId": "main", "name": "Pizza"},
+				"modifiers": bson.A{bson.M{"optionId": "cheese"}},
+			},
+		},
+	}
+
+	renameKeys(doc, "", renames)
+	if !reflect.DeepEqual(doc, want) {
+		t.Fatalf("renameKeys\n got: %v\nwant: %v", doc, want)
+	}
+
+	renameKeys(doc, "", invertRenames(renames))
+	renameKeys(doc, "", renames)
+	if !reflect.DeepEqual(doc, want) {
+		t.Fatalf("renaming back and forth\n got: %v\nwant: %v", doc, want)
+	}
+}
+
+func TestInvertRenames(t *testing.T) {
+	got := invertRenames(map[string]string{
+		"deliveryzones":          "deliveryZones",
+		"deliveryzones.radiuskm": "radiusKm",
+		"staff.userid":           "userId",
+	})
+	want := map[string]string{
+		"deliveryZones":          "deliveryzones",
+		"deliveryZones.radiusKm": "radiuskm",
+		"staff.userId":           "userid",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invertRenames = %v, want %v", got, want)
+	}
+}
+
+func TestEachDocument(t *testing.T) {
+	doc := bson.M{"items": bson.A{
+		bson.M{"food": bson.M{"name": "Pizza"}},
+		bson.M{"food": bson.M{"name": "Pasta"}},
+		bson.M{},
+	}}
+
+	var names []interface{}
+	eachDocument(doc, "items.food", func(food bson.M) { names = append(names, food["name"]) })
+	if want := []interface{}{"Pizza", "Pasta"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("eachDocument visited %v, want %v", names, want)
+	}
+}
+
+// TestRenamesTargetCamelCase guards the frozen rename maps against typos:
+// every old name is lowercase and every new name is its camelCase form.
+func TestRenamesTargetCamelCase(t *testing.T) {
+	all := map[string]map[string]string{}
+	for name, renames := range legacyModelFields {
+		all["legacy "+name] = renames
+	}
+	for name, renames := range camelCaseRenames {
+		all[name] = renames
+	}
+
+	for name, renames := range all {
+		for path, to := range renames {
+			segments := strings.Split(path, ".")
+			from := segments[len(segments)-1]
+			if from == to || !strings.EqualFold(from, to) {
+				t.Errorf("%s: %s renames to %q", name, path, to)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Category is a section of a store's menu. Categories with a ParentID are
+// nested inside that category; Position orders siblings.
+type Category struct {
+	ID          string    `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	StoreID     string    `json:"storeId" bson:"storeId" gorm:"type:varchar(24);index;not null"`
+	ParentID    string    `json:"parentId" bson:"parentId" gorm:"type:varchar(24);index"`
+	Name        string    `json:"name" bson:"name" gorm:"type:varchar(100);not null"`
+	Description string    `json:"description" bson:"description" gorm:"type:text"`
+	ImageUrl    string    `json:"imageUrl" bson:"imageUrl" gorm:"type:varchar(255)"`
+	Position    int       `json:"position" bson:"position" gorm:"default:0"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updatedAt" bson:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// CategoryPlacement puts a food in a category at a position.
+type CategoryPlacement struct {
+	CategoryID string `json:"categoryId" bson:"categoryId" gorm:"type:varchar(24);not null"`
+	Position   int    `json:"position" bson:"position" gorm:"default:0"`
+}
+
+// MenuSection is a category with its foods and subsections, in display
+// order.
+type MenuSection struct {
+	Category Category      `json:"category"`
+	Foods    []Food        `json:"foods"`
+	Sections []MenuSection `json:"sections"`
+}
+
+// Menu is a store's structured menu. Uncategorized holds foods not placed
+// in any category.
+type Menu struct {
+	Sections      []MenuSection `json:"sections"`
+	Uncategorized []Food        `json:"uncategorized"`
+}
+
+// ValidateParent checks that moving category id under parentID keeps the
+// tree acyclic. categories are the store's existing categories.
+func ValidateParent(id, parentID string, categories []Category) error {
+	if parentID == "" {
+		return nil
+	}
+
+	parents := map[string]string{}
+	for _, category := range categories {
+		parents[category.ID] = category.ParentID
+	}
+	if _, ok := parents[parentID]; !ok {
+		return fmt.Errorf("parent category not found")
+	}
+	for current := parentID; current != ""; current = parents[current] {
+		if current == id {
+			return fmt.Errorf("a category can't be nested inside itself")
+		}
+	}
+	return nil
+}
+
+// BuildMenu arranges foods into the category tree. A food placed in
+// several categories appears in each of them.
+func BuildMenu(categories []Category, foods []Food) Menu {
+	children := map[string][]Category{}
+	known := map[string]bool{}
+	for _, category := range categories {
+		known[category.ID] = true
+	}
+	for _, category := range categories {
+		parent := category.ParentID
+		if !known[parent] {
+			parent = ""
+		}
+		children[parent] = append(children[parent], category)
+	}
+
+	type placed struct {
+		food     Food
+		position int
+	}
+	byCategory := map[string][]placed{}
+	menu := Menu{Uncategorized: []Food{}}
+	for _, food := range foods {
+		inMenu := false
+		for _, placement := range food.Categories {
+			if known[placement.CategoryID] {
+				byCategory[placement.CategoryID] = append(byCategory[placement.CategoryID], placed{food, placement.Position})
+				inMenu = true
+			}
+		}
+		if !inMenu {
+			menu.Uncategorized = append(menu.Uncategorized, food)
+		}
+	}
+
+	var build func(parent string) []MenuSection
+	build = func(parent string) []MenuSection {
+		siblings := children[parent]
+		sort.SliceStable(siblings, func(i, j int) bool {
+			if siblings[i].Position != siblings[j].Position {
+				return siblings[i].Position < siblings[j].Position
+			}
+			return siblings[i].Name < siblings[j].Name
+		})
+
+		sections := make([]MenuSection, 0, len(siblings))
+		for _, category := range siblings {
+			entries := byCategory[category.ID]
+			sort.SliceStable(entries, func(i, j int) bool {
+				if entries[i].position != entries[j].position {
+					return entries[i].position < entries[j].position
+				}
+				return entries[i].food.Name < entries[j].food.Name
+			})
+
+			section := MenuSection{Category: category, Foods: make([]Food, len(entries)), Sections: build(category.ID)}
+			for i, entry := range entries {
+				section.Foods[i] = entry.food
+			}
+			sections = append(sections, section)
+		}
+		return sections
+	}
+
+	menu.Sections = build("")
+	return menu
+}
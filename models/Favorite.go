@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type UserFavorite struct {
+	ID        string    `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	UserID    string    `json:"userId" bson:"userId" gorm:"type:varchar(24);uniqueIndex:idx_user_food;not null"`
+	FoodID    string    `json:"foodId" bson:"foodId" gorm:"type:varchar(24);uniqueIndex:idx_user_food;not null"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+}
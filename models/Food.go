@@ -1,19 +1,93 @@
 package models
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"gorm.io/gorm"
 )
 
 type Food struct {
-	gorm.Model
-	ID       primitive.ObjectID `bson:"_id,omitempty"`
-	Name     string             `gorm:"type:varchar(100);not null"`
-	Price    float64            `gorm:"not null"`
-	Tags     []string           `gorm:"type:varchar(100)"`
-	Favorite bool               `gorm:"default:false"`
-	Stars    int                `gorm:"default:3"`
-	ImageUrl string             `gorm:"type:varchar(255);not null"`
-	Origins  []string           `gorm:"type:varchar(100);not null"`
-	CookTime string             `gorm:"type:varchar(100);not null"`
+	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	StoreID  string             `json:"storeId" bson:"storeId" gorm:"type:varchar(24);index;not null"`
+	Name     string             `json:"name" bson:"name" gorm:"type:varchar(100);not null"`
+	SKU      string             `json:"sku" bson:"sku" gorm:"type:varchar(100);index"`
+	Price    float64            `json:"price" bson:"price" gorm:"not null"`
+	Tags     []string           `json:"tags" bson:"tags" gorm:"type:varchar(100)"`
+	Stars    float64            `json:"stars" bson:"stars" gorm:"default:0"`
+	ImageUrl string             `json:"imageUrl" bson:"imageUrl" gorm:"type:varchar(255);not null"`
+	Origins  []string           `json:"origins" bson:"origins" gorm:"type:varchar(100);not null"`
+	CookTime string             `json:"cookTime" bson:"cookTime" gorm:"type:varchar(100);not null"`
+
+	Variants       []FoodVariant   `json:"variants" bson:"variants" gorm:"serializer:json"`
+	ModifierGroups []ModifierGroup `json:"modifierGroups" bson:"modifierGroups" gorm:"serializer:json"`
+
+	AvailabilityWindows []TimeWindow `json:"availabilityWindows" bson:"availabilityWindows" gorm:"serializer:json"`
+
+	// Promotion is set while a limited-time price is in effect; Price is
+	// then the promotional price.
+	Promotion *FoodPromotion `json:"promotion" bson:"promotion" gorm:"serializer:json"`
+
+	// Categories place the food in the structured menu; Tags stay free-form.
+	Categories []CategoryPlacement `json:"categories" bson:"categories" gorm:"serializer:json"`
+
+	Nutrition  *Nutrition `json:"nutrition" bson:"nutrition" gorm:"serializer:json"`
+	Allergens  []string   `json:"allergens" bson:"allergens" gorm:"serializer:json"`
+	DietLabels []string   `json:"dietLabels" bson:"dietLabels" gorm:"serializer:json"`
+
+	// Images are uploaded photos; ImageUrl points at the primary one.
+	Images []FoodImage `json:"images" bson:"images" gorm:"serializer:json"`
+
+	// Stock is only enforced when TrackStock is set. SoldOut is raised when
+	// the food or one of its ingredients runs out.
+	TrackStock        bool             `json:"trackStock" bson:"trackStock" gorm:"default:false"`
+	Stock             int              `json:"stock" bson:"stock" gorm:"default:0"`
+	LowStockThreshold int              `json:"lowStockThreshold" bson:"lowStockThreshold" gorm:"default:0"`
+	Ingredients       []FoodIngredient `json:"ingredients" bson:"ingredients" gorm:"serializer:json"`
+	SoldOut           bool             `json:"soldOut" bson:"soldOut" gorm:"default:false"`
+
+	// Stars is the average of RatingSum over RatingCount approved reviews.
+	RatingCount int `json:"ratingCount" bson:"ratingCount" gorm:"default:0"`
+	RatingSum   int `json:"ratingSum" bson:"ratingSum" gorm:"default:0"`
+
+	// Version is bumped on every edit and is the food's ETag.
+	Version int `json:"version" bson:"version" gorm:"default:1"`
+
+	CreatedAt time.Time      `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt time.Time      `json:"updatedAt" bson:"updatedAt" gorm:"autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt" bson:"deletedAt" gorm:"index"`
+
+	// IsFavorite is filled in per request for the logged-in user and is
+	// never stored.
+	IsFavorite bool `json:"isFavorite" bson:"-" gorm:"-"`
+
+	// IsAvailable is computed per request from AvailabilityWindows.
+	IsAvailable bool `json:"isAvailable" bson:"-" gorm:"-"`
+}
+
+// ETag identifies the current version of the food for If-Match checks.
+func (f Food) ETag() string {
+	return strconv.Quote(strconv.Itoa(f.Version))
+}
+
+// Validate checks a food about to be saved, assigning IDs to new menu
+// options along the way.
+func (f *Food) Validate() error {
+	if f.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if f.Price < 0 {
+		return fmt.Errorf("price must not be negative")
+	}
+	if err := f.NormalizeOptions(); err != nil {
+		return err
+	}
+	for _, window := range f.AvailabilityWindows {
+		if err := window.Validate(); err != nil {
+			return err
+		}
+	}
+	return f.validateDietary()
 }
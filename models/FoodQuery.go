@@ -0,0 +1,349 @@
+package models
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PriceBucketBoundaries are the lower bounds of the price facet buckets.
+// Anything at or above the last boundary falls into the open-ended bucket,
+// and anything below the first into the first bucket.
+var PriceBucketBoundaries = []float64{0, 5, 10, 20, 50}
+
+// FoodQuery describes the search and filter options shared by the food
+// listing endpoints.
+type FoodQuery struct {
+	StoreID string
+	Search  string
+	// Text is a full-text search over names, tags and origins using the
+	// foods text index. It matches any of its words.
+	Text     string
+	Tag      string
+	Origin   string
+	MinPrice *float64
+	MaxPrice *float64
+	MinStars *int
+
+	// ExcludeAllergens drops foods containing any of the allergens;
+	// DietLabels keeps foods carrying all of the labels.
+	ExcludeAllergens []string
+	DietLabels       []string
+}
+
+// Filter builds the Mongo filter for the query.
+func (q FoodQuery) Filter() bson.M {
+	filter := NotDeleted(bson.M{}, FoodDeletedAt)
+	if q.StoreID != "" {
+		filter["storeId"] = q.StoreID
+	}
+	if q.Search != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(q.Search), "$options": "i"}
+	}
+	if q.Text != "" {
+		filter["$text"] = bson.M{"$search": q.Text}
+	}
+	if q.Tag != "" {
+		filter["tags"] = q.Tag
+	}
+	if q.Origin != "" {
+		filter["origins"] = q.Origin
+	}
+	price := bson.M{}
+	if q.MinPrice != nil {
+		price["$gte"] = *q.MinPrice
+	}
+	if q.MaxPrice != nil {
+		price["$lte"] = *q.MaxPrice
+	}
+	if len(price) > 0 {
+		filter["price"] = price
+	}
+	if q.MinStars != nil {
+		filter["stars"] = bson.M{"$gte": *q.MinStars}
+	}
+	if len(q.ExcludeAllergens) > 0 {
+		filter["allergens"] = bson.M{"$nin": q.ExcludeAllergens}
+	}
+	if len(q.DietLabels) > 0 {
+		filter["dietLabels"] = bson.M{"$all": q.DietLabels}
+	}
+	return filter
+}
+
+// Matches reports whether food satisfies the query. It is the in-memory
+// counterpart of Filter.
+func (q FoodQuery) Matches(food Food) bool {
+	if food.DeletedAt.Valid {
+		return false
+	}
+	if q.StoreID != "" && food.StoreID != q.StoreID {
+		return false
+	}
+	if q.Search != "" && !strings.Contains(strings.ToLower(food.Name), strings.ToLower(q.Search)) {
+		return false
+	}
+	if q.Text != "" && !matchesText(food, q.Text) {
+		return false
+	}
+	if q.Tag != "" && !containsString(food.Tags, q.Tag) {
+		return false
+	}
+	if q.Origin != "" && !containsString(food.Origins, q.Origin) {
+		return false
+	}
+	if q.MinPrice != nil && food.Price < *q.MinPrice {
+		return false
+	}
+	if q.MaxPrice != nil && food.Price > *q.MaxPrice {
+		return false
+	}
+	if q.MinStars != nil && food.Stars < float64(*q.MinStars) {
+		return false
+	}
+	for _, allergen := range q.ExcludeAllergens {
+		if containsString(food.Allergens, allergen) {
+			return false
+		}
+	}
+	for _, label := range q.DietLabels {
+		if !containsString(food.DietLabels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesText approximates a $text search: some word of text must appear
+// as a whole word in the food's name, tags or origins. Words are split at
+// anything but letters and digits, as $text does, but unlike $text they
+// aren't stemmed and stop words aren't dropped, so "pizzas" doesn't find
+// "pizza" here while "the" can match.
+func matchesText(food Food, text string) bool {
+	indexed := map[string]bool{}
+	for _, field := range append([]string{food.Name}, append(food.Tags, food.Origins...)...) {
+		for _, word := range textWords(field) {
+			indexed[word] = true
+		}
+	}
+	for _, word := range textWords(text) {
+		if indexed[word] {
+			return true
+		}
+	}
+	return false
+}
+
+// textWords splits s into lower-case words of letters and digits
+func textWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// FacetCount is the number of foods sharing a tag, origin or star rating.
+type FacetCount struct {
+	Value interface{} `json:"value" bson:"_id"`
+	Count int         `json:"count" bson:"count"`
+}
+
+// PriceBucket is the number of foods priced in [Min, Max). Max is nil for
+// the open-ended top bucket.
+type PriceBucket struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max"`
+	Count int      `json:"count"`
+}
+
+// FoodFacets holds the facet counts for the foods matching a FoodQuery.
+type FoodFacets struct {
+	Tags        []FacetCount  `json:"tags"`
+	Origins     []FacetCount  `json:"origins"`
+	PriceRanges []PriceBucket `json:"priceRanges"`
+	Stars       []FacetCount  `json:"stars"`
+}
+
+// FacetPipeline builds the aggregation pipeline that computes FoodFacets
+// for the query. Decode its single result with DecodeFacets.
+func (q FoodQuery) FacetPipeline() []bson.M {
+	countBy := func(field string, unwind bool, key interface{}) []bson.M {
+		stages := []bson.M{}
+		if unwind {
+			stages = append(stages, bson.M{"$unwind": "$" + field})
+		}
+		return append(stages,
+			bson.M{"$group": bson.M{"_id": key, "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		)
+	}
+
+	return []bson.M{
+		{"$match": q.Filter()},
+		{"$facet": bson.M{
+			"tags":    countBy("tags", true, "$tags"),
+			"origins": countBy("origins", true, "$origins"),
+			"stars":   countBy("stars", false, bson.M{"$floor": "$stars"}),
+			"prices": []bson.M{
+				{"$bucket": bson.M{
+					// Raising prices below the first boundary to it keeps
+					// them out of the open bucket, as priceBucketIndex does
+					"groupBy":    bson.M{"$max": bson.A{"$price", PriceBucketBoundaries[0]}},
+					"boundaries": PriceBucketBoundaries,
+					"default":    "open",
+					"output":     bson.M{"count": bson.M{"$sum": 1}},
+				}},
+			},
+		}},
+	}
+}
+
+// FacetResult is the raw document produced by FacetPipeline.
+type FacetResult struct {
+	Tags    []FacetCount `bson:"tags"`
+	Origins []FacetCount `bson:"origins"`
+	Stars   []FacetCount `bson:"stars"`
+	Prices  []struct {
+		ID    interface{} `bson:"_id"`
+		Count int         `bson:"count"`
+	} `bson:"prices"`
+}
+
+// DecodeFacets converts the aggregation output into FoodFacets.
+func (r FacetResult) DecodeFacets() FoodFacets {
+	counts := make([]int, len(PriceBucketBoundaries))
+	for _, p := range r.Prices {
+		idx := len(PriceBucketBoundaries) - 1
+		if lower, ok := toFloat(p.ID); ok {
+			idx = sort.SearchFloat64s(PriceBucketBoundaries, lower)
+		}
+		counts[idx] += p.Count
+	}
+
+	for i := range r.Stars {
+		if v, ok := toFloat(r.Stars[i].Value); ok {
+			r.Stars[i].Value = int(v)
+		}
+	}
+
+	return FoodFacets{
+		Tags:        nonNil(r.Tags),
+		Origins:     nonNil(r.Origins),
+		PriceRanges: priceBuckets(counts),
+		Stars:       nonNil(r.Stars),
+	}
+}
+
+// ComputeFoodFacets computes the same facets as FacetPipeline over foods
+// already held in memory.
+func ComputeFoodFacets(foods []Food, q FoodQuery) FoodFacets {
+	tags := map[interface{}]int{}
+	origins := map[interface{}]int{}
+	stars := map[interface{}]int{}
+	counts := make([]int, len(PriceBucketBoundaries))
+
+	for _, food := range foods {
+		if !q.Matches(food) {
+			continue
+		}
+		for _, tag := range food.Tags {
+			tags[tag]++
+		}
+		for _, origin := range food.Origins {
+			origins[origin]++
+		}
+		stars[int(math.Floor(food.Stars))]++
+		counts[priceBucketIndex(food.Price)]++
+	}
+
+	return FoodFacets{
+		Tags:        sortedCounts(tags),
+		Origins:     sortedCounts(origins),
+		PriceRanges: priceBuckets(counts),
+		Stars:       sortedCounts(stars),
+	}
+}
+
+// priceBucketIndex mirrors FacetPipeline's $bucket: values below the first
+// boundary land in the first bucket and values at or above the last one in
+// the open bucket.
+func priceBucketIndex(price float64) int {
+	last := len(PriceBucketBoundaries) - 1
+	if price < PriceBucketBoundaries[0] {
+		return 0
+	}
+	if price >= PriceBucketBoundaries[last] {
+		return last
+	}
+	return sort.Search(last, func(i int) bool { return PriceBucketBoundaries[i+1] > price })
+}
+
+func priceBuckets(counts []int) []PriceBucket {
+	buckets := make([]PriceBucket, len(PriceBucketBoundaries))
+	for i, lower := range PriceBucketBoundaries {
+		buckets[i] = PriceBucket{Min: lower, Count: counts[i]}
+		if i+1 < len(PriceBucketBoundaries) {
+			upper := PriceBucketBoundaries[i+1]
+			buckets[i].Max = &upper
+		}
+	}
+	return buckets
+}
+
+func sortedCounts(m map[interface{}]int) []FacetCount {
+	out := make([]FacetCount, 0, len(m))
+	for value, count := range m {
+		out = append(out, FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return lessValue(out[i].Value, out[j].Value)
+	})
+	return out
+}
+
+func lessValue(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return x < y
+		}
+	}
+	x, _ := a.(string)
+	y, _ := b.(string)
+	return x < y
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func nonNil(counts []FacetCount) []FacetCount {
+	if counts == nil {
+		return []FacetCount{}
+	}
+	return counts
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// ImageVariant is one stored rendition of an uploaded image.
+type ImageVariant struct {
+	Size   string `json:"size" bson:"size" gorm:"type:varchar(20);not null"`
+	Format string `json:"format" bson:"format" gorm:"type:varchar(10);not null"`
+	URL    string `json:"url" bson:"url" gorm:"type:varchar(255);not null"`
+	Key    string `json:"-" bson:"key" gorm:"type:varchar(255);not null"`
+	Width  int    `json:"width" bson:"width" gorm:"not null"`
+	Height int    `json:"height" bson:"height" gorm:"not null"`
+}
+
+type FoodImage struct {
+	ID         string         `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	Variants   []ImageVariant `json:"variants" bson:"variants" gorm:"serializer:json"`
+	UploadedBy string         `json:"uploadedBy" bson:"uploadedBy" gorm:"type:varchar(24)"`
+	CreatedAt  time.Time      `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+}
+
+// URLFor returns the URL of the variant with the given size and format.
+func (img FoodImage) URLFor(size, format string) string {
+	for _, v := range img.Variants {
+		if v.Size == size && v.Format == format {
+			return v.URL
+		}
+	}
+	return ""
+}
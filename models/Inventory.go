@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+const (
+	StockTargetFood       = "food"
+	StockTargetIngredient = "ingredient"
+)
+
+type Ingredient struct {
+	ID                string    `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	StoreID           string    `json:"storeId" bson:"storeId" gorm:"type:varchar(24);index;not null"`
+	Name              string    `json:"name" bson:"name" gorm:"type:varchar(100);not null"`
+	Unit              string    `json:"unit" bson:"unit" gorm:"type:varchar(20)"`
+	Stock             float64   `json:"stock" bson:"stock" gorm:"default:0"`
+	LowStockThreshold float64   `json:"lowStockThreshold" bson:"lowStockThreshold" gorm:"default:0"`
+	CreatedAt         time.Time `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt         time.Time `json:"updatedAt" bson:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// FoodIngredient is the amount of an ingredient used by one portion of a food.
+type FoodIngredient struct {
+	IngredientID string  `json:"ingredientId" bson:"ingredientId" gorm:"type:varchar(24)"`
+	Quantity     float64 `json:"quantity" bson:"quantity" gorm:"not null"`
+}
+
+// StockAdjustment is an audit record of a change to a food's or an
+// ingredient's stock level.
+type StockAdjustment struct {
+	ID         string    `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	StoreID    string    `json:"storeId" bson:"storeId" gorm:"type:varchar(24);index;not null"`
+	TargetType string    `json:"targetType" bson:"targetType" gorm:"type:varchar(20);not null"`
+	TargetID   string    `json:"targetId" bson:"targetId" gorm:"type:varchar(24);index;not null"`
+	Delta      float64   `json:"delta" bson:"delta" gorm:"not null"`
+	StockAfter float64   `json:"stockAfter" bson:"stockAfter" gorm:"not null"`
+	Reason     string    `json:"reason" bson:"reason" gorm:"type:varchar(255)"`
+	AdjustedBy string    `json:"adjustedBy" bson:"adjustedBy" gorm:"type:varchar(24)"`
+	OrderID    string    `json:"orderId" bson:"orderId" gorm:"type:varchar(24)"`
+	CreatedAt  time.Time `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+}
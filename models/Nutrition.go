@@ -0,0 +1,77 @@
+package models
+
+import "fmt"
+
+// Nutrition holds the nutrition facts of one serving. Macros are in grams.
+type Nutrition struct {
+	Calories      float64 `json:"calories" bson:"calories"`
+	Protein       float64 `json:"protein" bson:"protein"`
+	Carbohydrates float64 `json:"carbohydrates" bson:"carbohydrates"`
+	Sugar         float64 `json:"sugar" bson:"sugar"`
+	Fat           float64 `json:"fat" bson:"fat"`
+	SaturatedFat  float64 `json:"saturatedFat" bson:"saturatedFat"`
+	Fiber         float64 `json:"fiber" bson:"fiber"`
+	Salt          float64 `json:"salt" bson:"salt"`
+}
+
+// Allergens are the 14 allergens that must be declared on food sold in the
+// EU and UK.
+var Allergens = []string{
+	"celery", "gluten", "crustaceans", "eggs", "fish", "lupin", "milk",
+	"molluscs", "mustard", "tree-nuts", "peanuts", "sesame", "soy", "sulphites",
+}
+
+// DietLabels are the dietary labels a food can carry.
+var DietLabels = []string{
+	"vegetarian", "vegan", "halal", "kosher", "gluten-free", "dairy-free", "nut-free",
+}
+
+// validateDietary checks a food's nutrition facts, allergens and labels.
+func (f *Food) validateDietary() error {
+	if n := f.Nutrition; n != nil {
+		for _, v := range []float64{n.Calories, n.Protein, n.Carbohydrates, n.Sugar, n.Fat, n.SaturatedFat, n.Fiber, n.Salt} {
+			if v < 0 {
+				return fmt.Errorf("nutrition values must not be negative")
+			}
+		}
+	}
+	if err := ValidateAllergens(f.Allergens); err != nil {
+		return err
+	}
+	for _, label := range f.DietLabels {
+		if !containsString(DietLabels, label) {
+			return fmt.Errorf("unknown diet label %q", label)
+		}
+	}
+	return nil
+}
+
+// AllergenConflicts returns the food's allergens that appear in a user's
+// allergen profile.
+func (f Food) AllergenConflicts(profile []string) []string {
+	conflicts := []string{}
+	for _, allergen := range f.Allergens {
+		if containsString(profile, allergen) {
+			conflicts = append(conflicts, allergen)
+		}
+	}
+	return conflicts
+}
+
+// AllergenWarning flags a food that contains allergens from the user's
+// profile.
+type AllergenWarning struct {
+	FoodID    string   `json:"foodId"`
+	Name      string   `json:"name"`
+	Allergens []string `json:"allergens"`
+}
+
+// ValidateAllergens checks an allergen profile.
+func ValidateAllergens(profile []string) error {
+	for _, allergen := range profile {
+		if !containsString(Allergens, allergen) {
+			return fmt.Errorf("unknown allergen %q", allergen)
+		}
+	}
+	return nil
+}
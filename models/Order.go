@@ -7,27 +7,38 @@ import (
 )
 
 type LatLng struct {
-	Lat string `gorm:"type:varchar(50)"`
-	Lng string `gorm:"type:varchar(50)"`
+	Lat string `json:"lat" bson:"lat" gorm:"type:varchar(50)"`
+	Lng string `json:"lng" bson:"lng" gorm:"type:varchar(50)"`
 }
 
 type OrderItem struct {
-	Food     Food    `gorm:"embedded"`
-	Price    float64 `gorm:"not null"`
-	Quantity int     `gorm:"not null"`
+	Food        Food                `json:"food" bson:"food" gorm:"embedded"`
+	BasePrice   float64             `json:"basePrice" bson:"basePrice" gorm:"not null"`
+	PromotionID string              `json:"promotionId" bson:"promotionId" gorm:"type:varchar(24)"`
+	VariantID   string              `json:"variantId" bson:"variantId" gorm:"type:varchar(24)"`
+	VariantName string              `json:"variantName" bson:"variantName" gorm:"type:varchar(100)"`
+	Modifiers   []OrderItemModifier `json:"modifiers" bson:"modifiers" gorm:"serializer:json"`
+	UnitPrice   float64             `json:"unitPrice" bson:"unitPrice" gorm:"not null"`
+	Price       float64             `json:"price" bson:"price" gorm:"not null"`
+	Quantity    int                 `json:"quantity" bson:"quantity" gorm:"not null"`
 }
 
 type Order struct {
-	ID            string         `gorm:"type:varchar(24);primaryKey"`
-	Name          string         `gorm:"type:varchar(100);not null"`
-	Address       string         `gorm:"type:varchar(255);not null"`
-	AddressLatLng LatLng         `gorm:"embedded"`
-	TotalPrice    float64        `gorm:"not null"`
-	Items         []OrderItem    `gorm:"foreignKey:OrderID"`
-	Status        string         `gorm:"type:varchar(100);not null"`
-	UserID        string         `gorm:"type:varchar(24);not null"`
-	PaymentID     string         `gorm:"type:varchar(100)"`
-	CreatedAt     time.Time      `gorm:"autoCreateTime"`
-	UpdatedAt     time.Time      `gorm:"autoUpdateTime"`
-	DeletedAt     gorm.DeletedAt `gorm:"index"`
+	ID            string         `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	StoreID       string         `json:"storeId" bson:"storeId" gorm:"type:varchar(24);index;not null"`
+	Name          string         `json:"name" bson:"name" gorm:"type:varchar(100);not null"`
+	Address       string         `json:"address" bson:"address" gorm:"type:varchar(255);not null"`
+	AddressLatLng LatLng         `json:"addressLatLng" bson:"addressLatLng" gorm:"embedded"`
+	DeliveryFee   float64        `json:"deliveryFee" bson:"deliveryFee" gorm:"default:0"`
+	TotalPrice    float64        `json:"totalPrice" bson:"totalPrice" gorm:"not null"`
+	Items         []OrderItem    `json:"items" bson:"items" gorm:"foreignKey:OrderID"`
+	Status        string         `json:"status" bson:"status" gorm:"type:varchar(100);not null"`
+	UserID        string         `json:"userId" bson:"userId" gorm:"type:varchar(24);not null"`
+	PaymentID     string         `json:"paymentId" bson:"paymentId" gorm:"type:varchar(100)"`
+	StockReserved bool           `json:"stockReserved" bson:"stockReserved" gorm:"default:false"`
+	ScheduledFor  *time.Time     `json:"scheduledFor" bson:"scheduledFor" gorm:"index"`
+	ReleasedAt    *time.Time     `json:"releasedAt" bson:"releasedAt" gorm:"index"`
+	CreatedAt     time.Time      `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time      `json:"updatedAt" bson:"updatedAt" gorm:"autoUpdateTime"`
+	DeletedAt     gorm.DeletedAt `json:"deletedAt" bson:"deletedAt" gorm:"index"`
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PasswordReset is a password reset token sent to a user. Only a SHA-256
+// hash of the token is stored, and it can be used once before it expires.
+type PasswordReset struct {
+	ID        string     `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	UserID    string     `json:"userId" bson:"userId" gorm:"type:varchar(24);index;not null"`
+	TokenHash string     `json:"-" bson:"tokenHash" gorm:"type:varchar(64);uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expiresAt" bson:"expiresAt" gorm:"index"`
+	UsedAt    *time.Time `json:"usedAt" bson:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	PriceScheduled = "Scheduled"
+	PriceActive    = "Active"
+	PriceCompleted = "Completed"
+	PriceCancelled = "Cancelled"
+)
+
+// PriceChange records one change to a food's price.
+type PriceChange struct {
+	ID        string    `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	FoodID    string    `json:"foodId" bson:"foodId" gorm:"type:varchar(24);index;not null"`
+	StoreID   string    `json:"storeId" bson:"storeId" gorm:"type:varchar(24);index;not null"`
+	OldPrice  float64   `json:"oldPrice" bson:"oldPrice" gorm:"not null"`
+	NewPrice  float64   `json:"newPrice" bson:"newPrice" gorm:"not null"`
+	ChangedBy string    `json:"changedBy" bson:"changedBy" gorm:"type:varchar(24)"`
+	Reason    string    `json:"reason" bson:"reason" gorm:"type:varchar(100)"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+}
+
+// PriceSchedule changes a food's price at StartsAt. With EndsAt it is a
+// promotion and the regular price comes back when it ends.
+type PriceSchedule struct {
+	ID        string     `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	FoodID    string     `json:"foodId" bson:"foodId" gorm:"type:varchar(24);index;not null"`
+	StoreID   string     `json:"storeId" bson:"storeId" gorm:"type:varchar(24);index;not null"`
+	Price     float64    `json:"price" bson:"price" gorm:"not null"`
+	StartsAt  time.Time  `json:"startsAt" bson:"startsAt" gorm:"index;not null"`
+	EndsAt    *time.Time `json:"endsAt" bson:"endsAt" gorm:"index"`
+	Status    string     `json:"status" bson:"status" gorm:"type:varchar(20);index;not null"`
+	CreatedBy string     `json:"createdBy" bson:"createdBy" gorm:"type:varchar(24)"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt time.Time  `json:"updatedAt" bson:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// IsPromotion reports whether the schedule reverts when it ends.
+func (s PriceSchedule) IsPromotion() bool {
+	return s.EndsAt != nil
+}
+
+// Validate checks a new schedule.
+func (s PriceSchedule) Validate(now time.Time) error {
+	if s.Price < 0 {
+		return fmt.Errorf("price must not be negative")
+	}
+	if s.StartsAt.IsZero() {
+		return fmt.Errorf("startsAt is required")
+	}
+	if s.EndsAt != nil {
+		if !s.EndsAt.After(s.StartsAt) {
+			return fmt.Errorf("endsAt must be after startsAt")
+		}
+		if !s.EndsAt.After(now) {
+			return fmt.Errorf("endsAt must be in the future")
+		}
+	}
+	return nil
+}
+
+// FoodPromotion is the promotion currently setting a food's price.
+type FoodPromotion struct {
+	ScheduleID   string    `json:"scheduleId" bson:"scheduleId" gorm:"type:varchar(24);not null"`
+	RegularPrice float64   `json:"regularPrice" bson:"regularPrice" gorm:"not null"`
+	EndsAt       time.Time `json:"endsAt" bson:"endsAt" gorm:"not null"`
+}
+
+// CurrentPrice returns the price in effect at now and the promotion
+// providing it, if any. A promotion past its end no longer applies even if
+// the scheduler has not reverted it yet.
+func (f Food) CurrentPrice(now time.Time) (float64, string) {
+	if p := f.Promotion; p != nil {
+		if now.Before(p.EndsAt) {
+			return f.Price, p.ScheduleID
+		}
+		return p.RegularPrice, ""
+	}
+	return f.Price, ""
+}
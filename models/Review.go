@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+const (
+	ReviewPending  = "Pending"
+	ReviewApproved = "Approved"
+	ReviewRejected = "Rejected"
+)
+
+type Review struct {
+	ID           string    `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	FoodID       string    `json:"foodId" bson:"foodId" gorm:"type:varchar(24);index;not null"`
+	StoreID      string    `json:"storeId" bson:"storeId" gorm:"type:varchar(24);index;not null"`
+	UserID       string    `json:"userId" bson:"userId" gorm:"type:varchar(24);index;not null"`
+	UserName     string    `json:"userName" bson:"userName" gorm:"type:varchar(100)"`
+	OrderID      string    `json:"orderId" bson:"orderId" gorm:"type:varchar(24);not null"`
+	Rating       int       `json:"rating" bson:"rating" gorm:"not null"`
+	Comment      string    `json:"comment" bson:"comment" gorm:"type:text"`
+	Images       []string  `json:"images" bson:"images" gorm:"serializer:json"`
+	Status       string    `json:"status" bson:"status" gorm:"type:varchar(20);not null"`
+	HelpfulVotes int       `json:"helpfulVotes" bson:"helpfulVotes" gorm:"default:0"`
+	HelpfulBy    []string  `json:"-" bson:"helpfulBy" gorm:"-"`
+	ModeratedBy  string    `json:"moderatedBy" bson:"moderatedBy" gorm:"type:varchar(24)"`
+	CreatedAt    time.Time `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `json:"updatedAt" bson:"updatedAt" gorm:"autoUpdateTime"`
+}
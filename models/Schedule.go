@@ -0,0 +1,223 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const clockLayout = "15:04"
+
+// DayHours are the opening hours for one weekday (0 is Sunday). A Close
+// earlier than Open means the store closes after midnight.
+type DayHours struct {
+	Weekday int    `json:"weekday" bson:"weekday" gorm:"not null"`
+	Open    string `json:"open" bson:"open" gorm:"type:varchar(5);not null"`
+	Close   string `json:"close" bson:"close" gorm:"type:varchar(5);not null"`
+}
+
+// HolidayException overrides the weekly hours on a single date
+// (YYYY-MM-DD), either closing the store or setting special hours.
+type HolidayException struct {
+	Date   string `json:"date" bson:"date" gorm:"type:varchar(10);not null"`
+	Closed bool   `json:"closed" bson:"closed" gorm:"default:false"`
+	Open   string `json:"open" bson:"open" gorm:"type:varchar(5)"`
+	Close  string `json:"close" bson:"close" gorm:"type:varchar(5)"`
+	Note   string `json:"note" bson:"note" gorm:"type:varchar(255)"`
+}
+
+// StoreSchedule holds the store's opening hours and the fulfillment slots
+// offered for scheduled orders. A schedule without any opening hours is
+// treated as always open.
+type StoreSchedule struct {
+	TimeZone       string             `json:"timeZone" bson:"timeZone" gorm:"type:varchar(64)"`
+	OpeningHours   []DayHours         `json:"openingHours" bson:"openingHours" gorm:"serializer:json"`
+	Exceptions     []HolidayException `json:"exceptions" bson:"exceptions" gorm:"serializer:json"`
+	SlotMinutes    int                `json:"slotMinutes" bson:"slotMinutes" gorm:"default:15"`
+	SlotCapacity   int                `json:"slotCapacity" bson:"slotCapacity" gorm:"default:0"`
+	MaxAdvanceDays int                `json:"maxAdvanceDays" bson:"maxAdvanceDays" gorm:"default:7"`
+}
+
+// TimeWindow restricts when a food can be ordered, e.g. breakfast items in
+// the morning. Empty Days means every day.
+type TimeWindow struct {
+	Days  []int  `json:"days" bson:"days" gorm:"serializer:json"`
+	Start string `json:"start" bson:"start" gorm:"type:varchar(5);not null"`
+	End   string `json:"end" bson:"end" gorm:"type:varchar(5);not null"`
+}
+
+// Location returns the schedule's time zone, defaulting to UTC.
+func (s StoreSchedule) Location() *time.Location {
+	if s.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Validate checks time formats, weekdays, dates and the time zone.
+func (s StoreSchedule) Validate() error {
+	if s.TimeZone != "" {
+		if _, err := time.LoadLocation(s.TimeZone); err != nil {
+			return fmt.Errorf("unknown time zone %q", s.TimeZone)
+		}
+	}
+	if s.SlotMinutes < 0 || s.SlotMinutes > 24*60 || s.SlotCapacity < 0 || s.MaxAdvanceDays < 0 {
+		return fmt.Errorf("invalid slot settings")
+	}
+	for _, h := range s.OpeningHours {
+		if h.Weekday < 0 || h.Weekday > 6 {
+			return fmt.Errorf("weekday must be between 0 and 6")
+		}
+		if err := validateClock(h.Open, h.Close); err != nil {
+			return err
+		}
+	}
+	for _, e := range s.Exceptions {
+		if _, err := time.Parse("2006-01-02", e.Date); err != nil {
+			return fmt.Errorf("invalid exception date %q", e.Date)
+		}
+		if !e.Closed {
+			if err := validateClock(e.Open, e.Close); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IsOpen reports whether the store is open at t.
+func (s StoreSchedule) IsOpen(t time.Time) bool {
+	if len(s.OpeningHours) == 0 {
+		return true
+	}
+	t = t.In(s.Location())
+
+	// Hours that started yesterday and run past midnight still count today.
+	for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+		for _, window := range s.windowsOn(day) {
+			if inWindow(t, day, window[0], window[1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SlotLength is the length of a fulfillment slot, 15 minutes by default.
+func (s StoreSchedule) SlotLength() time.Duration {
+	if s.SlotMinutes <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(s.SlotMinutes) * time.Minute
+}
+
+// SlotStart returns the start of the slot containing t. Slots are counted
+// from local midnight.
+func (s StoreSchedule) SlotStart(t time.Time) time.Time {
+	t = t.In(s.Location())
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return midnight.Add(t.Sub(midnight) / s.SlotLength() * s.SlotLength())
+}
+
+// SlotsOn lists the starts of the slots on date (YYYY-MM-DD) during which
+// the store is open.
+func (s StoreSchedule) SlotsOn(date string) ([]time.Time, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, s.Location())
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q", date)
+	}
+
+	slots := []time.Time{}
+	for t := day; t.Before(day.AddDate(0, 0, 1)); t = t.Add(s.SlotLength()) {
+		if s.IsOpen(t) {
+			slots = append(slots, t)
+		}
+	}
+	return slots, nil
+}
+
+func (s StoreSchedule) windowsOn(day time.Time) [][2]string {
+	date := day.Format("2006-01-02")
+	for _, e := range s.Exceptions {
+		if e.Date == date {
+			if e.Closed {
+				return nil
+			}
+			return [][2]string{{e.Open, e.Close}}
+		}
+	}
+
+	windows := [][2]string{}
+	for _, h := range s.OpeningHours {
+		if h.Weekday == int(day.Weekday()) {
+			windows = append(windows, [2]string{h.Open, h.Close})
+		}
+	}
+	return windows
+}
+
+// Validate checks the window's times and days.
+func (w TimeWindow) Validate() error {
+	for _, d := range w.Days {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("weekday must be between 0 and 6")
+		}
+	}
+	return validateClock(w.Start, w.End)
+}
+
+// AvailableAt reports whether the food can be ordered at t in loc. Foods
+// without availability windows are always available.
+func (f Food) AvailableAt(t time.Time, loc *time.Location) bool {
+	if len(f.AvailabilityWindows) == 0 {
+		return true
+	}
+	t = t.In(loc)
+
+	for _, w := range f.AvailabilityWindows {
+		for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+			if (len(w.Days) == 0 || containsInt(w.Days, int(day.Weekday()))) && inWindow(t, day, w.Start, w.End) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inWindow reports whether t falls in the window that opens at start on day.
+func inWindow(t, day time.Time, start, end string) bool {
+	open, err1 := time.Parse(clockLayout, start)
+	close, err2 := time.Parse(clockLayout, end)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	from := time.Date(day.Year(), day.Month(), day.Day(), open.Hour(), open.Minute(), 0, 0, t.Location())
+	to := time.Date(day.Year(), day.Month(), day.Day(), close.Hour(), close.Minute(), 0, 0, t.Location())
+	if !to.After(from) {
+		to = to.AddDate(0, 0, 1)
+	}
+	return !t.Before(from) && t.Before(to)
+}
+
+func validateClock(start, end string) error {
+	if _, err := time.Parse(clockLayout, start); err != nil {
+		return fmt.Errorf("invalid time %q, expected HH:MM", start)
+	}
+	if _, err := time.Parse(clockLayout, end); err != nil {
+		return fmt.Errorf("invalid time %q, expected HH:MM", end)
+	}
+	return nil
+}
+
+func containsInt(values []int, n int) bool {
+	for _, v := range values {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"gorm.io/gorm"
+)
+
+// Where each model keeps its gorm.DeletedAt in Mongo.
+const (
+	FoodDeletedAt  = "deletedAt"
+	UserDeletedAt  = "deletedAt"
+	OrderDeletedAt = "deletedAt"
+)
+
+// NotDeleted adds a condition excluding soft-deleted documents to filter
+// and returns it. deletedAt is one of the *DeletedAt paths.
+func NotDeleted(filter bson.M, deletedAt string) bson.M {
+	filter[deletedAt+".valid"] = bson.M{"$ne": true}
+	return filter
+}
+
+// Deleted adds a condition matching only soft-deleted documents.
+func Deleted(filter bson.M, deletedAt string) bson.M {
+	filter[deletedAt+".valid"] = true
+	return filter
+}
+
+// DeletedBefore matches soft-deleted documents deleted before cutoff.
+func DeletedBefore(cutoff time.Time, deletedAt string) bson.M {
+	return bson.M{deletedAt + ".valid": true, deletedAt + ".time": bson.M{"$lt": cutoff}}
+}
+
+// DeletedNow is the DeletedAt value that soft-deletes a document.
+func DeletedNow(now time.Time) gorm.DeletedAt {
+	return gorm.DeletedAt{Time: now, Valid: true}
+}
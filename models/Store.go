@@ -0,0 +1,99 @@
+package models
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// DefaultStoreID is the store that unscoped routes and pre-existing data
+// belong to.
+const DefaultStoreID = "default"
+
+const (
+	StaffManager = "manager"
+	StaffMember  = "staff"
+)
+
+// DeliveryZone is a circular area around Center that the store delivers to.
+type DeliveryZone struct {
+	Name        string  `json:"name" bson:"name" gorm:"type:varchar(100)"`
+	Center      LatLng  `json:"center" bson:"center" gorm:"embedded"`
+	RadiusKm    float64 `json:"radiusKm" bson:"radiusKm" gorm:"not null"`
+	DeliveryFee float64 `json:"deliveryFee" bson:"deliveryFee" gorm:"default:0"`
+}
+
+type StoreStaff struct {
+	UserID string `json:"userId" bson:"userId" gorm:"type:varchar(24);not null"`
+	Role   string `json:"role" bson:"role" gorm:"type:varchar(20);not null"`
+}
+
+type Store struct {
+	ID            string         `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	Name          string         `json:"name" bson:"name" gorm:"type:varchar(100);not null"`
+	Slug          string         `json:"slug" bson:"slug" gorm:"type:varchar(100);uniqueIndex;not null"`
+	Address       string         `json:"address" bson:"address" gorm:"type:varchar(255)"`
+	Phone         string         `json:"phone" bson:"phone" gorm:"type:varchar(50)"`
+	Schedule      StoreSchedule  `json:"schedule" bson:"schedule" gorm:"serializer:json"`
+	DeliveryZones []DeliveryZone `json:"deliveryZones" bson:"deliveryZones" gorm:"serializer:json"`
+	Staff         []StoreStaff   `json:"staff" bson:"staff" gorm:"serializer:json"`
+	CreatedAt     time.Time      `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time      `json:"updatedAt" bson:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// HasStaff reports whether the user works at the store in one of roles, or
+// in any role when none are given.
+func (s Store) HasStaff(userID string, roles ...string) bool {
+	for _, member := range s.Staff {
+		if member.UserID != userID {
+			continue
+		}
+		if len(roles) == 0 {
+			return true
+		}
+		for _, role := range roles {
+			if member.Role == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ZoneFor returns the cheapest delivery zone covering the address. A store
+// without zones delivers everywhere for free.
+func (s Store) ZoneFor(address LatLng) (*DeliveryZone, bool) {
+	if len(s.DeliveryZones) == 0 {
+		return nil, true
+	}
+
+	var best *DeliveryZone
+	for i, zone := range s.DeliveryZones {
+		distance, ok := distanceKm(zone.Center, address)
+		if !ok || distance > zone.RadiusKm {
+			continue
+		}
+		if best == nil || zone.DeliveryFee < best.DeliveryFee {
+			best = &s.DeliveryZones[i]
+		}
+	}
+	return best, best != nil
+}
+
+// distanceKm is the great-circle distance between two points.
+func distanceKm(a, b LatLng) (float64, bool) {
+	lat1, err1 := strconv.ParseFloat(a.Lat, 64)
+	lng1, err2 := strconv.ParseFloat(a.Lng, 64)
+	lat2, err3 := strconv.ParseFloat(b.Lat, 64)
+	lng2, err4 := strconv.ParseFloat(b.Lng, 64)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return 0, false
+	}
+
+	const earthRadiusKm = 6371.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h)), true
+}
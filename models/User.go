@@ -7,14 +7,21 @@ import (
 )
 
 type User struct {
-	ID        string         `gorm:"type:varchar(24);primaryKey"`
-	Name      string         `gorm:"type:varchar(100);not null"`
-	Email     string         `gorm:"type:varchar(100);uniqueIndex;not null"`
-	Password  string         `gorm:"type:varchar(100);not null"`
-	Address   string         `gorm:"type:varchar(255);not null"`
-	IsAdmin   bool           `gorm:"default:false"`
-	IsBlocked bool           `gorm:"default:false"`
-	CreatedAt time.Time      `gorm:"autoCreateTime"`
-	UpdatedAt time.Time      `gorm:"autoUpdateTime"`
-	DeletedAt gorm.DeletedAt `gorm:"index"`
+	ID            string   `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	Name          string   `json:"name" bson:"name" gorm:"type:varchar(100);not null"`
+	Email         string   `json:"email" bson:"email" gorm:"type:varchar(100);uniqueIndex:idx_users_email,where:deleted_at IS NULL;not null"`
+	Password      string   `json:"-" bson:"password" gorm:"type:varchar(100);not null"`
+	Address       string   `json:"address" bson:"address" gorm:"type:varchar(255);not null"`
+	IsAdmin       bool     `json:"isAdmin" bson:"isAdmin" gorm:"default:false"`
+	EmailVerified bool     `json:"emailVerified" bson:"emailVerified" gorm:"default:false"`
+	IsBlocked     bool     `json:"isBlocked" bson:"isBlocked" gorm:"default:false"`
+	IsSuperAdmin  bool     `json:"isSuperAdmin" bson:"isSuperAdmin" gorm:"default:false"`
+	Allergens     []string `json:"allergens" bson:"allergens" gorm:"serializer:json"`
+	// TokenVersion is signed into login tokens. Bumping it revokes every
+	// token issued before.
+	TokenVersion int            `json:"-" bson:"tokenVersion" gorm:"default:0"`
+	Locale       string         `json:"locale" bson:"locale" gorm:"type:varchar(10)"`
+	CreatedAt    time.Time      `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time      `json:"updatedAt" bson:"updatedAt" gorm:"autoUpdateTime"`
+	DeletedAt    gorm.DeletedAt `json:"deletedAt" bson:"deletedAt" gorm:"index"`
 }
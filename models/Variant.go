@@ -0,0 +1,142 @@
+package models
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FoodVariant is a sellable size or version of a food with its own price.
+type FoodVariant struct {
+	ID    string  `json:"id" bson:"id" gorm:"type:varchar(24)"`
+	Name  string  `json:"name" bson:"name" gorm:"type:varchar(100);not null"`
+	Price float64 `json:"price" bson:"price" gorm:"not null"`
+	SKU   string  `json:"sku" bson:"sku" gorm:"type:varchar(100)"`
+}
+
+// ModifierOption is a single choice within a modifier group, such as
+// "extra cheese", priced on top of the food or variant.
+type ModifierOption struct {
+	ID    string  `json:"id" bson:"id" gorm:"type:varchar(24)"`
+	Name  string  `json:"name" bson:"name" gorm:"type:varchar(100);not null"`
+	Price float64 `json:"price" bson:"price" gorm:"default:0"`
+}
+
+// ModifierGroup is a set of options of which a customer must pick between
+// MinSelect and MaxSelect.
+type ModifierGroup struct {
+	ID        string           `json:"id" bson:"id" gorm:"type:varchar(24)"`
+	Name      string           `json:"name" bson:"name" gorm:"type:varchar(100);not null"`
+	MinSelect int              `json:"minSelect" bson:"minSelect" gorm:"default:0"`
+	MaxSelect int              `json:"maxSelect" bson:"maxSelect" gorm:"default:1"`
+	Options   []ModifierOption `json:"options" bson:"options" gorm:"serializer:json"`
+}
+
+// OrderItemModifier records a modifier option chosen for an order item.
+type OrderItemModifier struct {
+	GroupID  string  `json:"groupId" bson:"groupId" gorm:"type:varchar(24)"`
+	OptionID string  `json:"optionId" bson:"optionId" gorm:"type:varchar(24)"`
+	Name     string  `json:"name" bson:"name" gorm:"type:varchar(100)"`
+	Price    float64 `json:"price" bson:"price" gorm:"default:0"`
+}
+
+// NormalizeOptions assigns IDs to new variants, groups and options and
+// checks that the selection rules can be satisfied.
+func (f *Food) NormalizeOptions() error {
+	seen := map[string]bool{}
+	assign := func(id *string) error {
+		if *id == "" {
+			*id = primitive.NewObjectID().Hex()
+		}
+		if seen[*id] {
+			return fmt.Errorf("duplicate option ID %q", *id)
+		}
+		seen[*id] = true
+		return nil
+	}
+
+	for i := range f.Variants {
+		v := &f.Variants[i]
+		if v.Name == "" || v.Price < 0 {
+			return fmt.Errorf("variant %d needs a name and a non-negative price", i+1)
+		}
+		if err := assign(&v.ID); err != nil {
+			return err
+		}
+	}
+
+	for i := range f.ModifierGroups {
+		g := &f.ModifierGroups[i]
+		if err := assign(&g.ID); err != nil {
+			return err
+		}
+		if g.MinSelect < 0 || g.MaxSelect < g.MinSelect || g.MaxSelect > len(g.Options) {
+			return fmt.Errorf("modifier group %q must have 0 <= min <= max <= %d", g.Name, len(g.Options))
+		}
+		for j := range g.Options {
+			o := &g.Options[j]
+			if o.Name == "" || o.Price < 0 {
+				return fmt.Errorf("option %d of %q needs a name and a non-negative price", j+1, g.Name)
+			}
+			if err := assign(&o.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PriceFor validates a variant and modifier selection against the food's
+// menu definition and returns the unit price together with the modifiers
+// as priced on the menu.
+func (f Food) PriceFor(variantID string, selected []OrderItemModifier) (float64, *FoodVariant, []OrderItemModifier, error) {
+	price := f.Price
+	var variant *FoodVariant
+
+	switch {
+	case len(f.Variants) > 0 && variantID == "":
+		return 0, nil, nil, fmt.Errorf("%s: a variant must be chosen", f.Name)
+	case len(f.Variants) == 0 && variantID != "":
+		return 0, nil, nil, fmt.Errorf("%s has no variants", f.Name)
+	}
+	for i := range f.Variants {
+		if f.Variants[i].ID == variantID {
+			variant = &f.Variants[i]
+			price = variant.Price
+		}
+	}
+	if variantID != "" && variant == nil {
+		return 0, nil, nil, fmt.Errorf("%s: unknown variant %q", f.Name, variantID)
+	}
+
+	picked := map[string]bool{}
+	for _, m := range selected {
+		key := m.GroupID + "/" + m.OptionID
+		if picked[key] {
+			return 0, nil, nil, fmt.Errorf("%s: option %q chosen twice", f.Name, m.OptionID)
+		}
+		picked[key] = true
+	}
+
+	modifiers := []OrderItemModifier{}
+	for _, g := range f.ModifierGroups {
+		count := 0
+		for _, o := range g.Options {
+			if !picked[g.ID+"/"+o.ID] {
+				continue
+			}
+			delete(picked, g.ID+"/"+o.ID)
+			count++
+			price += o.Price
+			modifiers = append(modifiers, OrderItemModifier{GroupID: g.ID, OptionID: o.ID, Name: o.Name, Price: o.Price})
+		}
+		if count < g.MinSelect || count > g.MaxSelect {
+			return 0, nil, nil, fmt.Errorf("%s: choose between %d and %d of %q", f.Name, g.MinSelect, g.MaxSelect, g.Name)
+		}
+	}
+	for key := range picked {
+		return 0, nil, nil, fmt.Errorf("%s: unknown modifier %q", f.Name, key)
+	}
+
+	return price, variant, modifiers, nil
+}
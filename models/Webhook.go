@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+const (
+	DeliveryPending    = "Pending"
+	DeliverySucceeded  = "Succeeded"
+	DeliveryDeadLetter = "DeadLetter"
+)
+
+// Webhook is an integrator's endpoint that is sent a store's events.
+// An empty EventTypes subscribes it to every webhook event type.
+type Webhook struct {
+	ID         string   `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	StoreID    string   `json:"storeId" bson:"storeId" gorm:"type:varchar(24);index;not null"`
+	URL        string   `json:"url" bson:"url" gorm:"type:varchar(255);not null"`
+	EventTypes []string `json:"eventTypes" bson:"eventTypes" gorm:"serializer:json"`
+	Active     bool     `json:"active" bson:"active" gorm:"not null"`
+	// Secret signs the deliveries. It is only shown when the webhook is
+	// created.
+	Secret    string    `json:"-" bson:"secret" gorm:"type:varchar(64);not null"`
+	CreatedBy string    `json:"createdBy" bson:"createdBy" gorm:"type:varchar(24)"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook. Payload
+// is the exact request body, so redeliveries are identical.
+type WebhookDelivery struct {
+	ID             string     `json:"id" bson:"id" gorm:"type:varchar(24);primaryKey"`
+	WebhookID      string     `json:"webhookId" bson:"webhookId" gorm:"type:varchar(24);uniqueIndex:idx_webhook_event;not null"`
+	StoreID        string     `json:"storeId" bson:"storeId" gorm:"type:varchar(24);index;not null"`
+	EventID        string     `json:"eventId" bson:"eventId" gorm:"type:varchar(24);uniqueIndex:idx_webhook_event;not null"`
+	EventType      string     `json:"eventType" bson:"eventType" gorm:"type:varchar(100);not null"`
+	Payload        string     `json:"payload" bson:"payload" gorm:"type:text;not null"`
+	Status         string     `json:"status" bson:"status" gorm:"type:varchar(20);not null"`
+	Attempts       int        `json:"attempts" bson:"attempts" gorm:"default:0"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt" bson:"nextAttemptAt" gorm:"index"`
+	LastAttemptAt  *time.Time `json:"lastAttemptAt" bson:"lastAttemptAt"`
+	LastStatusCode int        `json:"lastStatusCode" bson:"lastStatusCode"`
+	LastError      string     `json:"lastError" bson:"lastError" gorm:"type:text"`
+	CreatedAt      time.Time  `json:"createdAt" bson:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time  `json:"updatedAt" bson:"updatedAt" gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,588 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gorm.io/gorm"
+)
+
+var testTime = time.Date(2024, 3, 1, 18, 30, 0, 0, time.UTC)
+
+func testFood() Food {
+	return Food{
+		ID:       primitive.NewObjectID(),
+		StoreID:  DefaultStoreID,
+		Name:     "Pizza",
+		SKU:      "PZ-1",
+		Price:    9.5,
+		Tags:     []string{"italian"},
+		ImageUrl: "/images/pizza.jpg",
+		Origins:  []string{"italy"},
+		CookTime: "20-30",
+		Variants: []FoodVariant{{ID: "large", Name: "Large", Price: 12, SKU: "PZ-1-L"}},
+		ModifierGroups: []ModifierGroup{{
+			ID: "extras", Name: "Extras", MinSelect: 0, MaxSelect: 2,
+			Options: []ModifierOption{{ID: "cheese", Name: "Cheese", Price: 1}},
+		}},
+		AvailabilityWindows: []TimeWindow{{Days: []int{5, 6}, Start: "18:00", End: "02:00"}},
+		Promotion:           &FoodPromotion{ScheduleID: "sched", RegularPrice: 11, EndsAt: testTime},
+		Categories:          []CategoryPlacement{{CategoryID: "mains", Position: 2}},
+		Nutrition:           &Nutrition{Calories: 800, SaturatedFat: 9},
+		Allergens:           []string{"gluten", "milk"},
+		DietLabels:          []string{"vegetarian"},
+		Images: []FoodImage{{
+			ID:         "img",
+			Variants:   []ImageVariant{{Size: "thumb", Format: "webp", URL: "/images/img-thumb.webp", Width: 200, Height: 200}},
+			UploadedBy: "admin",
+			CreatedAt:  testTime,
+		}},
+		TrackStock:        true,
+		Stock:             4,
+		LowStockThreshold: 5,
+		Ingredients:       []FoodIngredient{{IngredientID: "dough", Quantity: 0.25}},
+		RatingCount:       2,
+		RatingSum:         9,
+		Stars:             4.5,
+		Version:           3,
+		CreatedAt:         testTime,
+		UpdatedAt:         testTime,
+		DeletedAt:         gorm.DeletedAt{Time: testTime, Valid: true},
+	}
+}
+
+func testOrder() Order {
+	scheduled := testTime.Add(time.Hour)
+	return Order{
+		ID:            primitive.NewObjectID().Hex(),
+		StoreID:       DefaultStoreID,
+		Name:          "Ada",
+		Address:       "1 Main St",
+		AddressLatLng: LatLng{Lat: "51.5", Lng: "-0.1"},
+		DeliveryFee:   2,
+		TotalPrice:    27,
+		Items: []OrderItem{{
+			Food:        testFood(),
+			BasePrice:   9.5,
+			PromotionID: "sched",
+			VariantID:   "large",
+			VariantName: "Large",
+			Modifiers:   []OrderItemModifier{{GroupID: "extras", OptionID: "cheese", Name: "Cheese", Price: 1}},
+			UnitPrice:   12.5,
+			Price:       25,
+			Quantity:    2,
+		}},
+		Status:        "Paid",
+		UserID:        "user",
+		PaymentID:     "pay",
+		StockReserved: true,
+		ScheduledFor:  &scheduled,
+		CreatedAt:     testTime,
+		UpdatedAt:     testTime,
+	}
+}
+
+func testUser() User {
+	return User{
+		ID:            "user",
+		Name:          "Ada",
+		Email:         "ada@example.com",
+		Password:      "$2a$10$hash",
+		Address:       "1 Main St",
+		IsAdmin:       true,
+		EmailVerified: true,
+		Allergens:     []string{"peanuts"},
+		TokenVersion:  2,
+		Locale:        "es",
+		CreatedAt:     testTime,
+		UpdatedAt:     testTime,
+	}
+}
+
+// bsonRoundTrip encodes value to bson and decodes it into a new value of
+// the same type.
+func bsonRoundTrip(t *testing.T, value interface{}) interface{} {
+	t.Helper()
+	raw, err := bson.Marshal(value)
+	if err != nil {
+		t.Fatalf("bson.Marshal: %v", err)
+	}
+	decoded := reflect.New(reflect.TypeOf(value))
+	if err := bson.Unmarshal(raw, decoded.Interface()); err != nil {
+		t.Fatalf("bson.Unmarshal: %v", err)
+	}
+	return decoded.Elem().Interface()
+}
+
+func jsonRoundTrip(t *testing.T, value interface{}) interface{} {
+	t.Helper()
+	raw, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	decoded := reflect.New(reflect.TypeOf(value))
+	if err := json.Unmarshal(raw, decoded.Interface()); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	return decoded.Elem().Interface()
+}
+
+func TestBSONRoundTrip(t *testing.T) {
+	for _, value := range []interface{}{testUser(), testOrder(), testOrder().Items[0], testFood()} {
+		t.Run(reflect.TypeOf(value).Name(), func(t *testing.T) {
+			if got := bsonRoundTrip(t, value); !reflect.DeepEqual(got, value) {
+				t.Errorf("bson round trip changed the value\n got: %+v\nwant: %+v", got, value)
+			}
+		})
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	user := testUser()
+	user.Password = ""
+	user.TokenVersion = 0
+
+	for _, value := range []interface{}{user, testOrder(), testOrder().Items[0], testFood()} {
+		t.Run(reflect.TypeOf(value).Name(), func(t *testing.T) {
+			if got := jsonRoundTrip(t, value); !reflect.DeepEqual(got, value) {
+				t.Errorf("json round trip changed the value\n got: %+v\nwant: %+v", got, value)
+			}
+		})
+	}
+}
+
+func TestUserJSONHidesSecrets(t *testing.T) {
+	raw, err := json.Marshal(testUser())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"password", "$2a$10$hash", "tokenVersion"} {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("user JSON contains %q: %s", secret, raw)
+		}
+	}
+}
+
+func TestFoodBSONFieldNames(t *testing.T) {
+	raw, err := bson.Marshal(testFood())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		"storeId",
+		"lowStockThreshold",
+		"promotion.scheduleId",
+		"promotion.regularPrice",
+		"nutrition.saturatedFat",
+	} {
+		var value interface{} = doc
+		for _, key := range strings.Split(path, ".") {
+			nested, ok := value.(bson.M)
+			if !ok {
+				value = nil
+				break
+			}
+			value = nested[key]
+		}
+		if value == nil {
+			t.Errorf("food document has no %s: %v", path, doc)
+		}
+	}
+}
+
+// TestStoredModelsAreTagged checks that every stored model names its
+// fields in camelCase, so queries can use the same names for every
+// collection.
+func TestStoredModelsAreTagged(t *testing.T) {
+	for _, model := range []interface{}{
+		User{}, Order{}, OrderItem{}, LatLng{}, Food{},
+		FoodVariant{}, ModifierGroup{}, ModifierOption{}, OrderItemModifier{},
+		TimeWindow{}, FoodPromotion{}, CategoryPlacement{}, Nutrition{},
+		FoodImage{}, ImageVariant{}, FoodIngredient{},
+		Category{}, UserFavorite{}, Ingredient{}, StockAdjustment{},
+		PriceChange{}, PriceSchedule{}, Review{},
+		Store{}, StoreSchedule{}, DayHours{}, HolidayException{}, DeliveryZone{}, StoreStaff{},
+		Webhook{}, WebhookDelivery{}, PasswordReset{},
+	} {
+		typ := reflect.TypeOf(model)
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name := strings.Split(field.Tag.Get("bson"), ",")[0]
+			if name == "" {
+				t.Errorf("%s.%s has no bson tag", typ.Name(), field.Name)
+				continue
+			}
+			if name == "-" || name == "_id" {
+				continue
+			}
+			if want := strings.ToLower(name[:1]) + name[1:]; name != want {
+				t.Errorf("%s.%s is stored as %q, want camelCase", typ.Name(), field.Name, name)
+			}
+			if json := strings.Split(field.Tag.Get("json"), ",")[0]; json != "-" && json != name {
+				t.Errorf("%s.%s has json name %q but bson name %q", typ.Name(), field.Name, json, name)
+			}
+		}
+	}
+}
+
+func facetFoods() []Food {
+	food := func(name string, price, stars float64, origin string, tags ...string) Food {
+		return Food{ID: primitive.NewObjectID(), StoreID: DefaultStoreID, Name: name, Price: price, Stars: stars, Origins: []string{origin}, Tags: tags}
+	}
+	deleted := food("lasagna", 15, 4, "italy", "italian")
+	deleted.DeletedAt = gorm.DeletedAt{Time: testTime, Valid: true}
+	elsewhere := food("risotto", 16, 4, "italy", "italian")
+	elsewhere.StoreID = "uptown"
+
+	return []Food{
+		food("pizza", 9.5, 4.5, "italy", "italian", "cheese"),
+		food("pasta", 12, 3, "italy", "italian"),
+		food("curry", 14, 4, "india", "spicy"),
+		food("salad", 4, 5, "greece", "vegan"),
+		food("steak", 60, 4.2, "argentina"),
+		deleted,
+		elsewhere,
+	}
+}
+
+// countMatches is what a search with the query would return
+func countMatches(foods []Food, q FoodQuery) int {
+	n := 0
+	for _, food := range foods {
+		if q.Matches(food) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFoodFacetsCountSearchResults(t *testing.T) {
+	foods := facetFoods()
+	queries := map[string]FoodQuery{
+		"store":   {StoreID: DefaultStoreID},
+		"tag":     {StoreID: DefaultStoreID, Tag: "italian"},
+		"search":  {StoreID: DefaultStoreID, Search: "A"},
+		"nothing": {StoreID: DefaultStoreID, Search: "sushi"},
+	}
+
+	for name, q := range queries {
+		t.Run(name, func(t *testing.T) {
+			facets := ComputeFoodFacets(foods, q)
+
+			// Narrowing the search to a facet's value finds as many foods as
+			// the facet counts
+			for _, tag := range facets.Tags {
+				narrowed := q
+				narrowed.Tag = tag.Value.(string)
+				if n := countMatches(foods, narrowed); n != tag.Count {
+					t.Errorf("tag %v counts %d foods, searching for it finds %d", tag.Value, tag.Count, n)
+				}
+			}
+			for _, origin := range facets.Origins {
+				narrowed := q
+				narrowed.Origin = origin.Value.(string)
+				if n := countMatches(foods, narrowed); n != origin.Count {
+					t.Errorf("origin %v counts %d foods, searching for it finds %d", origin.Value, origin.Count, n)
+				}
+			}
+			for _, stars := range facets.Stars {
+				atLeast, above := q, q
+				min, next := stars.Value.(int), stars.Value.(int)+1
+				atLeast.MinStars, above.MinStars = &min, &next
+				if n := countMatches(foods, atLeast) - countMatches(foods, above); n != stars.Count {
+					t.Errorf("%d stars counts %d foods, searching for it finds %d", min, stars.Count, n)
+				}
+			}
+
+			total := 0
+			for _, bucket := range facets.PriceRanges {
+				atLeast := q
+				atLeast.MinPrice = &bucket.Min
+				n := countMatches(foods, atLeast)
+				if bucket.Max != nil {
+					above := q
+					above.MinPrice = bucket.Max
+					n -= countMatches(foods, above)
+				}
+				if n != bucket.Count {
+					t.Errorf("price bucket from %v counts %d foods, searching for it finds %d", bucket.Min, bucket.Count, n)
+				}
+				total += bucket.Count
+			}
+			if n := countMatches(foods, q); total != n {
+				t.Errorf("price buckets count %d foods, the search finds %d", total, n)
+			}
+		})
+	}
+}
+
+func TestFacetPipelineResultMatchesComputeFoodFacets(t *testing.T) {
+	// What the Mongo aggregation returns for the italian foods: $floor keeps
+	// stars as doubles and $bucket names each bucket by its lower bound
+	result := FacetResult{
+		Tags:    []FacetCount{{Value: "italian", Count: 2}, {Value: "cheese", Count: 1}},
+		Origins: []FacetCount{{Value: "italy", Count: 2}},
+		Stars:   []FacetCount{{Value: 3.0, Count: 1}, {Value: 4.0, Count: 1}},
+	}
+	result.Prices = append(result.Prices,
+		struct {
+			ID    interface{} `bson:"_id"`
+			Count int         `bson:"count"`
+		}{5.0, 1},
+		struct {
+			ID    interface{} `bson:"_id"`
+			Count int         `bson:"count"`
+		}{10.0, 1},
+	)
+
+	want := ComputeFoodFacets(facetFoods(), FoodQuery{StoreID: DefaultStoreID, Tag: "italian"})
+	if got := result.DecodeFacets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeFacets = %+v\nComputeFoodFacets = %+v", got, want)
+	}
+}
+
+func TestPriceBucketIndex(t *testing.T) {
+	tests := []struct {
+		price float64
+		want  int
+	}{
+		{-3, 0},
+		{0, 0},
+		{4.99, 0},
+		{5, 1},
+		{19.99, 2},
+		{20, 3},
+		{50, 4},
+		{1000, 4},
+	}
+	for _, tt := range tests {
+		if got := priceBucketIndex(tt.price); got != tt.want {
+			t.Errorf("priceBucketIndex(%v) = %d, want %d", tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestFacetPipelineBucketsBelowRangePricesFirst(t *testing.T) {
+	// $bucket groups by the price raised to the first boundary, so a
+	// negative price is reported in the 0 bucket rather than the open one
+	bucket := FoodQuery{}.FacetPipeline()[1]["$facet"].(bson.M)["prices"].([]bson.M)[0]["$bucket"].(bson.M)
+	want := bson.M{"$max": bson.A{"$price", PriceBucketBoundaries[0]}}
+	if !reflect.DeepEqual(bucket["groupBy"], want) {
+		t.Fatalf("groupBy = %v, want %v", bucket["groupBy"], want)
+	}
+
+	result := FacetResult{}
+	result.Prices = append(result.Prices, struct {
+		ID    interface{} `bson:"_id"`
+		Count int         `bson:"count"`
+	}{0.0, 1})
+	foods := []Food{{StoreID: DefaultStoreID, Name: "refund", Price: -2}}
+	got := result.DecodeFacets().PriceRanges
+	if want := ComputeFoodFacets(foods, FoodQuery{StoreID: DefaultStoreID}).PriceRanges; !reflect.DeepEqual(got, want) || got[0].Count != 1 {
+		t.Errorf("DecodeFacets = %+v\nComputeFoodFacets = %+v", got, want)
+	}
+}
+
+func TestMatchesText(t *testing.T) {
+	food := Food{Name: "Pizza, Margherita", Tags: []string{"wood-fired"}, Origins: []string{"Napoli"}}
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"margherita", true},
+		{"PIZZA", true},
+		{"fired", true},
+		{"sushi napoli", true},
+		{"pizzas", false},
+		{"marg", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := matchesText(food, tt.text); got != tt.want {
+			t.Errorf("matchesText(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestStoreScheduleIsOpen(t *testing.T) {
+	// New York moves its clocks forward on 2024-03-10. 2024-03-01 is a Friday.
+	schedule := StoreSchedule{
+		TimeZone: "America/New_York",
+		OpeningHours: []DayHours{
+			{Weekday: 1, Open: "09:00", Close: "17:00"},
+			{Weekday: 2, Open: "09:00", Close: "17:00"},
+			{Weekday: 4, Open: "09:00", Close: "17:00"},
+			{Weekday: 5, Open: "09:00", Close: "17:00"},
+			{Weekday: 5, Open: "18:00", Close: "02:00"},
+		},
+		Exceptions: []HolidayException{
+			{Date: "2024-03-04", Closed: true},
+			{Date: "2024-03-05", Open: "12:00", Close: "14:00"},
+			{Date: "2024-03-08", Closed: true},
+		},
+	}
+	utc := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2024, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"during the day", utc(3, 1, 15, 0), true},
+		{"before opening", utc(3, 1, 13, 59), false},
+		{"at closing", utc(3, 1, 22, 0), false},
+		{"overnight before midnight", utc(3, 2, 4, 30), true},
+		{"overnight after midnight", utc(3, 2, 6, 59), true},
+		{"overnight at closing", utc(3, 2, 7, 0), false},
+		{"day without hours", utc(3, 2, 17, 0), false},
+		{"late on a day without overnight hours", utc(3, 1, 4, 30), false},
+		{"closed for a holiday", utc(3, 4, 15, 0), false},
+		{"outside special hours", utc(3, 5, 15, 0), false},
+		{"during special hours", utc(3, 5, 18, 0), true},
+		{"after midnight following a closed day", utc(3, 9, 6, 0), false},
+		{"after the clocks change", utc(3, 11, 13, 30), true},
+		{"after closing once the clocks change", utc(3, 11, 21, 30), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.IsOpen(tt.at); got != tt.want {
+				t.Errorf("IsOpen(%v) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+
+	if !(StoreSchedule{}).IsOpen(testTime) {
+		t.Error("a schedule without hours should always be open")
+	}
+}
+
+func TestFoodAvailableAt(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	food := Food{AvailabilityWindows: []TimeWindow{
+		{Start: "07:00", End: "11:00"},
+		{Days: []int{5, 6}, Start: "22:00", End: "03:00"},
+	}}
+	at := func(day, hour, min int, loc *time.Location) time.Time {
+		return time.Date(2024, 3, day, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		loc  *time.Location
+		want bool
+	}{
+		{"breakfast every day", at(4, 8, 0, tokyo), tokyo, true},
+		{"after breakfast", at(4, 11, 0, tokyo), tokyo, false},
+		{"late on a listed day", at(1, 23, 0, tokyo), tokyo, true},
+		{"after midnight following a listed day", at(2, 2, 30, tokyo), tokyo, true},
+		{"after midnight following the last listed day", at(3, 2, 30, tokyo), tokyo, true},
+		{"after midnight following an unlisted day", at(4, 2, 30, tokyo), tokyo, false},
+		{"late on an unlisted day", at(7, 23, 0, tokyo), tokyo, false},
+		{"breakfast in UTC", at(1, 8, 0, time.UTC), time.UTC, true},
+		{"the same instant in Tokyo", at(1, 8, 0, time.UTC), tokyo, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := food.AvailableAt(tt.at, tt.loc); got != tt.want {
+				t.Errorf("AvailableAt(%v, %v) = %v, want %v", tt.at, tt.loc, got, tt.want)
+			}
+		})
+	}
+
+	if !(Food{}).AvailableAt(testTime, tokyo) {
+		t.Error("a food without windows should always be available")
+	}
+}
+
+func TestFoodPriceFor(t *testing.T) {
+	pizza := Food{
+		Name:  "Pizza",
+		Price: 10,
+		Variants: []FoodVariant{
+			{ID: "small", Name: "Small", Price: 8},
+			{ID: "large", Name: "Large", Price: 14},
+		},
+		ModifierGroups: []ModifierGroup{
+			{ID: "crust", Name: "Crust", MinSelect: 1, MaxSelect: 1, Options: []ModifierOption{
+				{ID: "thin", Name: "Thin"},
+				{ID: "stuffed", Name: "Stuffed", Price: 2.5},
+			}},
+			{ID: "toppings", Name: "Toppings", MaxSelect: 2, Options: []ModifierOption{
+				{ID: "olives", Name: "Olives", Price: 1},
+				{ID: "ham", Name: "Ham", Price: 1.5},
+				{ID: "egg", Name: "Egg", Price: 0.5},
+			}},
+		},
+	}
+	salad := Food{Name: "Salad", Price: 6}
+	pick := func(ids ...string) []OrderItemModifier {
+		picked := []OrderItemModifier{}
+		for _, id := range ids {
+			group, option, _ := strings.Cut(id, "/")
+			picked = append(picked, OrderItemModifier{GroupID: group, OptionID: option})
+		}
+		return picked
+	}
+
+	tests := []struct {
+		name      string
+		food      Food
+		variant   string
+		modifiers []OrderItemModifier
+		want      float64
+		wantErr   bool
+	}{
+		{"plain food", salad, "", nil, 6, false},
+		{"variant and required option", pizza, "small", pick("crust/thin"), 8, false},
+		{"priced options", pizza, "large", pick("crust/stuffed", "toppings/olives", "toppings/ham"), 19, false},
+		{"no variant", pizza, "", pick("crust/thin"), 0, true},
+		{"variant on a food without", salad, "small", nil, 0, true},
+		{"unknown variant", pizza, "medium", pick("crust/thin"), 0, true},
+		{"missing required group", pizza, "small", nil, 0, true},
+		{"too many options", pizza, "small", pick("crust/thin", "toppings/olives", "toppings/ham", "toppings/egg"), 0, true},
+		{"option twice", pizza, "small", pick("crust/thin", "toppings/ham", "toppings/ham"), 0, true},
+		{"unknown option", pizza, "small", pick("crust/thin", "toppings/pineapple"), 0, true},
+		{"option from another group", pizza, "small", pick("crust/olives"), 0, true},
+	}
+	for _, tt := range tests {
+		price, variant, modifiers, err := tt.food.PriceFor(tt.variant, tt.modifiers)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: PriceFor = %v, want an error", tt.name, price)
+			}
+			continue
+		}
+		if err != nil || price != tt.want {
+			t.Errorf("%s: PriceFor = %v, %v, want %v", tt.name, price, err, tt.want)
+			continue
+		}
+		if (variant == nil) != (tt.variant == "") || (variant != nil && variant.ID != tt.variant) {
+			t.Errorf("%s: variant = %+v, want %q", tt.name, variant, tt.variant)
+		}
+		// Modifiers come back named and priced from the menu
+		for _, m := range modifiers {
+			if m.Name == "" {
+				t.Errorf("%s: modifier %+v has no name", tt.name, m)
+			}
+		}
+		if len(modifiers) != len(tt.modifiers) {
+			t.Errorf("%s: %d modifiers, want %d", tt.name, len(modifiers), len(tt.modifiers))
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Package notifications emails customers when something happens to their
+// account or orders. Messages are rendered from per-locale templates and
+// handed to a Queue, which sends them in the background through a
+// Sender.
+package notifications
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"go_backend/events"
+	"go_backend/models"
+)
+
+// Message is an email ready to send.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer renders templates for users and queues the results.
+type Mailer struct {
+	Templates *Templates
+	Queue     *Queue
+}
+
+// Send renders the named template in the user's locale and queues it.
+func (m *Mailer) Send(user models.User, name string, data map[string]interface{}) error {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["User"] = user
+	data["AppName"] = appName()
+
+	subject, text, html, err := m.Templates.Render(user.Locale, name, data)
+	if err != nil {
+		return err
+	}
+	return m.Queue.Enqueue(Message{To: user.Email, Subject: subject, Text: text, HTML: html})
+}
+
+func appName() string {
+	if name := os.Getenv("APP_NAME"); name != "" {
+		return name
+	}
+	return "Food Store"
+}
+
+// UserLookup finds the recipient of a notification.
+type UserLookup interface {
+	ByID(ctx context.Context, id string) (models.User, error)
+}
+
+// OrderLookup finds the order a notification is about.
+type OrderLookup interface {
+	ByID(ctx context.Context, id string) (models.Order, error)
+}
+
+// Notifier emails customers about their registration and orders.
+type Notifier struct {
+	Mailer *Mailer
+	Users  UserLookup
+	Orders OrderLookup
+}
+
+// Subscribe sends the notifications for the bus's events.
+func (n *Notifier) Subscribe(bus *events.Bus) {
+	bus.Subscribe(events.UserRegistered, "email.welcome", n.welcome)
+	bus.Subscribe(events.OrderCreated, "email.order_created", n.orderCreated)
+	bus.Subscribe(events.OrderPaid, "email.order_paid", n.orderPaid)
+}
+
+func (n *Notifier) welcome(ctx context.Context, event events.Event) error {
+	var registration events.Registration
+	if err := event.Decode(&registration); err != nil {
+		return err
+	}
+	user, err := n.Users.ByID(ctx, registration.UserID)
+	if err != nil {
+		return err
+	}
+	return n.send(user, "welcome", nil)
+}
+
+func (n *Notifier) orderCreated(ctx context.Context, event events.Event) error {
+	var order models.Order
+	if err := event.Decode(&order); err != nil {
+		return err
+	}
+	user, err := n.Users.ByID(ctx, order.UserID)
+	if err != nil {
+		return err
+	}
+	return n.send(user, "order_created", map[string]interface{}{"Order": order})
+}
+
+func (n *Notifier) orderPaid(ctx context.Context, event events.Event) error {
+	var change events.StatusChange
+	if err := event.Decode(&change); err != nil {
+		return err
+	}
+	order, err := n.Orders.ByID(ctx, change.OrderID)
+	if err != nil {
+		return err
+	}
+	user, err := n.Users.ByID(ctx, order.UserID)
+	if err != nil {
+		return err
+	}
+	return n.send(user, "order_paid", map[string]interface{}{"Order": order})
+}
+
+// send queues a notification. A full queue is logged rather than returned
+// so the dispatcher doesn't keep retrying the event against it.
+func (n *Notifier) send(user models.User, name string, data map[string]interface{}) error {
+	err := n.Mailer.Send(user, name, data)
+	if err == ErrQueueFull {
+		log.Printf("Dropped %s email to %s: %v", name, user.Email, err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,216 @@
+package notifications
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"go_backend/events"
+	"go_backend/models"
+	"go_backend/repository"
+)
+
+func loadTestTemplates(t *testing.T) *Templates {
+	t.Helper()
+	templates, err := LoadTemplates()
+	if err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	return templates
+}
+
+func TestRenderPicksTheUsersLocale(t *testing.T) {
+	templates := loadTestTemplates(t)
+	data := map[string]interface{}{"AppName": "Food Store", "User": models.User{Name: "Ada"}}
+
+	tests := []struct {
+		locale, subject string
+	}{
+		{"en", "Welcome to Food Store"},
+		{"es", "Bienvenido a Food Store"},
+		{"es-MX", "Bienvenido a Food Store"},
+		{"ES_mx", "Bienvenido a Food Store"},
+		{"fr", "Welcome to Food Store"},
+		{"", "Welcome to Food Store"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			subject, text, html, err := templates.Render(tt.locale, "welcome", data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subject != tt.subject {
+				t.Errorf("subject = %q, want %q", subject, tt.subject)
+			}
+			if !strings.Contains(text, "Ada") || !strings.Contains(html, "Ada") {
+				t.Errorf("the body doesn't greet the user:\n%s\n%s", text, html)
+			}
+		})
+	}
+}
+
+func TestRenderEscapesHTMLOnly(t *testing.T) {
+	templates := loadTestTemplates(t)
+	data := map[string]interface{}{"AppName": "Food Store", "User": models.User{Name: "<b>Ada</b>"}}
+
+	_, text, html, err := templates.Render("en", "welcome", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "<b>Ada</b>") {
+		t.Errorf("text body changed the name:\n%s", text)
+	}
+	if strings.Contains(html, "<b>Ada</b>") || !strings.Contains(html, "&lt;b&gt;Ada&lt;/b&gt;") {
+		t.Errorf("HTML body didn't escape the name:\n%s", html)
+	}
+}
+
+func TestRenderFallsBackPerTemplate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"t/en/welcome.subject": {Data: []byte("Welcome")},
+		"t/en/welcome.txt":     {Data: []byte("Hi")},
+		"t/en/welcome.html":    {Data: []byte("<p>Hi</p>")},
+		"t/en/receipt.subject": {Data: []byte("Receipt")},
+		"t/en/receipt.txt":     {Data: []byte("Paid")},
+		"t/en/receipt.html":    {Data: []byte("<p>Paid</p>")},
+		"t/de/welcome.subject": {Data: []byte("Willkommen")},
+		"t/de/welcome.txt":     {Data: []byte("Hallo")},
+		"t/de/welcome.html":    {Data: []byte("<p>Hallo</p>")},
+	}
+	templates, err := ParseTemplates(fsys, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// German has its own welcome but no receipt yet
+	for name, want := range map[string]string{"welcome": "Willkommen", "receipt": "Receipt"} {
+		if subject, _, _, err := templates.Render("de-AT", name, nil); err != nil || subject != want {
+			t.Errorf("Render(de-AT, %s) = %q, %v, want %q", name, subject, err, want)
+		}
+	}
+
+	delete(fsys, "t/en/welcome.subject")
+	delete(fsys, "t/en/welcome.txt")
+	delete(fsys, "t/en/welcome.html")
+	delete(fsys, "t/en/receipt.subject")
+	delete(fsys, "t/en/receipt.txt")
+	delete(fsys, "t/en/receipt.html")
+	if _, err := ParseTemplates(fsys, "t"); err == nil {
+		t.Error("ParseTemplates accepted templates without the default locale")
+	}
+}
+
+type testUsers map[string]models.User
+
+func (u testUsers) ByID(ctx context.Context, id string) (models.User, error) {
+	if user, ok := u[id]; ok {
+		return user, nil
+	}
+	return models.User{}, repository.ErrNotFound
+}
+
+type testOrders map[string]models.Order
+
+func (o testOrders) ByID(ctx context.Context, id string) (models.Order, error) {
+	if order, ok := o[id]; ok {
+		return order, nil
+	}
+	return models.Order{}, repository.ErrNotFound
+}
+
+// waitForMessages waits until sender has captured n messages, or gives up
+// after a while
+func waitForMessages(sender *CaptureSender, n int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for len(sender.Messages()) < n && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNotifierEmailsEachEvent(t *testing.T) {
+	t.Setenv("APP_NAME", "Food Store")
+	sender := &CaptureSender{}
+	queue := NewQueue(sender)
+	ctx, cancel := context.WithCancel(context.Background())
+	queue.Start(ctx, 1)
+	defer queue.Wait()
+	defer cancel()
+
+	ada := models.User{ID: "ada", Name: "Ada", Email: "ada@example.com", Locale: "es"}
+	order := models.Order{ID: "order1", UserID: "ada", Address: "1 Main St", TotalPrice: 12.5,
+		Items: []models.OrderItem{{Food: models.Food{Name: "Pizza"}, Quantity: 1, Price: 12.5}}}
+	bus := events.NewBus()
+	(&Notifier{
+		Mailer: &Mailer{Templates: loadTestTemplates(t), Queue: queue},
+		Users:  testUsers{"ada": ada},
+		Orders: testOrders{"order1": order},
+	}).Subscribe(bus)
+
+	publish := func(eventType string, data interface{}) {
+		t.Helper()
+		event, err := events.New(eventType, "aggregate", models.DefaultStoreID, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bus.Publish(ctx, event); err != nil {
+			t.Fatalf("Publish(%s): %v", eventType, err)
+		}
+	}
+	publish(events.UserRegistered, events.Registration{UserID: "ada", Name: "Ada", Email: ada.Email})
+	publish(events.OrderCreated, order)
+	publish(events.OrderPaid, events.StatusChange{OrderID: "order1", UserID: "ada", From: "Pending", To: "Paid"})
+	publish(events.OrderStatusChanged, events.StatusChange{OrderID: "order1", UserID: "ada", From: "Paid", To: "Delivered"})
+
+	want := []string{"Bienvenido a Food Store", "Hemos recibido tu pedido order1", "Pago recibido para el pedido order1"}
+	waitForMessages(sender, len(want))
+	// Leave time for an unwanted fourth email to show up
+	time.Sleep(20 * time.Millisecond)
+	messages := sender.Messages()
+	if len(messages) != len(want) {
+		t.Fatalf("sent %d emails, want %d: %+v", len(messages), len(want), messages)
+	}
+	for i, msg := range messages {
+		if msg.To != ada.Email || msg.Subject != want[i] {
+			t.Errorf("email %d = %q to %s, want %q to %s", i, msg.Subject, msg.To, want[i], ada.Email)
+		}
+	}
+	if !strings.Contains(messages[1].Text, "Pizza") || !strings.Contains(messages[1].HTML, "12.50") {
+		t.Errorf("order email doesn't list the order:\n%s\n%s", messages[1].Text, messages[1].HTML)
+	}
+}
+
+func TestNotifierFailsForUnknownRecipient(t *testing.T) {
+	sender := &CaptureSender{}
+	bus := events.NewBus()
+	(&Notifier{
+		Mailer: &Mailer{Templates: loadTestTemplates(t), Queue: NewQueue(sender)},
+		Users:  testUsers{},
+		Orders: testOrders{},
+	}).Subscribe(bus)
+
+	// The dispatcher retries failed events, so a missing user must fail
+	event, err := events.New(events.UserRegistered, "ghost", "", events.Registration{UserID: "ghost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Publish(context.Background(), event); err == nil {
+		t.Error("Publish succeeded without a recipient")
+	}
+}
+
+func TestNotifierDropsEmailsWhenQueueIsFull(t *testing.T) {
+	queue := &Queue{Sender: &CaptureSender{}, messages: make(chan Message, 1)}
+	notifier := &Notifier{Mailer: &Mailer{Templates: loadTestTemplates(t), Queue: queue}}
+	ada := models.User{Name: "Ada", Email: "ada@example.com"}
+
+	for i := 0; i < 2; i++ {
+		if err := notifier.send(ada, "welcome", nil); err != nil {
+			t.Errorf("send %d = %v, want the overflow dropped", i, err)
+		}
+	}
+	if len(queue.messages) != 1 {
+		t.Errorf("queued %d emails, want 1", len(queue.messages))
+	}
+}
@@ -0,0 +1,98 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned by Enqueue when the queue has no room left.
+var ErrQueueFull = errors.New("notification queue is full")
+
+const (
+	defaultQueueSize = 1000
+	sendAttempts     = 3
+)
+
+// Queue sends messages in the background so callers never wait on the
+// mail server. Queued messages live in memory only and are lost if the
+// process stops before they're sent.
+type Queue struct {
+	Sender   Sender
+	messages chan Message
+	wg       sync.WaitGroup
+}
+
+// NewQueue returns a queue holding up to MAIL_QUEUE_SIZE messages
+// (default 1000). Call Start to begin sending.
+func NewQueue(sender Sender) *Queue {
+	size := defaultQueueSize
+	if raw := os.Getenv("MAIL_QUEUE_SIZE"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			size = n
+		} else {
+			log.Printf("Ignoring invalid MAIL_QUEUE_SIZE %q", raw)
+		}
+	}
+	return &Queue{Sender: sender, messages: make(chan Message, size)}
+}
+
+// Enqueue adds msg to the queue without blocking.
+func (q *Queue) Enqueue(msg Message) error {
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Start runs workers goroutines that send queued messages until ctx is
+// cancelled.
+func (q *Queue) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-q.messages:
+					q.send(ctx, msg)
+				}
+			}
+		}()
+	}
+}
+
+// Wait blocks until the workers have stopped.
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// send tries a message a few times, backing off between attempts, and
+// logs it if every attempt fails.
+func (q *Queue) send(ctx context.Context, msg Message) {
+	delay := time.Second
+	for attempt := 1; ; attempt++ {
+		err := q.Sender.Send(ctx, msg)
+		if err == nil {
+			return
+		}
+		if attempt == sendAttempts {
+			log.Printf("Failed to send %q to %s: %v", msg.Subject, msg.To, err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
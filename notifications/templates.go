@@ -0,0 +1,105 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLocale is used when a user's locale has no templates.
+const DefaultLocale = "en"
+
+//go:embed templates
+var templateFiles embed.FS
+
+// Templates holds each locale's email templates. Every email has three
+// files: NAME.subject and NAME.txt, rendered as text, and NAME.html,
+// rendered as HTML with escaping.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+var templateFuncs = map[string]interface{}{
+	"money": func(amount float64) string { return fmt.Sprintf("%.2f", amount) },
+}
+
+// LoadTemplates parses the built-in templates.
+func LoadTemplates() (*Templates, error) {
+	return ParseTemplates(templateFiles, "templates")
+}
+
+// ParseTemplates parses the templates in root/LOCALE/ of fsys.
+func ParseTemplates(fsys fs.FS, root string) (*Templates, error) {
+	t := &Templates{
+		text: map[string]*texttemplate.Template{},
+		html: map[string]*htmltemplate.Template{},
+	}
+	locales, err := fs.ReadDir(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	for _, locale := range locales {
+		if !locale.IsDir() {
+			continue
+		}
+		dir := path.Join(root, locale.Name())
+		text, err := texttemplate.New("").Funcs(templateFuncs).ParseFS(fsys, dir+"/*.subject", dir+"/*.txt")
+		if err != nil {
+			return nil, err
+		}
+		html, err := htmltemplate.New("").Funcs(templateFuncs).ParseFS(fsys, dir+"/*.html")
+		if err != nil {
+			return nil, err
+		}
+		t.text[locale.Name()] = text
+		t.html[locale.Name()] = html
+	}
+	if t.text[DefaultLocale] == nil {
+		return nil, fmt.Errorf("no templates for the default locale %q", DefaultLocale)
+	}
+	return t, nil
+}
+
+// Render renders the named email in locale, falling back to its base
+// language ("es" for "es-MX") and then to DefaultLocale.
+func (t *Templates) Render(locale, name string, data interface{}) (subject, text, html string, err error) {
+	locale = t.resolve(locale, name)
+
+	var b bytes.Buffer
+	if err := t.text[locale].ExecuteTemplate(&b, name+".subject", data); err != nil {
+		return "", "", "", err
+	}
+	subject = strings.TrimSpace(b.String())
+
+	b.Reset()
+	if err := t.text[locale].ExecuteTemplate(&b, name+".txt", data); err != nil {
+		return "", "", "", err
+	}
+	text = b.String()
+
+	b.Reset()
+	if err := t.html[locale].ExecuteTemplate(&b, name+".html", data); err != nil {
+		return "", "", "", err
+	}
+	return subject, text, b.String(), nil
+}
+
+func (t *Templates) resolve(locale, name string) string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	candidates := []string{locale}
+	if base, _, ok := strings.Cut(locale, "-"); ok {
+		candidates = append(candidates, base)
+	}
+	for _, candidate := range candidates {
+		if set, ok := t.text[candidate]; ok && set.Lookup(name+".subject") != nil {
+			return candidate
+		}
+	}
+	return DefaultLocale
+}
@@ -0,0 +1,153 @@
+// Package pricing records food price changes and applies scheduled prices.
+package pricing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go_backend/clock"
+	"go_backend/models"
+	"go_backend/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Record adds a price change to the food's history. Unchanged prices are
+// not recorded.
+func Record(ctx context.Context, prices repository.Prices, food models.Food, newPrice float64, changedBy, reason string) error {
+	if food.Price == newPrice {
+		return nil
+	}
+
+	return prices.Record(ctx, &models.PriceChange{
+		ID:        primitive.NewObjectID().Hex(),
+		FoodID:    food.ID.Hex(),
+		StoreID:   food.StoreID,
+		OldPrice:  food.Price,
+		NewPrice:  newPrice,
+		ChangedBy: changedBy,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+}
+
+// Scheduler starts due price schedules and ends expired promotions.
+type Scheduler struct {
+	Clock  clock.Clock
+	Foods  repository.Foods
+	Prices repository.Prices
+}
+
+// Run applies every schedule that is due at the current time.
+func (s *Scheduler) Run(ctx context.Context) error {
+	now := s.Clock.Now()
+	if err := s.endPromotions(ctx, now); err != nil {
+		return err
+	}
+	return s.startSchedules(ctx, now)
+}
+
+func (s *Scheduler) startSchedules(ctx context.Context, now time.Time) error {
+	due, err := s.Prices.Due(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range due {
+		if err := s.start(ctx, schedule, now); err != nil {
+			log.Printf("Failed to start price schedule %s: %v", schedule.ID, err)
+			continue
+		}
+		schedule.Status = models.PriceCompleted
+		if schedule.IsPromotion() && schedule.EndsAt.After(now) {
+			schedule.Status = models.PriceActive
+		}
+		if err := s.finish(ctx, &schedule, models.PriceScheduled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// start applies a due schedule to its food. A regular price change during a
+// promotion becomes the price the promotion reverts to.
+func (s *Scheduler) start(ctx context.Context, schedule models.PriceSchedule, now time.Time) error {
+	id, err := primitive.ObjectIDFromHex(schedule.FoodID)
+	if err != nil {
+		return err
+	}
+	food, err := s.Foods.ByID(ctx, schedule.StoreID, id)
+	if err != nil {
+		return err
+	}
+	before := food
+
+	reason := "scheduled price change"
+	switch {
+	case schedule.IsPromotion() && !schedule.EndsAt.After(now):
+		// The promotion was missed entirely; leave the price alone.
+		return nil
+	case schedule.IsPromotion():
+		regular := food.Price
+		if food.Promotion != nil {
+			regular = food.Promotion.RegularPrice
+		}
+		food.Price = schedule.Price
+		food.Promotion = &models.FoodPromotion{ScheduleID: schedule.ID, RegularPrice: regular, EndsAt: *schedule.EndsAt}
+		reason = "promotion started"
+	case food.Promotion != nil:
+		promotion := *food.Promotion
+		promotion.RegularPrice = schedule.Price
+		food.Promotion = &promotion
+		return s.Foods.Update(ctx, &food, "promotion")
+	default:
+		food.Price = schedule.Price
+	}
+
+	if err := s.Foods.Update(ctx, &food, "price", "promotion"); err != nil {
+		return err
+	}
+	return Record(ctx, s.Prices, before, schedule.Price, schedule.CreatedBy, reason)
+}
+
+// endPromotions restores the regular price of foods whose promotion has
+// ended.
+func (s *Scheduler) endPromotions(ctx context.Context, now time.Time) error {
+	ended, err := s.Prices.Ended(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range ended {
+		food, err := s.Foods.WithPromotion(ctx, schedule.ID)
+		if err == nil {
+			before := food
+			food.Price = food.Promotion.RegularPrice
+			food.Promotion = nil
+			if err := s.Foods.Update(ctx, &food, "price", "promotion"); err != nil {
+				return err
+			}
+			if err := Record(ctx, s.Prices, before, food.Price, schedule.CreatedBy, "promotion ended"); err != nil {
+				return err
+			}
+		}
+
+		schedule.Status = models.PriceCompleted
+		if err := s.finish(ctx, &schedule, models.PriceActive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish saves the schedule's new status unless it was cancelled or ended
+// in the meantime.
+func (s *Scheduler) finish(ctx context.Context, schedule *models.PriceSchedule, from string) error {
+	err := s.Prices.UpdateSchedule(ctx, schedule, from)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	return err
+}
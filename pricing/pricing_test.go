@@ -0,0 +1,131 @@
+package pricing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go_backend/clock"
+	"go_backend/models"
+	"go_backend/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testTime = time.Date(2024, 3, 1, 18, 30, 0, 0, time.UTC)
+
+// testScheduler runs schedules against a throwaway SQLite database holding
+// one food priced 10
+func testScheduler(t *testing.T) (*Scheduler, models.Food) {
+	t.Helper()
+	repos, err := repository.OpenSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	food := models.Food{ID: primitive.NewObjectID(), StoreID: models.DefaultStoreID, Name: "Pizza", Price: 10, Version: 1}
+	if err := repos.Foods.Create(context.Background(), &food); err != nil {
+		t.Fatal(err)
+	}
+	return &Scheduler{Clock: clock.Fixed(testTime), Foods: repos.Foods, Prices: repos.Prices}, food
+}
+
+func addSchedule(t *testing.T, s *Scheduler, food models.Food, id string, price float64, startsAt time.Time, endsAt *time.Time) {
+	t.Helper()
+	schedule := models.PriceSchedule{ID: id, FoodID: food.ID.Hex(), StoreID: food.StoreID, Price: price,
+		StartsAt: startsAt, EndsAt: endsAt, Status: models.PriceScheduled, CreatedBy: "admin"}
+	if err := s.Prices.CreateSchedule(context.Background(), &schedule); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runAt runs the scheduler at at and returns the food afterwards
+func runAt(t *testing.T, s *Scheduler, food models.Food, at time.Time) models.Food {
+	t.Helper()
+	s.Clock = clock.Fixed(at)
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Run at %v: %v", at, err)
+	}
+	stored, err := s.Foods.ByID(context.Background(), food.StoreID, food.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func scheduleStatus(t *testing.T, s *Scheduler, food models.Food, id string) string {
+	t.Helper()
+	schedule, err := s.Prices.Schedule(context.Background(), food.ID.Hex(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schedule.Status
+}
+
+func at(d time.Duration) *time.Time {
+	t := testTime.Add(d)
+	return &t
+}
+
+func TestSchedulerActivatesScheduledPrices(t *testing.T) {
+	tests := []struct {
+		name      string
+		startsAt  time.Time
+		endsAt    *time.Time
+		runAt     time.Time
+		price     float64
+		promotion bool
+		status    string
+		history   int
+	}{
+		{"not yet due", testTime.Add(time.Hour), nil, testTime, 10, false, models.PriceScheduled, 0},
+		{"price change", testTime, nil, testTime, 8, false, models.PriceCompleted, 1},
+		{"running promotion", testTime, at(time.Hour), testTime.Add(time.Minute), 8, true, models.PriceActive, 1},
+		{"missed promotion", testTime, at(time.Hour), testTime.Add(2 * time.Hour), 10, false, models.PriceCompleted, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, food := testScheduler(t)
+			addSchedule(t, s, food, "schedule", 8, tt.startsAt, tt.endsAt)
+
+			got := runAt(t, s, food, tt.runAt)
+			if got.Price != tt.price || (got.Promotion != nil) != tt.promotion {
+				t.Errorf("food = %v with promotion %+v, want %v with promotion %v", got.Price, got.Promotion, tt.price, tt.promotion)
+			}
+			if status := scheduleStatus(t, s, food, "schedule"); status != tt.status {
+				t.Errorf("status = %s, want %s", status, tt.status)
+			}
+			if history, _ := s.Prices.History(context.Background(), food.ID.Hex()); len(history) != tt.history {
+				t.Errorf("history = %+v, want %d changes", history, tt.history)
+			}
+		})
+	}
+}
+
+func TestSchedulerEndsPromotions(t *testing.T) {
+	s, food := testScheduler(t)
+	addSchedule(t, s, food, "promotion", 8, testTime, at(2*time.Hour))
+	// A regular change during the promotion is what it reverts to
+	addSchedule(t, s, food, "raise", 12, testTime.Add(time.Hour), nil)
+
+	if got := runAt(t, s, food, testTime); got.Price != 8 || got.Promotion == nil || got.Promotion.RegularPrice != 10 {
+		t.Fatalf("during the promotion food = %v with %+v, want 8 reverting to 10", got.Price, got.Promotion)
+	}
+	if got := runAt(t, s, food, testTime.Add(time.Hour)); got.Price != 8 || got.Promotion == nil || got.Promotion.RegularPrice != 12 {
+		t.Fatalf("after the raise food = %v with %+v, want 8 reverting to 12", got.Price, got.Promotion)
+	}
+	if got := runAt(t, s, food, testTime.Add(2*time.Hour)); got.Price != 12 || got.Promotion != nil {
+		t.Fatalf("after the promotion food = %v with %+v, want 12", got.Price, got.Promotion)
+	}
+	if status := scheduleStatus(t, s, food, "promotion"); status != models.PriceCompleted {
+		t.Errorf("promotion status = %s, want %s", status, models.PriceCompleted)
+	}
+
+	history, err := s.Prices.History(context.Background(), food.ID.Hex())
+	reasons := map[string]float64{}
+	for _, change := range history {
+		reasons[change.Reason] = change.NewPrice
+	}
+	if err != nil || len(history) != 2 || reasons["promotion started"] != 8 || reasons["promotion ended"] != 12 {
+		t.Errorf("history = %+v, %v, want the promotion's start and end", history, err)
+	}
+}
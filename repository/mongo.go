@@ -0,0 +1,1110 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"go_backend/data"
+	"go_backend/events"
+	"go_backend/models"
+	"go_backend/uow"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+)
+
+// NewMongo returns the repositories backed by the foodstoreDB database.
+func NewMongo() Repositories {
+	return Repositories{
+		Users:          mongoUsers{},
+		Foods:          mongoFoods{},
+		Orders:         mongoOrders{},
+		Stores:         mongoStores{},
+		Categories:     mongoCategories{},
+		Favorites:      mongoFavorites{},
+		Inventory:      mongoInventory{},
+		Reviews:        mongoReviews{},
+		Prices:         mongoPrices{},
+		Webhooks:       mongoWebhooks{},
+		PasswordResets: mongoPasswordResets{},
+		Outbox:         mongoOutbox{},
+		Transactions:   uow.Mongo{},
+	}
+}
+
+// OpenMongo connects to Mongo and returns its repositories. Mongo only
+// runs transactions on a replica set; on a standalone server units of work
+// run one at a time instead, undoing what they registered with
+// uow.OnRollback when they fail.
+func OpenMongo(ctx context.Context) (Repositories, error) {
+	transactions, err := data.SupportsTransactions(ctx)
+	if err != nil {
+		return Repositories{}, err
+	}
+	repos := NewMongo()
+	if !transactions {
+		log.Println("Mongo is not a replica set; running units of work without transactions")
+		repos.Transactions = &uow.Memory{}
+	}
+	return repos, nil
+}
+
+// undoInsert deletes the document matching filter from the named
+// collection if the unit of work running ctx fails. Transactions discard
+// the insert themselves; uow.Memory, used on standalone servers, needs
+// this.
+func undoInsert(ctx context.Context, name string, filter bson.M) {
+	uow.OnRollback(ctx, func() {
+		if _, err := collection(name).DeleteOne(context.Background(), filter); err != nil {
+			log.Printf("Failed to undo an insert into %s: %v", name, err)
+		}
+	})
+}
+
+func collection(name string) *mongo.Collection {
+	return data.GetMongoClient().Database("foodstoreDB").Collection(name)
+}
+
+// mongoError converts the driver's errors into the package's.
+func mongoError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if field, ok := data.DuplicateKeyField(err); ok {
+		return &DuplicateError{Field: field}
+	}
+	return err
+}
+
+type mongoUsers struct{}
+
+func (mongoUsers) Create(ctx context.Context, user *models.User) error {
+	_, err := collection("users").InsertOne(ctx, user)
+	if err == nil {
+		undoInsert(ctx, "users", bson.M{"id": user.ID})
+	}
+	return mongoError(err)
+}
+
+func (mongoUsers) ByID(ctx context.Context, id string) (models.User, error) {
+	return findUser(ctx, bson.M{"id": id})
+}
+
+func (mongoUsers) ByEmail(ctx context.Context, email string) (models.User, error) {
+	return findUser(ctx, bson.M{"email": email})
+}
+
+func (mongoUsers) Search(ctx context.Context, term string) ([]models.User, error) {
+	filter := bson.M{}
+	if term != "" {
+		pattern := bson.M{"$regex": regexp.QuoteMeta(term), "$options": "i"}
+		filter["$or"] = bson.A{bson.M{"name": pattern}, bson.M{"email": pattern}}
+	}
+	cursor, err := collection("users").Find(ctx, models.NotDeleted(filter, models.UserDeletedAt), options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	users := []models.User{}
+	err = cursor.All(ctx, &users)
+	return users, err
+}
+
+func findUser(ctx context.Context, filter bson.M) (models.User, error) {
+	var user models.User
+	err := collection("users").FindOne(ctx, models.NotDeleted(filter, models.UserDeletedAt)).Decode(&user)
+	return user, mongoError(err)
+}
+
+func (mongoUsers) Update(ctx context.Context, user *models.User) error {
+	filter := models.NotDeleted(bson.M{"id": user.ID}, models.UserDeletedAt)
+	update := bson.M{"$set": bson.M{
+		"name":          user.Name,
+		"email":         user.Email,
+		"password":      user.Password,
+		"address":       user.Address,
+		"allergens":     user.Allergens,
+		"locale":        user.Locale,
+		"emailVerified": user.EmailVerified,
+		"tokenVersion":  user.TokenVersion,
+		"isAdmin":       user.IsAdmin,
+		"isBlocked":     user.IsBlocked,
+		"isSuperAdmin":  user.IsSuperAdmin,
+		"updatedAt":     user.UpdatedAt,
+	}}
+	result, err := collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return mongoError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+var (
+	userBin  = mongoBin{collection: "users", deletedAt: models.UserDeletedAt}
+	foodBin  = mongoBin{collection: "foods", deletedAt: models.FoodDeletedAt}
+	orderBin = mongoBin{collection: "orders", deletedAt: models.OrderDeletedAt}
+)
+
+func (mongoUsers) Delete(ctx context.Context, _, id string) error {
+	return userBin.setDeleted(ctx, bson.M{"id": id}, bson.M{}, true)
+}
+
+func (mongoUsers) Restore(ctx context.Context, _, id string) error {
+	return userBin.setDeleted(ctx, bson.M{"id": id}, bson.M{}, false)
+}
+
+func (mongoUsers) Deleted(ctx context.Context) ([]models.User, error) {
+	users := []models.User{}
+	err := userBin.list(ctx, bson.M{}, &users)
+	return users, err
+}
+
+func (mongoUsers) Purge(ctx context.Context, cutoff time.Time) ([]string, error) {
+	filter := models.DeletedBefore(cutoff, models.UserDeletedAt)
+	values, err := collection("users").Distinct(ctx, "id", filter)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	if _, err := collection("users").DeleteMany(ctx, filter); err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, value := range values {
+		if id, ok := value.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// mongoBin is a collection whose documents are soft-deleted.
+type mongoBin struct {
+	collection string
+	deletedAt  string
+}
+
+// setDeleted soft-deletes or restores the document matching filter along
+// with the rest of update. ErrNotFound means no document matched in the
+// opposite state.
+func (b mongoBin) setDeleted(ctx context.Context, filter, update bson.M, deleted bool) error {
+	now := time.Now()
+	value := models.DeletedNow(now)
+	if deleted {
+		models.NotDeleted(filter, b.deletedAt)
+	} else {
+		models.Deleted(filter, b.deletedAt)
+		value = gorm.DeletedAt{}
+	}
+	update["$set"] = bson.M{b.deletedAt: value, "updatedAt": now}
+
+	result, err := collection(b.collection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return mongoError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// list decodes the soft-deleted documents matching filter, most recently
+// deleted first, into results.
+func (b mongoBin) list(ctx context.Context, filter bson.M, results interface{}) error {
+	opts := options.Find().SetSort(bson.M{b.deletedAt + ".time": -1})
+	cursor, err := collection(b.collection).Find(ctx, models.Deleted(filter, b.deletedAt), opts)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+type mongoFoods struct{}
+
+func (mongoFoods) Create(ctx context.Context, food *models.Food) error {
+	if food.ID.IsZero() {
+		food.ID = primitive.NewObjectID()
+	}
+	_, err := collection("foods").InsertOne(ctx, food)
+	if err == nil {
+		undoInsert(ctx, "foods", bson.M{"_id": food.ID})
+	}
+	return mongoError(err)
+}
+
+func (mongoFoods) ByID(ctx context.Context, storeID string, id primitive.ObjectID) (models.Food, error) {
+	return findFood(ctx, bson.M{"_id": id, "storeId": storeID})
+}
+
+func (mongoFoods) ByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.Food, error) {
+	return findFoods(ctx, models.NotDeleted(bson.M{"_id": bson.M{"$in": ids}}, models.FoodDeletedAt))
+}
+
+func (mongoFoods) ByName(ctx context.Context, storeID, name string) (models.Food, error) {
+	return findFood(ctx, bson.M{"storeId": storeID, "name": name})
+}
+
+func (mongoFoods) BySKU(ctx context.Context, storeID, sku string) (models.Food, error) {
+	return findFood(ctx, bson.M{"storeId": storeID, "sku": sku})
+}
+
+func (mongoFoods) WithPromotion(ctx context.Context, scheduleID string) (models.Food, error) {
+	return findFood(ctx, bson.M{"promotion.scheduleId": scheduleID})
+}
+
+func findFood(ctx context.Context, filter bson.M) (models.Food, error) {
+	var food models.Food
+	err := collection("foods").FindOne(ctx, models.NotDeleted(filter, models.FoodDeletedAt)).Decode(&food)
+	return food, mongoError(err)
+}
+
+func findFoods(ctx context.Context, filter bson.M) ([]models.Food, error) {
+	cursor, err := collection("foods").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	foods := []models.Food{}
+	err = cursor.All(ctx, &foods)
+	return foods, err
+}
+
+func (mongoFoods) Find(ctx context.Context, query models.FoodQuery) ([]models.Food, error) {
+	return findFoods(ctx, query.Filter())
+}
+
+func (mongoFoods) Facets(ctx context.Context, query models.FoodQuery) (models.FoodFacets, error) {
+	cursor, err := collection("foods").Aggregate(ctx, query.FacetPipeline())
+	if err != nil {
+		return models.FoodFacets{}, err
+	}
+	var results []models.FacetResult
+	if err := cursor.All(ctx, &results); err != nil {
+		return models.FoodFacets{}, err
+	}
+	if len(results) != 1 {
+		return models.FoodFacets{}, fmt.Errorf("facet pipeline returned %d results", len(results))
+	}
+	return results[0].DecodeFacets(), nil
+}
+
+func (mongoFoods) Tags(ctx context.Context, storeID string) ([]string, error) {
+	values, err := collection("foods").Distinct(ctx, "tags", models.NotDeleted(bson.M{"storeId": storeID}, models.FoodDeletedAt))
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for _, value := range values {
+		if tag, ok := value.(string); ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+func (mongoFoods) Update(ctx context.Context, food *models.Food, fields ...string) error {
+	set, err := setFields(food, fields)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	set["updatedAt"] = now
+	filter := bson.M{"_id": food.ID, "version": food.Version}
+	result, err := collection("foods").UpdateOne(ctx, filter, bson.M{"$set": set, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		return mongoError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	food.Version++
+	food.UpdatedAt = now
+	return nil
+}
+
+func (mongoFoods) RemoveCategory(ctx context.Context, storeID, categoryID string) error {
+	filter := bson.M{"storeId": storeID, "categories.categoryId": categoryID}
+	update := bson.M{
+		"$pull": bson.M{"categories": bson.M{"categoryId": categoryID}},
+		"$set":  bson.M{"updatedAt": time.Now()},
+		"$inc":  bson.M{"version": 1},
+	}
+	_, err := collection("foods").UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (mongoFoods) AdjustStock(ctx context.Context, storeID string, id primitive.ObjectID, delta int) (models.Food, error) {
+	filter := bson.M{"_id": id, "storeId": storeID}
+	if delta < 0 {
+		if err := collection("foods").FindOne(ctx, filter).Err(); err != nil {
+			return models.Food{}, mongoError(err)
+		}
+		filter["stock"] = bson.M{"$gte": -delta}
+	}
+
+	var food models.Food
+	update := bson.M{"$inc": bson.M{"stock": delta}, "$set": bson.M{"updatedAt": time.Now()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := collection("foods").FindOneAndUpdate(ctx, filter, update, opts).Decode(&food)
+	if errors.Is(err, mongo.ErrNoDocuments) && delta < 0 {
+		return food, ErrInsufficientStock
+	}
+	return food, mongoError(err)
+}
+
+func (mongoFoods) Stocked(ctx context.Context, ids []primitive.ObjectID, ingredientIDs []string) ([]models.Food, error) {
+	return findFoods(ctx, bson.M{"$or": []bson.M{
+		{"_id": bson.M{"$in": ids}},
+		{"ingredients.ingredientId": bson.M{"$in": ingredientIDs}},
+	}})
+}
+
+func (mongoFoods) SetSoldOut(ctx context.Context, id primitive.ObjectID, soldOut bool) error {
+	_, err := collection("foods").UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"soldOut": soldOut}})
+	return err
+}
+
+func (mongoFoods) LowStock(ctx context.Context, storeID string) ([]models.Food, error) {
+	lowStock := bson.M{"$lte": []string{"$stock", "$lowStockThreshold"}}
+	return findFoods(ctx, models.NotDeleted(bson.M{"storeId": storeID, "trackStock": true, "$expr": lowStock}, models.FoodDeletedAt))
+}
+
+func (mongoFoods) ApplyRating(ctx context.Context, id primitive.ObjectID, sumDelta, countDelta int) error {
+	pipeline := []bson.M{
+		{"$set": bson.M{
+			"ratingSum":   bson.M{"$add": []interface{}{bson.M{"$ifNull": []interface{}{"$ratingSum", 0}}, sumDelta}},
+			"ratingCount": bson.M{"$add": []interface{}{bson.M{"$ifNull": []interface{}{"$ratingCount", 0}}, countDelta}},
+		}},
+		{"$set": bson.M{
+			"stars": bson.M{"$cond": []interface{}{
+				bson.M{"$gt": []interface{}{"$ratingCount", 0}},
+				bson.M{"$round": []interface{}{bson.M{"$divide": []interface{}{"$ratingSum", "$ratingCount"}}, 1}},
+				0,
+			}},
+		}},
+	}
+	_, err := collection("foods").UpdateOne(ctx, bson.M{"_id": id}, pipeline)
+	return err
+}
+
+func (mongoFoods) Delete(ctx context.Context, storeID, id string) error {
+	return foodBin.setDeleted(ctx, foodFilter(storeID, id), bson.M{"$inc": bson.M{"version": 1}}, true)
+}
+
+func (mongoFoods) Restore(ctx context.Context, storeID, id string) error {
+	return foodBin.setDeleted(ctx, foodFilter(storeID, id), bson.M{"$inc": bson.M{"version": 1}}, false)
+}
+
+// foodFilter matches the store's food with the hex ID, or nothing when the
+// ID is malformed.
+func foodFilter(storeID, id string) bson.M {
+	oid, _ := primitive.ObjectIDFromHex(id)
+	return bson.M{"_id": oid, "storeId": storeID}
+}
+
+func (mongoFoods) Deleted(ctx context.Context, storeID string) ([]models.Food, error) {
+	foods := []models.Food{}
+	err := foodBin.list(ctx, bson.M{"storeId": storeID}, &foods)
+	return foods, err
+}
+
+func (mongoFoods) Purge(ctx context.Context, cutoff time.Time) ([]models.Food, error) {
+	purged, err := findFoods(ctx, models.DeletedBefore(cutoff, models.FoodDeletedAt))
+	if err != nil {
+		return nil, err
+	}
+	for i, food := range purged {
+		if _, err := collection("foods").DeleteOne(ctx, bson.M{"_id": food.ID}); err != nil {
+			return purged[:i], err
+		}
+	}
+	return purged, nil
+}
+
+type mongoOrders struct{}
+
+func (mongoOrders) Create(ctx context.Context, order *models.Order) error {
+	_, err := collection("orders").InsertOne(ctx, order)
+	if err == nil {
+		undoInsert(ctx, "orders", bson.M{"id": order.ID})
+	}
+	return mongoError(err)
+}
+
+func (mongoOrders) ByID(ctx context.Context, id string) (models.Order, error) {
+	return findOrder(ctx, bson.M{"id": id})
+}
+
+func (mongoOrders) Pending(ctx context.Context, storeID, userID string) (models.Order, error) {
+	return findOrder(ctx, bson.M{"storeId": storeID, "userId": userID, "status": "Pending"})
+}
+
+func findOrder(ctx context.Context, filter bson.M) (models.Order, error) {
+	var order models.Order
+	err := collection("orders").FindOne(ctx, models.NotDeleted(filter, models.OrderDeletedAt)).Decode(&order)
+	return order, mongoError(err)
+}
+
+func (mongoOrders) List(ctx context.Context, storeID, status string) ([]models.Order, error) {
+	filter := models.NotDeleted(bson.M{"storeId": storeID}, models.OrderDeletedAt)
+	if status != "" {
+		filter["status"] = status
+	}
+	return findOrders(ctx, filter, options.Find().SetSort(bson.M{"createdAt": -1}))
+}
+
+func findOrders(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.Order, error) {
+	cursor, err := collection("orders").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	orders := []models.Order{}
+	err = cursor.All(ctx, &orders)
+	return orders, err
+}
+
+func (mongoOrders) Pay(ctx context.Context, paymentID string) (models.Order, error) {
+	filter := models.NotDeleted(bson.M{"paymentId": paymentID, "status": "Pending"}, models.OrderDeletedAt)
+	return updateOrderStatus(ctx, filter, "Paid")
+}
+
+func (mongoOrders) Transition(ctx context.Context, storeID, id, from, to string) (models.Order, error) {
+	filter := models.NotDeleted(bson.M{"id": id, "storeId": storeID, "status": from}, models.OrderDeletedAt)
+	return updateOrderStatus(ctx, filter, to)
+}
+
+func updateOrderStatus(ctx context.Context, filter bson.M, status string) (models.Order, error) {
+	var order models.Order
+	update := bson.M{"$set": bson.M{"status": status, "updatedAt": time.Now()}}
+	err := collection("orders").FindOneAndUpdate(ctx, filter, update).Decode(&order)
+	return order, mongoError(err)
+}
+
+func (mongoOrders) Kitchen(ctx context.Context, storeID string) ([]models.Order, error) {
+	filter := models.NotDeleted(bson.M{"storeId": storeID, "status": "Paid", "releasedAt": bson.M{"$ne": nil}}, models.OrderDeletedAt)
+	return findOrders(ctx, filter, options.Find().SetSort(bson.M{"releasedAt": 1}))
+}
+
+func (mongoOrders) Statuses(ctx context.Context, storeID string) ([]string, error) {
+	values, err := collection("orders").Distinct(ctx, "status", models.NotDeleted(bson.M{"storeId": storeID}, models.OrderDeletedAt))
+	if err != nil {
+		return nil, err
+	}
+	statuses := []string{}
+	for _, value := range values {
+		if status, ok := value.(string); ok {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+func (mongoOrders) Delivered(ctx context.Context, userID string, foodID primitive.ObjectID) (models.Order, error) {
+	return findOrder(ctx, bson.M{"userId": userID, "status": "Delivered", "items.food._id": foodID})
+}
+
+func (mongoOrders) UnreserveStock(ctx context.Context, id string) (models.Order, error) {
+	var order models.Order
+	err := collection("orders").FindOneAndUpdate(ctx,
+		bson.M{"id": id, "stockReserved": true},
+		bson.M{"$set": bson.M{"stockReserved": false}},
+	).Decode(&order)
+	return order, mongoError(err)
+}
+
+func (mongoOrders) ReleaseDue(ctx context.Context, before, now time.Time) (int, error) {
+	filter := bson.M{
+		"scheduledFor": bson.M{"$ne": nil, "$lte": before},
+		"releasedAt":   nil,
+		"status":       bson.M{"$nin": []string{"Cancelled", "PaymentFailed"}},
+	}
+	models.NotDeleted(filter, models.OrderDeletedAt)
+	update := bson.M{"$set": bson.M{"releasedAt": now, "updatedAt": now}}
+
+	result, err := collection("orders").UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+func (mongoOrders) Delete(ctx context.Context, storeID, id string) error {
+	return orderBin.setDeleted(ctx, bson.M{"id": id, "storeId": storeID}, bson.M{}, true)
+}
+
+func (mongoOrders) Restore(ctx context.Context, storeID, id string) error {
+	return orderBin.setDeleted(ctx, bson.M{"id": id, "storeId": storeID}, bson.M{}, false)
+}
+
+func (mongoOrders) Deleted(ctx context.Context, storeID string) ([]models.Order, error) {
+	orders := []models.Order{}
+	err := orderBin.list(ctx, bson.M{"storeId": storeID}, &orders)
+	return orders, err
+}
+
+func (mongoOrders) Purge(ctx context.Context, cutoff time.Time) (int, error) {
+	result, err := collection("orders").DeleteMany(ctx, models.DeletedBefore(cutoff, models.OrderDeletedAt))
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
+
+type mongoOutbox struct{}
+
+func (mongoOutbox) Add(ctx context.Context, event events.Event) error {
+	_, err := collection("outbox").InsertOne(ctx, events.NewRecord(event))
+	if err == nil {
+		undoInsert(ctx, "outbox", bson.M{"id": event.ID})
+	}
+	return err
+}
+
+func (mongoOutbox) Claim(ctx context.Context, now, until time.Time, limit int) ([]events.Record, error) {
+	due := bson.M{"dispatchedAt": nil, "deadAt": nil, "nextAttemptAt": bson.M{"$lte": now}}
+	opts := options.Find().SetSort(bson.M{"occurredAt": 1}).SetLimit(int64(limit))
+	cursor, err := collection("outbox").Find(ctx, due, opts)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []events.Record{}
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return nil, err
+	}
+
+	// Another dispatcher may have claimed a candidate in the meantime
+	claimed := []events.Record{}
+	for _, record := range candidates {
+		filter := bson.M{"id": record.ID, "dispatchedAt": nil, "nextAttemptAt": record.NextAttemptAt}
+		result, err := collection("outbox").UpdateOne(ctx, filter, bson.M{"$set": bson.M{"nextAttemptAt": until}})
+		if err != nil {
+			return claimed, err
+		}
+		if result.ModifiedCount == 1 {
+			claimed = append(claimed, record)
+		}
+	}
+	return claimed, nil
+}
+
+func (mongoOutbox) MarkDispatched(ctx context.Context, id string, at time.Time) error {
+	_, err := collection("outbox").UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": bson.M{"dispatchedAt": at}})
+	return err
+}
+
+func (mongoOutbox) MarkFailed(ctx context.Context, record events.Record) error {
+	update := bson.M{"$set": bson.M{
+		"attempts":      record.Attempts,
+		"nextAttemptAt": record.NextAttemptAt,
+		"lastError":     record.LastError,
+		"delivered":     record.Delivered,
+		"deadAt":        record.DeadAt,
+	}}
+	_, err := collection("outbox").UpdateOne(ctx, bson.M{"id": record.ID}, update)
+	return err
+}
+
+func (mongoOutbox) Prune(ctx context.Context, before time.Time) (int, error) {
+	result, err := collection("outbox").DeleteMany(ctx, bson.M{"dispatchedAt": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
+
+// findAll decodes the documents of a collection matching filter into
+// results.
+func findAll(ctx context.Context, name string, filter bson.M, results interface{}, opts ...*options.FindOptions) error {
+	cursor, err := collection(name).Find(ctx, filter, opts...)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+// updateOne applies update to the document of a collection matching
+// filter. ErrNotFound means none matched.
+func updateOne(ctx context.Context, name string, filter, update bson.M) error {
+	result, err := collection(name).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return mongoError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// setFields returns the named fields of a document, by their stored
+// names, for a $set.
+func setFields(document interface{}, fields []string) (bson.M, error) {
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	set := bson.M{}
+	for _, field := range fields {
+		set[field] = doc[field]
+	}
+	return set, nil
+}
+
+type mongoStores struct{}
+
+func (mongoStores) List(ctx context.Context) ([]models.Store, error) {
+	stores := []models.Store{}
+	err := findAll(ctx, "stores", bson.M{}, &stores, options.Find().SetSort(bson.M{"name": 1}))
+	return stores, err
+}
+
+func (mongoStores) ByID(ctx context.Context, id string) (models.Store, error) {
+	var store models.Store
+	err := collection("stores").FindOne(ctx, bson.M{"id": id}).Decode(&store)
+	return store, mongoError(err)
+}
+
+func (mongoStores) Create(ctx context.Context, store *models.Store) error {
+	err := collection("stores").FindOne(ctx, bson.M{"slug": store.Slug}).Err()
+	if err == nil {
+		return &DuplicateError{Field: "slug"}
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+	_, err = collection("stores").InsertOne(ctx, store)
+	return mongoError(err)
+}
+
+func (mongoStores) Update(ctx context.Context, store *models.Store, fields ...string) error {
+	set, err := setFields(store, fields)
+	if err != nil {
+		return err
+	}
+	store.UpdatedAt = time.Now()
+	set["updatedAt"] = store.UpdatedAt
+	return updateOne(ctx, "stores", bson.M{"id": store.ID}, bson.M{"$set": set})
+}
+
+func (mongoStores) SlotCount(ctx context.Context, storeID string, slot time.Time) (int, error) {
+	var counter struct{ Count int }
+	err := collection("order_slots").FindOne(ctx, bson.M{"id": slotKey(storeID, slot)}).Decode(&counter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	return counter.Count, err
+}
+
+func (mongoStores) TakeSlot(ctx context.Context, storeID string, slot time.Time) (int, error) {
+	var counter struct{ Count int }
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := collection("order_slots").FindOneAndUpdate(ctx, bson.M{"id": slotKey(storeID, slot)}, bson.M{"$inc": bson.M{"count": 1}}, opts).Decode(&counter)
+	return counter.Count, err
+}
+
+func (mongoStores) ReleaseSlot(ctx context.Context, storeID string, slot time.Time) error {
+	filter := bson.M{"id": slotKey(storeID, slot), "count": bson.M{"$gt": 0}}
+	_, err := collection("order_slots").UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"count": -1}})
+	return err
+}
+
+type mongoCategories struct{}
+
+func (mongoCategories) List(ctx context.Context, storeID string) ([]models.Category, error) {
+	categories := []models.Category{}
+	err := findAll(ctx, "categories", bson.M{"storeId": storeID}, &categories)
+	return categories, err
+}
+
+func (mongoCategories) ByID(ctx context.Context, storeID, id string) (models.Category, error) {
+	var category models.Category
+	err := collection("categories").FindOne(ctx, bson.M{"id": id, "storeId": storeID}).Decode(&category)
+	return category, mongoError(err)
+}
+
+func (mongoCategories) Create(ctx context.Context, category *models.Category) error {
+	_, err := collection("categories").InsertOne(ctx, category)
+	return mongoError(err)
+}
+
+func (mongoCategories) Update(ctx context.Context, category *models.Category) error {
+	result, err := collection("categories").ReplaceOne(ctx, bson.M{"id": category.ID, "storeId": category.StoreID}, category)
+	if err != nil {
+		return mongoError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (mongoCategories) HasChildren(ctx context.Context, storeID, id string) (bool, error) {
+	err := collection("categories").FindOne(ctx, bson.M{"storeId": storeID, "parentId": id}).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (mongoCategories) Delete(ctx context.Context, storeID, id string) error {
+	result, err := collection("categories").DeleteOne(ctx, bson.M{"id": id, "storeId": storeID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoFavorites struct{}
+
+func (mongoFavorites) FoodIDs(ctx context.Context, userID string) ([]string, error) {
+	var favorites []models.UserFavorite
+	if err := findAll(ctx, "user_favorites", bson.M{"userId": userID}, &favorites); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(favorites))
+	for i, favorite := range favorites {
+		ids[i] = favorite.FoodID
+	}
+	return ids, nil
+}
+
+func (mongoFavorites) Add(ctx context.Context, favorite *models.UserFavorite) error {
+	filter := bson.M{"userId": favorite.UserID, "foodId": favorite.FoodID}
+	_, err := collection("user_favorites").UpdateOne(ctx, filter, bson.M{"$setOnInsert": favorite}, options.Update().SetUpsert(true))
+	return mongoError(err)
+}
+
+func (mongoFavorites) Remove(ctx context.Context, userID, foodID string) error {
+	_, err := collection("user_favorites").DeleteOne(ctx, bson.M{"userId": userID, "foodId": foodID})
+	return err
+}
+
+func (mongoFavorites) RemoveFoods(ctx context.Context, foodIDs []string) error {
+	_, err := collection("user_favorites").DeleteMany(ctx, bson.M{"foodId": bson.M{"$in": foodIDs}})
+	return err
+}
+
+func (mongoFavorites) RemoveUsers(ctx context.Context, userIDs []string) error {
+	_, err := collection("user_favorites").DeleteMany(ctx, bson.M{"userId": bson.M{"$in": userIDs}})
+	return err
+}
+
+type mongoInventory struct{}
+
+func (mongoInventory) Ingredients(ctx context.Context, storeID string) ([]models.Ingredient, error) {
+	ingredients := []models.Ingredient{}
+	err := findAll(ctx, "ingredients", bson.M{"storeId": storeID}, &ingredients, options.Find().SetSort(bson.M{"name": 1}))
+	return ingredients, err
+}
+
+func (mongoInventory) IngredientsByID(ctx context.Context, ids []string) ([]models.Ingredient, error) {
+	ingredients := []models.Ingredient{}
+	err := findAll(ctx, "ingredients", bson.M{"id": bson.M{"$in": ids}}, &ingredients)
+	return ingredients, err
+}
+
+func (mongoInventory) LowStockIngredients(ctx context.Context, storeID string) ([]models.Ingredient, error) {
+	lowStock := bson.M{"$lte": []string{"$stock", "$lowStockThreshold"}}
+	ingredients := []models.Ingredient{}
+	err := findAll(ctx, "ingredients", bson.M{"storeId": storeID, "$expr": lowStock}, &ingredients)
+	return ingredients, err
+}
+
+func (mongoInventory) CreateIngredient(ctx context.Context, ingredient *models.Ingredient) error {
+	_, err := collection("ingredients").InsertOne(ctx, ingredient)
+	return mongoError(err)
+}
+
+func (mongoInventory) AdjustIngredient(ctx context.Context, storeID, id string, delta float64) (models.Ingredient, error) {
+	filter := bson.M{"id": id, "storeId": storeID}
+	if delta < 0 {
+		if err := collection("ingredients").FindOne(ctx, filter).Err(); err != nil {
+			return models.Ingredient{}, mongoError(err)
+		}
+		filter["stock"] = bson.M{"$gte": -delta}
+	}
+
+	var ingredient models.Ingredient
+	update := bson.M{"$inc": bson.M{"stock": delta}, "$set": bson.M{"updatedAt": time.Now()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := collection("ingredients").FindOneAndUpdate(ctx, filter, update, opts).Decode(&ingredient)
+	if errors.Is(err, mongo.ErrNoDocuments) && delta < 0 {
+		return ingredient, ErrInsufficientStock
+	}
+	return ingredient, mongoError(err)
+}
+
+func (mongoInventory) AddAdjustment(ctx context.Context, adjustment *models.StockAdjustment) error {
+	_, err := collection("stock_adjustments").InsertOne(ctx, adjustment)
+	if err == nil {
+		undoInsert(ctx, "stock_adjustments", bson.M{"id": adjustment.ID})
+	}
+	return mongoError(err)
+}
+
+func (mongoInventory) Adjustments(ctx context.Context, storeID, targetID string, limit int) ([]models.StockAdjustment, error) {
+	filter := bson.M{"storeId": storeID}
+	if targetID != "" {
+		filter["targetId"] = targetID
+	}
+	adjustments := []models.StockAdjustment{}
+	opts := options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(int64(limit))
+	err := findAll(ctx, "stock_adjustments", filter, &adjustments, opts)
+	return adjustments, err
+}
+
+type mongoReviews struct{}
+
+func (mongoReviews) Approved(ctx context.Context, foodID string) ([]models.Review, error) {
+	reviews := []models.Review{}
+	opts := options.Find().SetSort(bson.D{{Key: "helpfulVotes", Value: -1}, {Key: "createdAt", Value: -1}})
+	err := findAll(ctx, "reviews", bson.M{"foodId": foodID, "status": models.ReviewApproved}, &reviews, opts)
+	return reviews, err
+}
+
+func (mongoReviews) Pending(ctx context.Context, storeID string) ([]models.Review, error) {
+	reviews := []models.Review{}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	err := findAll(ctx, "reviews", bson.M{"storeId": storeID, "status": models.ReviewPending}, &reviews, opts)
+	return reviews, err
+}
+
+func (mongoReviews) ByID(ctx context.Context, storeID, id string) (models.Review, error) {
+	return findReview(ctx, bson.M{"id": id, "storeId": storeID})
+}
+
+func (mongoReviews) ByUser(ctx context.Context, foodID, userID string) (models.Review, error) {
+	return findReview(ctx, bson.M{"foodId": foodID, "userId": userID})
+}
+
+func findReview(ctx context.Context, filter bson.M) (models.Review, error) {
+	var review models.Review
+	err := collection("reviews").FindOne(ctx, filter).Decode(&review)
+	return review, mongoError(err)
+}
+
+func (mongoReviews) Create(ctx context.Context, review *models.Review) error {
+	if review.HelpfulBy == nil {
+		review.HelpfulBy = []string{}
+	}
+	_, err := collection("reviews").InsertOne(ctx, review)
+	return mongoError(err)
+}
+
+func (mongoReviews) Moderate(ctx context.Context, id, from, to, moderatedBy string) error {
+	update := bson.M{"$set": bson.M{"status": to, "moderatedBy": moderatedBy, "updatedAt": time.Now()}}
+	return updateOne(ctx, "reviews", bson.M{"id": id, "status": from}, update)
+}
+
+func (mongoReviews) VoteHelpful(ctx context.Context, id, userID string) error {
+	filter := bson.M{"id": id, "status": models.ReviewApproved}
+	if err := collection("reviews").FindOne(ctx, filter).Err(); err != nil {
+		return mongoError(err)
+	}
+
+	filter["helpfulBy"] = bson.M{"$ne": userID}
+	update := bson.M{
+		"$addToSet": bson.M{"helpfulBy": userID},
+		"$inc":      bson.M{"helpfulVotes": 1},
+	}
+	_, err := collection("reviews").UpdateOne(ctx, filter, update)
+	return err
+}
+
+type mongoPrices struct{}
+
+func (mongoPrices) Record(ctx context.Context, change *models.PriceChange) error {
+	_, err := collection("price_history").InsertOne(ctx, change)
+	if err == nil {
+		undoInsert(ctx, "price_history", bson.M{"id": change.ID})
+	}
+	return mongoError(err)
+}
+
+func (mongoPrices) History(ctx context.Context, foodID string) ([]models.PriceChange, error) {
+	history := []models.PriceChange{}
+	err := findAll(ctx, "price_history", bson.M{"foodId": foodID}, &history, options.Find().SetSort(bson.M{"createdAt": -1}))
+	return history, err
+}
+
+func (mongoPrices) Schedules(ctx context.Context, foodID string) ([]models.PriceSchedule, error) {
+	return findSchedules(ctx, bson.M{"foodId": foodID})
+}
+
+func findSchedules(ctx context.Context, filter bson.M) ([]models.PriceSchedule, error) {
+	schedules := []models.PriceSchedule{}
+	err := findAll(ctx, "price_schedules", filter, &schedules, options.Find().SetSort(bson.M{"startsAt": 1}))
+	return schedules, err
+}
+
+func (mongoPrices) Schedule(ctx context.Context, foodID, id string) (models.PriceSchedule, error) {
+	var schedule models.PriceSchedule
+	err := collection("price_schedules").FindOne(ctx, bson.M{"id": id, "foodId": foodID}).Decode(&schedule)
+	return schedule, mongoError(err)
+}
+
+func (mongoPrices) CreateSchedule(ctx context.Context, schedule *models.PriceSchedule) error {
+	_, err := collection("price_schedules").InsertOne(ctx, schedule)
+	return mongoError(err)
+}
+
+func (mongoPrices) UpdateSchedule(ctx context.Context, schedule *models.PriceSchedule, from string) error {
+	schedule.UpdatedAt = time.Now()
+	update := bson.M{"$set": bson.M{"status": schedule.Status, "endsAt": schedule.EndsAt, "updatedAt": schedule.UpdatedAt}}
+	return updateOne(ctx, "price_schedules", bson.M{"id": schedule.ID, "status": from}, update)
+}
+
+func (mongoPrices) Due(ctx context.Context, now time.Time) ([]models.PriceSchedule, error) {
+	return findSchedules(ctx, bson.M{"status": models.PriceScheduled, "startsAt": bson.M{"$lte": now}})
+}
+
+func (mongoPrices) Ended(ctx context.Context, now time.Time) ([]models.PriceSchedule, error) {
+	return findSchedules(ctx, bson.M{"status": models.PriceActive, "endsAt": bson.M{"$lte": now}})
+}
+
+type mongoWebhooks struct{}
+
+func (mongoWebhooks) List(ctx context.Context, storeID string) ([]models.Webhook, error) {
+	hooks := []models.Webhook{}
+	err := findAll(ctx, "webhooks", bson.M{"storeId": storeID}, &hooks, options.Find().SetSort(bson.M{"createdAt": 1}))
+	return hooks, err
+}
+
+func (mongoWebhooks) ByID(ctx context.Context, storeID, id string) (models.Webhook, error) {
+	var hook models.Webhook
+	err := collection("webhooks").FindOne(ctx, bson.M{"id": id, "storeId": storeID}).Decode(&hook)
+	return hook, mongoError(err)
+}
+
+func (mongoWebhooks) Subscribed(ctx context.Context, storeID, eventType string) ([]models.Webhook, error) {
+	filter := bson.M{"storeId": storeID, "active": true, "$or": []bson.M{
+		{"eventTypes": eventType},
+		{"eventTypes": bson.M{"$size": 0}},
+		{"eventTypes": nil},
+	}}
+	hooks := []models.Webhook{}
+	err := findAll(ctx, "webhooks", filter, &hooks)
+	return hooks, err
+}
+
+func (mongoWebhooks) Create(ctx context.Context, hook *models.Webhook) error {
+	_, err := collection("webhooks").InsertOne(ctx, hook)
+	return mongoError(err)
+}
+
+func (mongoWebhooks) Update(ctx context.Context, hook *models.Webhook) error {
+	hook.UpdatedAt = time.Now()
+	update := bson.M{"$set": bson.M{
+		"url":        hook.URL,
+		"eventTypes": hook.EventTypes,
+		"active":     hook.Active,
+		"updatedAt":  hook.UpdatedAt,
+	}}
+	return updateOne(ctx, "webhooks", bson.M{"id": hook.ID, "storeId": hook.StoreID}, update)
+}
+
+func (mongoWebhooks) Delete(ctx context.Context, storeID, id string) error {
+	result, err := collection("webhooks").DeleteOne(ctx, bson.M{"id": id, "storeId": storeID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (mongoWebhooks) AddDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	_, err := collection("webhook_deliveries").InsertOne(ctx, delivery)
+	return mongoError(err)
+}
+
+func (mongoWebhooks) Deliveries(ctx context.Context, storeID, webhookID, status string, limit int) ([]models.WebhookDelivery, error) {
+	filter := bson.M{"webhookId": webhookID, "storeId": storeID}
+	if status != "" {
+		filter["status"] = status
+	}
+	deliveries := []models.WebhookDelivery{}
+	opts := options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(int64(limit))
+	err := findAll(ctx, "webhook_deliveries", filter, &deliveries, opts)
+	return deliveries, err
+}
+
+func (mongoWebhooks) Redeliver(ctx context.Context, storeID, id string, now time.Time) error {
+	update := bson.M{"$set": bson.M{
+		"status":        models.DeliveryPending,
+		"attempts":      0,
+		"nextAttemptAt": now,
+		"updatedAt":     now,
+	}}
+	return updateOne(ctx, "webhook_deliveries", bson.M{"id": id, "storeId": storeID}, update)
+}
+
+func (mongoWebhooks) Due(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	due := bson.M{"status": models.DeliveryPending, "nextAttemptAt": bson.M{"$lte": now}}
+	deliveries := []models.WebhookDelivery{}
+	opts := options.Find().SetSort(bson.M{"nextAttemptAt": 1}).SetLimit(int64(limit))
+	err := findAll(ctx, "webhook_deliveries", due, &deliveries, opts)
+	return deliveries, err
+}
+
+func (mongoWebhooks) Claim(ctx context.Context, delivery models.WebhookDelivery, until time.Time) (bool, error) {
+	claim := bson.M{"id": delivery.ID, "status": models.DeliveryPending, "nextAttemptAt": delivery.NextAttemptAt}
+	result, err := collection("webhook_deliveries").UpdateOne(ctx, claim, bson.M{"$set": bson.M{"nextAttemptAt": until}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (mongoWebhooks) RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	update := bson.M{"$set": bson.M{
+		"status":         delivery.Status,
+		"attempts":       delivery.Attempts,
+		"nextAttemptAt":  delivery.NextAttemptAt,
+		"lastAttemptAt":  delivery.LastAttemptAt,
+		"lastStatusCode": delivery.LastStatusCode,
+		"lastError":      delivery.LastError,
+		"updatedAt":      delivery.UpdatedAt,
+	}}
+	return updateOne(ctx, "webhook_deliveries", bson.M{"id": delivery.ID}, update)
+}
+
+type mongoPasswordResets struct{}
+
+func (mongoPasswordResets) Create(ctx context.Context, reset *models.PasswordReset) error {
+	_, err := collection("password_resets").InsertOne(ctx, reset)
+	return mongoError(err)
+}
+
+func (mongoPasswordResets) Claim(ctx context.Context, tokenHash string, now time.Time) (models.PasswordReset, error) {
+	var reset models.PasswordReset
+	err := collection("password_resets").FindOneAndUpdate(ctx,
+		bson.M{"tokenHash": tokenHash, "usedAt": nil, "expiresAt": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"usedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&reset)
+	return reset, mongoError(err)
+}
+
+func (mongoPasswordResets) Discard(ctx context.Context, userID string, now time.Time) error {
+	_, err := collection("password_resets").UpdateMany(ctx,
+		bson.M{"userId": userID, "usedAt": nil},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	)
+	return err
+}
@@ -0,0 +1,358 @@
+// Package repository stores the application's data in Mongo or, through
+// GORM, in SQLite or Postgres.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go_backend/events"
+	"go_backend/models"
+	"go_backend/uow"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotFound is returned when the requested record doesn't exist or has
+// been soft-deleted.
+var ErrNotFound = errors.New("not found")
+
+// ErrInsufficientStock is returned when a stock change would take a stock
+// level below zero.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// DuplicateError is returned when a write would break a unique constraint.
+// Field is the request field it is reported against, if known.
+type DuplicateError struct {
+	Field string
+}
+
+func (e *DuplicateError) Error() string {
+	if e.Field == "" {
+		return "duplicate key"
+	}
+	return "duplicate " + e.Field
+}
+
+// Trash soft-deletes records. storeID scopes store-owned records and is
+// ignored for the others.
+type Trash interface {
+	// Delete moves a record to the trash. ErrNotFound means there is no
+	// such record outside the trash.
+	Delete(ctx context.Context, storeID, id string) error
+	// Restore brings a record back from the trash. ErrNotFound means it
+	// isn't in the trash.
+	Restore(ctx context.Context, storeID, id string) error
+}
+
+// Users stores user accounts.
+type Users interface {
+	Trash
+	Create(ctx context.Context, user *models.User) error
+	ByID(ctx context.Context, id string) (models.User, error)
+	ByEmail(ctx context.Context, email string) (models.User, error)
+	// Search lists the users whose name or email contains term, ignoring
+	// case. An empty term lists everyone.
+	Search(ctx context.Context, term string) ([]models.User, error)
+	// Update saves the user's name, email, password, address, allergens
+	// and flags.
+	Update(ctx context.Context, user *models.User) error
+	// Deleted lists the users in the trash, most recently deleted first.
+	Deleted(ctx context.Context) ([]models.User, error)
+	// Purge permanently removes the users deleted before cutoff and
+	// returns their IDs.
+	Purge(ctx context.Context, cutoff time.Time) ([]string, error)
+}
+
+// Foods stores the menu. Stock, ratings and the sold out flag belong to
+// foods whether or not they are in the trash, so past orders can still
+// be cancelled and reviewed.
+type Foods interface {
+	Trash
+	Create(ctx context.Context, food *models.Food) error
+	ByID(ctx context.Context, storeID string, id primitive.ObjectID) (models.Food, error)
+	// ByIDs returns the foods with any of the IDs, whatever their store.
+	ByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.Food, error)
+	// ByName and BySKU find a store's food by its name or SKU.
+	ByName(ctx context.Context, storeID, name string) (models.Food, error)
+	BySKU(ctx context.Context, storeID, sku string) (models.Food, error)
+	// WithPromotion returns the food running the promotion scheduled by
+	// scheduleID.
+	WithPromotion(ctx context.Context, scheduleID string) (models.Food, error)
+	Find(ctx context.Context, query models.FoodQuery) ([]models.Food, error)
+	// Facets counts the tags, origins, prices and stars of the foods
+	// matching query.
+	Facets(ctx context.Context, query models.FoodQuery) (models.FoodFacets, error)
+	// Tags lists the distinct tags of a store's foods.
+	Tags(ctx context.Context, storeID string) ([]string, error)
+	// Update saves the named fields of food, given by their JSON names,
+	// and moves it to the next Version. ErrNotFound means the stored food
+	// is no longer at food.Version, so changes made to a stale copy are
+	// refused. On success food carries its new Version and UpdatedAt.
+	Update(ctx context.Context, food *models.Food, fields ...string) error
+	// RemoveCategory takes every food of the store out of a category.
+	RemoveCategory(ctx context.Context, storeID, categoryID string) error
+	// AdjustStock adds delta to a food's stock and returns the food as
+	// changed. ErrInsufficientStock means the stock would go below zero.
+	AdjustStock(ctx context.Context, storeID string, id primitive.ObjectID, delta int) (models.Food, error)
+	// Stocked returns the foods with any of the IDs or made with any of
+	// the ingredients, for recomputing their SoldOut flag.
+	Stocked(ctx context.Context, ids []primitive.ObjectID, ingredientIDs []string) ([]models.Food, error)
+	SetSoldOut(ctx context.Context, id primitive.ObjectID, soldOut bool) error
+	// LowStock lists a store's tracked foods at or below their low-stock
+	// threshold.
+	LowStock(ctx context.Context, storeID string) ([]models.Food, error)
+	// ApplyRating adds to a food's rating totals and recomputes its Stars
+	// in a single write.
+	ApplyRating(ctx context.Context, id primitive.ObjectID, sumDelta, countDelta int) error
+	// Deleted lists a store's foods in the trash, most recently deleted
+	// first.
+	Deleted(ctx context.Context, storeID string) ([]models.Food, error)
+	// Purge permanently removes the foods deleted before cutoff and
+	// returns them.
+	Purge(ctx context.Context, cutoff time.Time) ([]models.Food, error)
+}
+
+// Orders stores orders along with their items.
+type Orders interface {
+	Trash
+	Create(ctx context.Context, order *models.Order) error
+	ByID(ctx context.Context, id string) (models.Order, error)
+	// List returns a store's orders, only those in status unless it is
+	// empty.
+	List(ctx context.Context, storeID, status string) ([]models.Order, error)
+	// Kitchen lists a store's paid orders that have been released to the
+	// kitchen, oldest release first.
+	Kitchen(ctx context.Context, storeID string) ([]models.Order, error)
+	// Statuses lists the distinct statuses of a store's orders.
+	Statuses(ctx context.Context, storeID string) ([]string, error)
+	// Pending returns the user's order awaiting payment.
+	Pending(ctx context.Context, storeID, userID string) (models.Order, error)
+	// Delivered returns one of the user's delivered orders containing the
+	// food.
+	Delivered(ctx context.Context, userID string, foodID primitive.ObjectID) (models.Order, error)
+	// Pay marks the pending order with paymentID as paid and returns it as
+	// it was before. ErrNotFound means there is no such pending order, so
+	// cancelled and failed orders can't be paid.
+	Pay(ctx context.Context, paymentID string) (models.Order, error)
+	// Transition moves an order from one status to another and returns it
+	// as it was before. ErrNotFound means it isn't in status from.
+	Transition(ctx context.Context, storeID, id, from, to string) (models.Order, error)
+	// UnreserveStock clears the order's StockReserved flag and returns the
+	// order. ErrNotFound means its stock isn't reserved, so stock is
+	// released at most once.
+	UnreserveStock(ctx context.Context, id string) (models.Order, error)
+	// ReleaseDue releases to the kitchen, at now, the scheduled orders due
+	// by before that haven't been cancelled or failed payment, and returns
+	// how many it released.
+	ReleaseDue(ctx context.Context, before, now time.Time) (int, error)
+	// Deleted lists a store's orders in the trash, most recently deleted
+	// first.
+	Deleted(ctx context.Context, storeID string) ([]models.Order, error)
+	// Purge permanently removes the orders deleted before cutoff and
+	// returns how many it removed.
+	Purge(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+// Stores stores the stores along with the counters of the order slots
+// they have handed out.
+type Stores interface {
+	// List returns every store by name.
+	List(ctx context.Context) ([]models.Store, error)
+	ByID(ctx context.Context, id string) (models.Store, error)
+	// Create adds a store. A DuplicateError for "slug" means another store
+	// has its slug.
+	Create(ctx context.Context, store *models.Store) error
+	// Update saves the named fields of store, given by their JSON names.
+	Update(ctx context.Context, store *models.Store, fields ...string) error
+	// SlotCount is how many orders have taken the store's slot starting at
+	// slot.
+	SlotCount(ctx context.Context, storeID string, slot time.Time) (int, error)
+	// TakeSlot adds an order to a slot and returns the new count.
+	TakeSlot(ctx context.Context, storeID string, slot time.Time) (int, error)
+	// ReleaseSlot gives back a place taken with TakeSlot.
+	ReleaseSlot(ctx context.Context, storeID string, slot time.Time) error
+}
+
+// slotKey identifies a store's order slot by its start.
+func slotKey(storeID string, slot time.Time) string {
+	return storeID + "/" + slot.UTC().Format(time.RFC3339)
+}
+
+// Categories stores the sections of the stores' menus.
+type Categories interface {
+	List(ctx context.Context, storeID string) ([]models.Category, error)
+	ByID(ctx context.Context, storeID, id string) (models.Category, error)
+	Create(ctx context.Context, category *models.Category) error
+	// Update replaces a category.
+	Update(ctx context.Context, category *models.Category) error
+	// HasChildren reports whether any category is nested inside id.
+	HasChildren(ctx context.Context, storeID, id string) (bool, error)
+	Delete(ctx context.Context, storeID, id string) error
+}
+
+// Favorites stores the foods each user has favorited.
+type Favorites interface {
+	// FoodIDs returns the IDs of the user's favorite foods.
+	FoodIDs(ctx context.Context, userID string) ([]string, error)
+	// Add favorites a food. Adding it again changes nothing.
+	Add(ctx context.Context, favorite *models.UserFavorite) error
+	Remove(ctx context.Context, userID, foodID string) error
+	// RemoveFoods and RemoveUsers drop every favorite of the foods or by
+	// the users.
+	RemoveFoods(ctx context.Context, foodIDs []string) error
+	RemoveUsers(ctx context.Context, userIDs []string) error
+}
+
+// Inventory stores ingredients and the audit trail of stock changes.
+type Inventory interface {
+	// Ingredients lists a store's ingredients by name.
+	Ingredients(ctx context.Context, storeID string) ([]models.Ingredient, error)
+	// IngredientsByID returns the ingredients with any of the IDs,
+	// whatever their store.
+	IngredientsByID(ctx context.Context, ids []string) ([]models.Ingredient, error)
+	// LowStockIngredients lists a store's ingredients at or below their
+	// low-stock threshold.
+	LowStockIngredients(ctx context.Context, storeID string) ([]models.Ingredient, error)
+	CreateIngredient(ctx context.Context, ingredient *models.Ingredient) error
+	// AdjustIngredient adds delta to an ingredient's stock and returns the
+	// ingredient as changed. ErrInsufficientStock means the stock would go
+	// below zero.
+	AdjustIngredient(ctx context.Context, storeID, id string, delta float64) (models.Ingredient, error)
+	AddAdjustment(ctx context.Context, adjustment *models.StockAdjustment) error
+	// Adjustments lists a store's latest stock adjustments, newest first,
+	// only those of targetID unless it is empty.
+	Adjustments(ctx context.Context, storeID, targetID string, limit int) ([]models.StockAdjustment, error)
+}
+
+// Reviews stores food reviews and who found them helpful.
+type Reviews interface {
+	// Approved lists a food's approved reviews, most helpful first.
+	Approved(ctx context.Context, foodID string) ([]models.Review, error)
+	// Pending lists a store's reviews awaiting moderation, oldest first.
+	Pending(ctx context.Context, storeID string) ([]models.Review, error)
+	ByID(ctx context.Context, storeID, id string) (models.Review, error)
+	// ByUser returns the user's review of a food.
+	ByUser(ctx context.Context, foodID, userID string) (models.Review, error)
+	Create(ctx context.Context, review *models.Review) error
+	// Moderate moves a review from one status to another. ErrNotFound
+	// means it isn't in status from.
+	Moderate(ctx context.Context, id, from, to, moderatedBy string) error
+	// VoteHelpful counts the user's helpful vote, once per user.
+	// ErrNotFound means the review isn't approved.
+	VoteHelpful(ctx context.Context, id, userID string) error
+}
+
+// Prices stores the foods' price history and price schedules.
+type Prices interface {
+	Record(ctx context.Context, change *models.PriceChange) error
+	// History lists a food's price changes, newest first.
+	History(ctx context.Context, foodID string) ([]models.PriceChange, error)
+	// Schedules lists a food's price schedules by start.
+	Schedules(ctx context.Context, foodID string) ([]models.PriceSchedule, error)
+	Schedule(ctx context.Context, foodID, id string) (models.PriceSchedule, error)
+	CreateSchedule(ctx context.Context, schedule *models.PriceSchedule) error
+	// UpdateSchedule saves a schedule's status and end. ErrNotFound means
+	// it is no longer in status from.
+	UpdateSchedule(ctx context.Context, schedule *models.PriceSchedule, from string) error
+	// Due lists the schedules starting by now, by start.
+	Due(ctx context.Context, now time.Time) ([]models.PriceSchedule, error)
+	// Ended lists the active promotions ending by now.
+	Ended(ctx context.Context, now time.Time) ([]models.PriceSchedule, error)
+}
+
+// Webhooks stores the stores' webhooks and their deliveries.
+type Webhooks interface {
+	// List returns a store's webhooks, oldest first.
+	List(ctx context.Context, storeID string) ([]models.Webhook, error)
+	ByID(ctx context.Context, storeID, id string) (models.Webhook, error)
+	// Subscribed returns a store's active webhooks subscribed to
+	// eventType.
+	Subscribed(ctx context.Context, storeID, eventType string) ([]models.Webhook, error)
+	Create(ctx context.Context, hook *models.Webhook) error
+	// Update saves a webhook's URL, event types and active flag.
+	Update(ctx context.Context, hook *models.Webhook) error
+	Delete(ctx context.Context, storeID, id string) error
+	// AddDelivery queues a delivery. A DuplicateError means the webhook
+	// already has a delivery of the event.
+	AddDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	// Deliveries lists a webhook's latest deliveries, newest first, only
+	// those in status unless it is empty.
+	Deliveries(ctx context.Context, storeID, webhookID, status string, limit int) ([]models.WebhookDelivery, error)
+	// Redeliver queues a delivery again at now with no attempts.
+	Redeliver(ctx context.Context, storeID, id string, now time.Time) error
+	// Due lists the pending deliveries due by now, oldest first.
+	Due(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	// Claim moves a due delivery's next attempt to until, so other senders
+	// skip it. It reports false when another sender got there first.
+	Claim(ctx context.Context, delivery models.WebhookDelivery, until time.Time) (bool, error)
+	// RecordAttempt saves a delivery's status, attempts, next attempt and
+	// the outcome of its last attempt.
+	RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery) error
+}
+
+// PasswordResets stores password reset tokens by their hash.
+type PasswordResets interface {
+	Create(ctx context.Context, reset *models.PasswordReset) error
+	// Claim uses up the unused token with tokenHash that is valid at now
+	// and returns it. ErrNotFound means there is no such token, so each
+	// token works once.
+	Claim(ctx context.Context, tokenHash string, now time.Time) (models.PasswordReset, error)
+	// Discard uses up the user's remaining tokens.
+	Discard(ctx context.Context, userID string, now time.Time) error
+}
+
+// Repositories is one storage backend. Writes that must happen together
+// go through Transactions, whose context the repositories join. When
+// Transactions is a uow.Memory, the records the repositories create are
+// removed again if the unit of work fails; callers undo their other writes
+// with uow.OnRollback.
+type Repositories struct {
+	Users          Users
+	Foods          Foods
+	Orders         Orders
+	Stores         Stores
+	Categories     Categories
+	Favorites      Favorites
+	Inventory      Inventory
+	Reviews        Reviews
+	Prices         Prices
+	Webhooks       Webhooks
+	PasswordResets PasswordResets
+	Outbox         events.Outbox
+	Transactions   uow.UnitOfWork
+}
+
+// UsesMongo reports whether DB_DRIVER selects the Mongo backend.
+func UsesMongo() bool {
+	driver := os.Getenv("DB_DRIVER")
+	return driver == "" || driver == "mongo"
+}
+
+// FromEnv opens the backend named by DB_DRIVER: mongo (the default),
+// sqlite, with the file in SQLITE_PATH, or postgres, with the DSN in
+// DATABASE_URL.
+func FromEnv() (Repositories, error) {
+	if UsesMongo() {
+		return OpenMongo(context.Background())
+	}
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "foodstore.db"
+		}
+		return OpenSQLite(path)
+	case "postgres":
+		dsn := os.Getenv("DATABASE_URL")
+		if dsn == "" {
+			return Repositories{}, fmt.Errorf("DATABASE_URL is required for postgres")
+		}
+		return OpenPostgres(dsn)
+	default:
+		return Repositories{}, fmt.Errorf("unknown DB_DRIVER %q", driver)
+	}
+}
@@ -0,0 +1,1502 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"go_backend/events"
+	"go_backend/models"
+	"go_backend/uow"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OpenSQLite opens, and creates if needed, the SQLite database at path.
+func OpenSQLite(path string) (Repositories, error) {
+	db, err := openSQL(sqlite.Open(path))
+	if err != nil {
+		return Repositories{}, err
+	}
+	// SQLite allows one writer at a time; sharing one connection queues
+	// writers instead of failing them with "database is locked"
+	sqlDB, err := db.DB()
+	if err != nil {
+		return Repositories{}, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	return NewSQL(db), nil
+}
+
+// OpenPostgres connects to the Postgres database at dsn.
+func OpenPostgres(dsn string) (Repositories, error) {
+	db, err := openSQL(postgres.Open(dsn))
+	if err != nil {
+		return Repositories{}, err
+	}
+	return NewSQL(db), nil
+}
+
+func openSQL(dialector gorm.Dialector) (*gorm.DB, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	err = db.AutoMigrate(
+		&models.User{}, &sqlFood{}, &sqlFoodTag{}, &sqlOrder{}, &sqlOrderItem{},
+		&models.Store{}, &sqlSlot{}, &models.Category{}, &models.UserFavorite{},
+		&models.Ingredient{}, &models.StockAdjustment{}, &models.Review{}, &sqlReviewVote{},
+		&models.PriceChange{}, &models.PriceSchedule{}, &models.Webhook{}, &models.WebhookDelivery{},
+		&models.PasswordReset{}, &sqlOutboxRecord{},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unscoped routes use the default store. Mongo creates it in a
+	// migration; a SQL database gets it the first time it is opened.
+	err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Store{
+		ID:            models.DefaultStoreID,
+		Name:          "Main store",
+		Slug:          "main",
+		DeliveryZones: []models.DeliveryZone{},
+		Staff:         []models.StoreStaff{},
+	}).Error
+	return db, err
+}
+
+// undoCreate deletes row, with its associations, if the unit of work
+// running ctx fails. GORM transactions discard the row themselves, so this
+// only matters under uow.Memory.
+func undoCreate(ctx context.Context, db *gorm.DB, row interface{}) {
+	uow.OnRollback(ctx, func() {
+		if err := db.Unscoped().Select(clause.Associations).Delete(row).Error; err != nil {
+			log.Printf("Failed to undo a create: %v", err)
+		}
+	})
+}
+
+// NewSQL returns the repositories backed by db, whose tables must exist.
+func NewSQL(db *gorm.DB) Repositories {
+	return Repositories{
+		Users:          sqlUsers{db},
+		Foods:          sqlFoods{db},
+		Orders:         sqlOrders{db},
+		Stores:         sqlStores{db},
+		Categories:     sqlCategories{db},
+		Favorites:      sqlFavorites{db},
+		Inventory:      sqlInventory{db},
+		Reviews:        sqlReviews{db},
+		Prices:         sqlPrices{db},
+		Webhooks:       sqlWebhooks{db},
+		PasswordResets: sqlPasswordResets{db},
+		Outbox:         sqlOutbox{db},
+		Transactions:   uow.GORM{DB: db},
+	}
+}
+
+// sqlUniqueFields maps the unique constraints besides the primary keys to
+// the request field a violation is reported against. Postgres names the
+// violated index; SQLite names its table and columns instead.
+var sqlUniqueFields = map[string]string{
+	"idx_users_email": "email",
+	"users.email":     "email",
+	"idx_stores_slug": "slug",
+	"stores.slug":     "slug",
+}
+
+var sqlDuplicate = regexp.MustCompile(`unique constraint "([^"]+)"|UNIQUE constraint failed: (.+)$`)
+
+// sqlError converts GORM's and the drivers' errors into the package's.
+func sqlError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	if err == nil {
+		return nil
+	}
+	if match := sqlDuplicate.FindStringSubmatch(err.Error()); match != nil {
+		return &DuplicateError{Field: sqlUniqueFields[match[1]+match[2]]}
+	}
+	return err
+}
+
+// likePattern matches values containing s, case-insensitively when the
+// column is lowercased too.
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(s))
+	return "%" + s + "%"
+}
+
+// Users are stored with the model's own GORM annotations.
+type sqlUsers struct {
+	db *gorm.DB
+}
+
+func (r sqlUsers) Create(ctx context.Context, user *models.User) error {
+	if err := uow.DB(ctx, r.db).Create(user).Error; err != nil {
+		return sqlError(err)
+	}
+	undoCreate(ctx, r.db, &models.User{ID: user.ID})
+	return nil
+}
+
+func (r sqlUsers) ByID(ctx context.Context, id string) (models.User, error) {
+	var user models.User
+	err := uow.DB(ctx, r.db).Where("id = ?", id).First(&user).Error
+	return user, sqlError(err)
+}
+
+func (r sqlUsers) ByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	err := uow.DB(ctx, r.db).Where("email = ?", email).First(&user).Error
+	return user, sqlError(err)
+}
+
+func (r sqlUsers) Search(ctx context.Context, term string) ([]models.User, error) {
+	db := uow.DB(ctx, r.db)
+	if term != "" {
+		pattern := likePattern(term)
+		db = db.Where(`LOWER(name) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\'`, pattern, pattern)
+	}
+	users := []models.User{}
+	err := db.Order("name").Find(&users).Error
+	return users, err
+}
+
+func (r sqlUsers) Update(ctx context.Context, user *models.User) error {
+	result := uow.DB(ctx, r.db).Model(&models.User{ID: user.ID}).
+		Select("name", "email", "password", "address", "allergens", "locale", "email_verified", "token_version", "is_admin", "is_blocked", "is_super_admin", "updated_at").
+		Updates(user)
+	return affected(result)
+}
+
+func (r sqlUsers) Delete(ctx context.Context, _, id string) error {
+	now := time.Now()
+	result := uow.DB(ctx, r.db).Model(&models.User{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"deleted_at": now, "updated_at": now})
+	return affected(result)
+}
+
+func (r sqlUsers) Restore(ctx context.Context, _, id string) error {
+	result := uow.DB(ctx, r.db).Unscoped().Model(&models.User{}).Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{"deleted_at": nil, "updated_at": time.Now()})
+	return affected(result)
+}
+
+func (r sqlUsers) Deleted(ctx context.Context) ([]models.User, error) {
+	users := []models.User{}
+	err := uow.DB(ctx, r.db).Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&users).Error
+	return users, err
+}
+
+func (r sqlUsers) Purge(ctx context.Context, cutoff time.Time) ([]string, error) {
+	ids := []string{}
+	err := uow.DB(ctx, r.db).Unscoped().Model(&models.User{}).Where("deleted_at < ?", cutoff).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	if err := uow.DB(ctx, r.db).Unscoped().Where("id IN ?", ids).Delete(&models.User{}).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// affected converts the result of a write to a single row, reporting
+// ErrNotFound when it matched none.
+func affected(result *gorm.DB) error {
+	if result.Error != nil {
+		return sqlError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// sqlFood is a food's row. Tags get their own table so foods can be
+// filtered by them; the other lists are stored as JSON.
+type sqlFood struct {
+	ID                  string                     `gorm:"type:varchar(24);primaryKey"`
+	StoreID             string                     `gorm:"type:varchar(24);index;not null"`
+	Name                string                     `gorm:"type:varchar(100);not null"`
+	SKU                 string                     `gorm:"type:varchar(100);index"`
+	Price               float64                    `gorm:"not null"`
+	Tags                []sqlFoodTag               `gorm:"foreignKey:FoodID;constraint:OnDelete:CASCADE"`
+	Stars               float64                    `gorm:"default:0"`
+	ImageUrl            string                     `gorm:"type:varchar(255)"`
+	Origins             []string                   `gorm:"serializer:json"`
+	CookTime            string                     `gorm:"type:varchar(100)"`
+	Variants            []models.FoodVariant       `gorm:"serializer:json"`
+	ModifierGroups      []models.ModifierGroup     `gorm:"serializer:json"`
+	AvailabilityWindows []models.TimeWindow        `gorm:"serializer:json"`
+	Promotion           *models.FoodPromotion      `gorm:"serializer:json"`
+	Categories          []models.CategoryPlacement `gorm:"serializer:json"`
+	Nutrition           *models.Nutrition          `gorm:"serializer:json"`
+	Allergens           []string                   `gorm:"serializer:json"`
+	DietLabels          []string                   `gorm:"serializer:json"`
+	Images              []models.FoodImage         `gorm:"serializer:json"`
+	TrackStock          bool                       `gorm:"default:false"`
+	Stock               int                        `gorm:"default:0"`
+	LowStockThreshold   int                        `gorm:"default:0"`
+	Ingredients         []models.FoodIngredient    `gorm:"serializer:json"`
+	SoldOut             bool                       `gorm:"default:false"`
+	RatingCount         int                        `gorm:"default:0"`
+	RatingSum           int                        `gorm:"default:0"`
+	Version             int                        `gorm:"default:1"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	DeletedAt           gorm.DeletedAt `gorm:"index"`
+}
+
+func (sqlFood) TableName() string { return "foods" }
+
+// sqlFoodTag is one of a food's tags, kept in the food's order.
+type sqlFoodTag struct {
+	FoodID   string `gorm:"type:varchar(24);primaryKey"`
+	Position int    `gorm:"primaryKey;autoIncrement:false"`
+	Tag      string `gorm:"type:varchar(100);index;not null"`
+}
+
+func (sqlFoodTag) TableName() string { return "food_tags" }
+
+func toSQLFood(f models.Food) sqlFood {
+	row := sqlFood{
+		ID:                  f.ID.Hex(),
+		StoreID:             f.StoreID,
+		Name:                f.Name,
+		SKU:                 f.SKU,
+		Price:               f.Price,
+		Stars:               f.Stars,
+		ImageUrl:            f.ImageUrl,
+		Origins:             f.Origins,
+		CookTime:            f.CookTime,
+		Variants:            f.Variants,
+		ModifierGroups:      f.ModifierGroups,
+		AvailabilityWindows: f.AvailabilityWindows,
+		Promotion:           f.Promotion,
+		Categories:          f.Categories,
+		Nutrition:           f.Nutrition,
+		Allergens:           f.Allergens,
+		DietLabels:          f.DietLabels,
+		Images:              f.Images,
+		TrackStock:          f.TrackStock,
+		Stock:               f.Stock,
+		LowStockThreshold:   f.LowStockThreshold,
+		Ingredients:         f.Ingredients,
+		SoldOut:             f.SoldOut,
+		RatingCount:         f.RatingCount,
+		RatingSum:           f.RatingSum,
+		Version:             f.Version,
+		CreatedAt:           f.CreatedAt,
+		UpdatedAt:           f.UpdatedAt,
+		DeletedAt:           f.DeletedAt,
+	}
+	for i, tag := range f.Tags {
+		row.Tags = append(row.Tags, sqlFoodTag{FoodID: row.ID, Position: i, Tag: tag})
+	}
+	return row
+}
+
+func (row sqlFood) food() models.Food {
+	id, _ := primitive.ObjectIDFromHex(row.ID)
+	f := models.Food{
+		ID:                  id,
+		StoreID:             row.StoreID,
+		Name:                row.Name,
+		SKU:                 row.SKU,
+		Price:               row.Price,
+		Tags:                []string{},
+		Stars:               row.Stars,
+		ImageUrl:            row.ImageUrl,
+		Origins:             row.Origins,
+		CookTime:            row.CookTime,
+		Variants:            row.Variants,
+		ModifierGroups:      row.ModifierGroups,
+		AvailabilityWindows: row.AvailabilityWindows,
+		Promotion:           row.Promotion,
+		Categories:          row.Categories,
+		Nutrition:           row.Nutrition,
+		Allergens:           row.Allergens,
+		DietLabels:          row.DietLabels,
+		Images:              row.Images,
+		TrackStock:          row.TrackStock,
+		Stock:               row.Stock,
+		LowStockThreshold:   row.LowStockThreshold,
+		Ingredients:         row.Ingredients,
+		SoldOut:             row.SoldOut,
+		RatingCount:         row.RatingCount,
+		RatingSum:           row.RatingSum,
+		Version:             row.Version,
+		CreatedAt:           row.CreatedAt,
+		UpdatedAt:           row.UpdatedAt,
+		DeletedAt:           row.DeletedAt,
+	}
+	for _, tag := range row.Tags {
+		f.Tags = append(f.Tags, tag.Tag)
+	}
+	return f
+}
+
+type sqlFoods struct {
+	db *gorm.DB
+}
+
+func (r sqlFoods) withTags(ctx context.Context) *gorm.DB {
+	return uow.DB(ctx, r.db).Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	})
+}
+
+func (r sqlFoods) Create(ctx context.Context, food *models.Food) error {
+	if food.ID.IsZero() {
+		food.ID = primitive.NewObjectID()
+	}
+	row := toSQLFood(*food)
+	if err := uow.DB(ctx, r.db).Create(&row).Error; err != nil {
+		return sqlError(err)
+	}
+	undoCreate(ctx, r.db, &row)
+	return nil
+}
+
+func (r sqlFoods) ByID(ctx context.Context, storeID string, id primitive.ObjectID) (models.Food, error) {
+	return r.first(r.withTags(ctx).Where("id = ? AND store_id = ?", id.Hex(), storeID))
+}
+
+// Find narrows the foods down in SQL by the columns it can and leaves the
+// rest of the query to FoodQuery.Matches.
+func (r sqlFoods) Find(ctx context.Context, query models.FoodQuery) ([]models.Food, error) {
+	db := r.withTags(ctx)
+	if query.StoreID != "" {
+		db = db.Where("store_id = ?", query.StoreID)
+	}
+	if query.Search != "" {
+		db = db.Where(`LOWER(name) LIKE ? ESCAPE '\'`, likePattern(query.Search))
+	}
+	if query.Tag != "" {
+		db = db.Where("id IN (?)", uow.DB(ctx, r.db).Model(&sqlFoodTag{}).Select("food_id").Where("tag = ?", query.Tag))
+	}
+	if query.MinPrice != nil {
+		db = db.Where("price >= ?", *query.MinPrice)
+	}
+	if query.MaxPrice != nil {
+		db = db.Where("price <= ?", *query.MaxPrice)
+	}
+	if query.MinStars != nil {
+		db = db.Where("stars >= ?", *query.MinStars)
+	}
+
+	var rows []sqlFood
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	foods := []models.Food{}
+	for _, row := range rows {
+		if food := row.food(); query.Matches(food) {
+			foods = append(foods, food)
+		}
+	}
+	return foods, nil
+}
+
+func (r sqlFoods) Tags(ctx context.Context, storeID string) ([]string, error) {
+	tags := []string{}
+	err := uow.DB(ctx, r.db).Model(&sqlFoodTag{}).
+		Joins("JOIN foods ON foods.id = food_tags.food_id").
+		Where("foods.store_id = ? AND foods.deleted_at IS NULL", storeID).
+		Distinct().Order("tag").Pluck("tag", &tags).Error
+	return tags, err
+}
+
+func (r sqlFoods) ByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.Food, error) {
+	hexes := make([]string, len(ids))
+	for i, id := range ids {
+		hexes[i] = id.Hex()
+	}
+	return r.find(r.withTags(ctx).Where("id IN ?", hexes))
+}
+
+func (r sqlFoods) ByName(ctx context.Context, storeID, name string) (models.Food, error) {
+	return r.first(r.withTags(ctx).Where("store_id = ? AND name = ?", storeID, name))
+}
+
+func (r sqlFoods) BySKU(ctx context.Context, storeID, sku string) (models.Food, error) {
+	return r.first(r.withTags(ctx).Where("store_id = ? AND sku = ?", storeID, sku))
+}
+
+// WithPromotion looks for the schedule among the foods on promotion, since
+// promotions are stored as JSON.
+func (r sqlFoods) WithPromotion(ctx context.Context, scheduleID string) (models.Food, error) {
+	foods, err := r.find(r.withTags(ctx).Where("promotion IS NOT NULL"))
+	if err != nil {
+		return models.Food{}, err
+	}
+	for _, food := range foods {
+		if food.Promotion != nil && food.Promotion.ScheduleID == scheduleID {
+			return food, nil
+		}
+	}
+	return models.Food{}, ErrNotFound
+}
+
+func (r sqlFoods) first(db *gorm.DB) (models.Food, error) {
+	var row sqlFood
+	err := db.First(&row).Error
+	return row.food(), sqlError(err)
+}
+
+func (r sqlFoods) find(db *gorm.DB) ([]models.Food, error) {
+	var rows []sqlFood
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	foods := []models.Food{}
+	for _, row := range rows {
+		foods = append(foods, row.food())
+	}
+	return foods, nil
+}
+
+// Facets counts over the foods Find returns, since tags, origins and
+// prices are counted the same way there.
+func (r sqlFoods) Facets(ctx context.Context, query models.FoodQuery) (models.FoodFacets, error) {
+	foods, err := r.Find(ctx, query)
+	if err != nil {
+		return models.FoodFacets{}, err
+	}
+	return models.ComputeFoodFacets(foods, query), nil
+}
+
+// foodFields maps the JSON names of a food's fields to the sqlFood fields
+// storing them.
+var foodFields = jsonFields(models.Food{}, sqlFood{})
+
+// jsonFields maps the JSON names of a model's fields to the fields of row
+// with the same Go names.
+func jsonFields(model, row interface{}) map[string]string {
+	fields := map[string]string{}
+	modelType, rowType := reflect.TypeOf(model), reflect.TypeOf(row)
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		if _, ok := rowType.FieldByName(field.Name); ok {
+			fields[strings.Split(field.Tag.Get("json"), ",")[0]] = field.Name
+		}
+	}
+	return fields
+}
+
+// Update writes the named columns, and the tags when they are named, in
+// one transaction.
+func (r sqlFoods) Update(ctx context.Context, food *models.Food, fields ...string) error {
+	row := toSQLFood(*food)
+	row.Version = food.Version + 1
+	row.UpdatedAt = time.Now()
+
+	columns := []string{"Version", "UpdatedAt"}
+	tags := false
+	for _, name := range fields {
+		field, ok := foodFields[name]
+		switch {
+		case name == "tags":
+			tags = true
+		case !ok:
+			return fmt.Errorf("food has no field %q", name)
+		default:
+			columns = append(columns, field)
+		}
+	}
+
+	err := uow.DB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&sqlFood{}).Where("id = ? AND version = ?", row.ID, food.Version).Select(columns).Updates(&row)
+		if err := affected(result); err != nil || !tags {
+			return err
+		}
+		if err := tx.Where("food_id = ?", row.ID).Delete(&sqlFoodTag{}).Error; err != nil {
+			return err
+		}
+		if len(row.Tags) == 0 {
+			return nil
+		}
+		return tx.Create(&row.Tags).Error
+	})
+	if err != nil {
+		return err
+	}
+	food.Version = row.Version
+	food.UpdatedAt = row.UpdatedAt
+	return nil
+}
+
+// RemoveCategory rewrites the categories of the foods placed in it, which
+// are found in Go since placements are stored as JSON.
+func (r sqlFoods) RemoveCategory(ctx context.Context, storeID, categoryID string) error {
+	return uow.DB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		var rows []sqlFood
+		if err := tx.Unscoped().Where("store_id = ? AND categories IS NOT NULL", storeID).Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			kept := []models.CategoryPlacement{}
+			for _, placement := range row.Categories {
+				if placement.CategoryID != categoryID {
+					kept = append(kept, placement)
+				}
+			}
+			if len(kept) == len(row.Categories) {
+				continue
+			}
+			row.Categories = kept
+			row.Version++
+			row.UpdatedAt = time.Now()
+			err := tx.Unscoped().Model(&sqlFood{}).Where("id = ?", row.ID).
+				Select("Categories", "Version", "UpdatedAt").Updates(&row).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r sqlFoods) AdjustStock(ctx context.Context, storeID string, id primitive.ObjectID, delta int) (models.Food, error) {
+	err := uow.DB(ctx, r.db).Unscoped().Select("id").Where("id = ? AND store_id = ?", id.Hex(), storeID).First(&sqlFood{}).Error
+	if err != nil {
+		return models.Food{}, sqlError(err)
+	}
+
+	update := uow.DB(ctx, r.db).Unscoped().Model(&sqlFood{}).Where("id = ?", id.Hex())
+	if delta < 0 {
+		update = update.Where("stock >= ?", -delta)
+	}
+	result := update.Updates(map[string]interface{}{"stock": gorm.Expr("stock + ?", delta), "updated_at": time.Now()})
+	if err := affected(result); errors.Is(err, ErrNotFound) {
+		return models.Food{}, ErrInsufficientStock
+	} else if err != nil {
+		return models.Food{}, err
+	}
+	return r.first(r.withTags(ctx).Unscoped().Where("id = ?", id.Hex()))
+}
+
+// Stocked filters the foods using the ingredients in Go, since recipes
+// are stored as JSON.
+func (r sqlFoods) Stocked(ctx context.Context, ids []primitive.ObjectID, ingredientIDs []string) ([]models.Food, error) {
+	hexes := make([]string, len(ids))
+	for i, id := range ids {
+		hexes[i] = id.Hex()
+	}
+	candidates, err := r.find(r.withTags(ctx).Unscoped().Where("id IN ? OR ingredients IS NOT NULL", hexes))
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := map[string]bool{}
+	for _, id := range hexes {
+		wanted[id] = true
+	}
+	uses := map[string]bool{}
+	for _, id := range ingredientIDs {
+		uses[id] = true
+	}
+	foods := []models.Food{}
+	for _, food := range candidates {
+		match := wanted[food.ID.Hex()]
+		for _, ingredient := range food.Ingredients {
+			match = match || uses[ingredient.IngredientID]
+		}
+		if match {
+			foods = append(foods, food)
+		}
+	}
+	return foods, nil
+}
+
+func (r sqlFoods) SetSoldOut(ctx context.Context, id primitive.ObjectID, soldOut bool) error {
+	return uow.DB(ctx, r.db).Unscoped().Model(&sqlFood{}).Where("id = ?", id.Hex()).Update("sold_out", soldOut).Error
+}
+
+func (r sqlFoods) LowStock(ctx context.Context, storeID string) ([]models.Food, error) {
+	return r.find(r.withTags(ctx).Where("store_id = ? AND track_stock = ? AND stock <= low_stock_threshold", storeID, true))
+}
+
+// ApplyRating computes Stars from the totals as they were before the
+// update, plus the deltas.
+func (r sqlFoods) ApplyRating(ctx context.Context, id primitive.ObjectID, sumDelta, countDelta int) error {
+	return uow.DB(ctx, r.db).Unscoped().Model(&sqlFood{}).Where("id = ?", id.Hex()).Updates(map[string]interface{}{
+		"rating_sum":   gorm.Expr("rating_sum + ?", sumDelta),
+		"rating_count": gorm.Expr("rating_count + ?", countDelta),
+		"stars": gorm.Expr("CASE WHEN rating_count + ? > 0 THEN ROUND((rating_sum + ?) * 1.0 / (rating_count + ?), 1) ELSE 0 END",
+			countDelta, sumDelta, countDelta),
+	}).Error
+}
+
+func (r sqlFoods) Delete(ctx context.Context, storeID, id string) error {
+	now := time.Now()
+	result := uow.DB(ctx, r.db).Model(&sqlFood{}).Where("id = ? AND store_id = ?", id, storeID).
+		Updates(map[string]interface{}{"deleted_at": now, "updated_at": now, "version": gorm.Expr("version + 1")})
+	return affected(result)
+}
+
+func (r sqlFoods) Restore(ctx context.Context, storeID, id string) error {
+	result := uow.DB(ctx, r.db).Unscoped().Model(&sqlFood{}).Where("id = ? AND store_id = ? AND deleted_at IS NOT NULL", id, storeID).
+		Updates(map[string]interface{}{"deleted_at": nil, "updated_at": time.Now(), "version": gorm.Expr("version + 1")})
+	return affected(result)
+}
+
+func (r sqlFoods) Deleted(ctx context.Context, storeID string) ([]models.Food, error) {
+	return r.find(r.withTags(ctx).Unscoped().Where("store_id = ? AND deleted_at IS NOT NULL", storeID).Order("deleted_at DESC"))
+}
+
+func (r sqlFoods) Purge(ctx context.Context, cutoff time.Time) ([]models.Food, error) {
+	purged, err := r.find(r.withTags(ctx).Unscoped().Where("deleted_at < ?", cutoff))
+	if err != nil || len(purged) == 0 {
+		return nil, err
+	}
+	ids := make([]string, len(purged))
+	for i, food := range purged {
+		ids[i] = food.ID.Hex()
+	}
+
+	err = uow.DB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("food_id IN ?", ids).Delete(&sqlFoodTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&sqlFood{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+// sqlOrder is an order's row; its items have their own table.
+type sqlOrder struct {
+	ID            string         `gorm:"type:varchar(24);primaryKey"`
+	StoreID       string         `gorm:"type:varchar(24);index;not null"`
+	Name          string         `gorm:"type:varchar(100);not null"`
+	Address       string         `gorm:"type:varchar(255);not null"`
+	AddressLatLng models.LatLng  `gorm:"embedded;embeddedPrefix:address_"`
+	DeliveryFee   float64        `gorm:"default:0"`
+	TotalPrice    float64        `gorm:"not null"`
+	Items         []sqlOrderItem `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE"`
+	Status        string         `gorm:"type:varchar(100);not null;index:idx_orders_user_status,priority:2"`
+	UserID        string         `gorm:"type:varchar(24);not null;index:idx_orders_user_status,priority:1"`
+	PaymentID     string         `gorm:"type:varchar(100);index"`
+	StockReserved bool           `gorm:"default:false"`
+	ScheduledFor  *time.Time     `gorm:"index"`
+	ReleasedAt    *time.Time     `gorm:"index"`
+	CreatedAt     time.Time      `gorm:"index"`
+	UpdatedAt     time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+}
+
+func (sqlOrder) TableName() string { return "orders" }
+
+// sqlOrderItem is one line of an order. Food is the copy of the food the
+// order was priced with, so it is kept whole rather than referenced.
+type sqlOrderItem struct {
+	ID          uint                       `gorm:"primaryKey"`
+	OrderID     string                     `gorm:"type:varchar(24);index;not null"`
+	Position    int                        `gorm:"not null"`
+	FoodID      string                     `gorm:"type:varchar(24);index;not null"`
+	Food        models.Food                `gorm:"serializer:json"`
+	BasePrice   float64                    `gorm:"not null"`
+	PromotionID string                     `gorm:"type:varchar(24)"`
+	VariantID   string                     `gorm:"type:varchar(24)"`
+	VariantName string                     `gorm:"type:varchar(100)"`
+	Modifiers   []models.OrderItemModifier `gorm:"serializer:json"`
+	UnitPrice   float64                    `gorm:"not null"`
+	Price       float64                    `gorm:"not null"`
+	Quantity    int                        `gorm:"not null"`
+}
+
+func (sqlOrderItem) TableName() string { return "order_items" }
+
+func toSQLOrder(o models.Order) sqlOrder {
+	row := sqlOrder{
+		ID:            o.ID,
+		StoreID:       o.StoreID,
+		Name:          o.Name,
+		Address:       o.Address,
+		AddressLatLng: o.AddressLatLng,
+		DeliveryFee:   o.DeliveryFee,
+		TotalPrice:    o.TotalPrice,
+		Status:        o.Status,
+		UserID:        o.UserID,
+		PaymentID:     o.PaymentID,
+		StockReserved: o.StockReserved,
+		ScheduledFor:  o.ScheduledFor,
+		ReleasedAt:    o.ReleasedAt,
+		CreatedAt:     o.CreatedAt,
+		UpdatedAt:     o.UpdatedAt,
+		DeletedAt:     o.DeletedAt,
+	}
+	for i, item := range o.Items {
+		row.Items = append(row.Items, sqlOrderItem{
+			OrderID:     o.ID,
+			Position:    i,
+			FoodID:      item.Food.ID.Hex(),
+			Food:        item.Food,
+			BasePrice:   item.BasePrice,
+			PromotionID: item.PromotionID,
+			VariantID:   item.VariantID,
+			VariantName: item.VariantName,
+			Modifiers:   item.Modifiers,
+			UnitPrice:   item.UnitPrice,
+			Price:       item.Price,
+			Quantity:    item.Quantity,
+		})
+	}
+	return row
+}
+
+func (row sqlOrder) order() models.Order {
+	o := models.Order{
+		ID:            row.ID,
+		StoreID:       row.StoreID,
+		Name:          row.Name,
+		Address:       row.Address,
+		AddressLatLng: row.AddressLatLng,
+		DeliveryFee:   row.DeliveryFee,
+		TotalPrice:    row.TotalPrice,
+		Items:         []models.OrderItem{},
+		Status:        row.Status,
+		UserID:        row.UserID,
+		PaymentID:     row.PaymentID,
+		StockReserved: row.StockReserved,
+		ScheduledFor:  row.ScheduledFor,
+		ReleasedAt:    row.ReleasedAt,
+		CreatedAt:     row.CreatedAt,
+		UpdatedAt:     row.UpdatedAt,
+		DeletedAt:     row.DeletedAt,
+	}
+	for _, item := range row.Items {
+		o.Items = append(o.Items, models.OrderItem{
+			Food:        item.Food,
+			BasePrice:   item.BasePrice,
+			PromotionID: item.PromotionID,
+			VariantID:   item.VariantID,
+			VariantName: item.VariantName,
+			Modifiers:   item.Modifiers,
+			UnitPrice:   item.UnitPrice,
+			Price:       item.Price,
+			Quantity:    item.Quantity,
+		})
+	}
+	return o
+}
+
+type sqlOrders struct {
+	db *gorm.DB
+}
+
+func (r sqlOrders) withItems(ctx context.Context) *gorm.DB {
+	return uow.DB(ctx, r.db).Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	})
+}
+
+func (r sqlOrders) Create(ctx context.Context, order *models.Order) error {
+	row := toSQLOrder(*order)
+	if err := uow.DB(ctx, r.db).Create(&row).Error; err != nil {
+		return sqlError(err)
+	}
+	undoCreate(ctx, r.db, &row)
+	return nil
+}
+
+func (r sqlOrders) ByID(ctx context.Context, id string) (models.Order, error) {
+	var row sqlOrder
+	err := r.withItems(ctx).Where("id = ?", id).First(&row).Error
+	return row.order(), sqlError(err)
+}
+
+func (r sqlOrders) Pending(ctx context.Context, storeID, userID string) (models.Order, error) {
+	var row sqlOrder
+	err := r.withItems(ctx).Where("store_id = ? AND user_id = ? AND status = ?", storeID, userID, "Pending").First(&row).Error
+	return row.order(), sqlError(err)
+}
+
+func (r sqlOrders) List(ctx context.Context, storeID, status string) ([]models.Order, error) {
+	db := r.withItems(ctx).Where("store_id = ?", storeID)
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	return r.find(db.Order("created_at DESC"))
+}
+
+func (r sqlOrders) find(db *gorm.DB) ([]models.Order, error) {
+	var rows []sqlOrder
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	orders := []models.Order{}
+	for _, row := range rows {
+		orders = append(orders, row.order())
+	}
+	return orders, nil
+}
+
+func (r sqlOrders) Kitchen(ctx context.Context, storeID string) ([]models.Order, error) {
+	return r.find(r.withItems(ctx).Where("store_id = ? AND status = ? AND released_at IS NOT NULL", storeID, "Paid").Order("released_at"))
+}
+
+func (r sqlOrders) Statuses(ctx context.Context, storeID string) ([]string, error) {
+	statuses := []string{}
+	err := uow.DB(ctx, r.db).Model(&sqlOrder{}).Where("store_id = ?", storeID).Distinct().Order("status").Pluck("status", &statuses).Error
+	return statuses, err
+}
+
+func (r sqlOrders) Delivered(ctx context.Context, userID string, foodID primitive.ObjectID) (models.Order, error) {
+	var row sqlOrder
+	items := uow.DB(ctx, r.db).Model(&sqlOrderItem{}).Select("order_id").Where("food_id = ?", foodID.Hex())
+	err := r.withItems(ctx).Where("user_id = ? AND status = ? AND id IN (?)", userID, "Delivered", items).First(&row).Error
+	return row.order(), sqlError(err)
+}
+
+func (r sqlOrders) UnreserveStock(ctx context.Context, id string) (models.Order, error) {
+	var row sqlOrder
+	if err := r.withItems(ctx).Unscoped().Where("id = ? AND stock_reserved = ?", id, true).First(&row).Error; err != nil {
+		return models.Order{}, sqlError(err)
+	}
+	result := uow.DB(ctx, r.db).Unscoped().Model(&sqlOrder{}).
+		Where("id = ? AND stock_reserved = ?", id, true).Update("stock_reserved", false)
+	if err := affected(result); err != nil {
+		return models.Order{}, err
+	}
+	row.StockReserved = false
+	return row.order(), nil
+}
+
+func (r sqlOrders) ReleaseDue(ctx context.Context, before, now time.Time) (int, error) {
+	result := uow.DB(ctx, r.db).Model(&sqlOrder{}).
+		Where("scheduled_for IS NOT NULL AND scheduled_for <= ? AND released_at IS NULL", before).
+		Where("status NOT IN ?", []string{"Cancelled", "PaymentFailed"}).
+		Updates(map[string]interface{}{"released_at": now, "updated_at": now})
+	return int(result.RowsAffected), result.Error
+}
+
+func (r sqlOrders) Delete(ctx context.Context, storeID, id string) error {
+	now := time.Now()
+	result := uow.DB(ctx, r.db).Model(&sqlOrder{}).Where("id = ? AND store_id = ?", id, storeID).
+		Updates(map[string]interface{}{"deleted_at": now, "updated_at": now})
+	return affected(result)
+}
+
+func (r sqlOrders) Restore(ctx context.Context, storeID, id string) error {
+	result := uow.DB(ctx, r.db).Unscoped().Model(&sqlOrder{}).Where("id = ? AND store_id = ? AND deleted_at IS NOT NULL", id, storeID).
+		Updates(map[string]interface{}{"deleted_at": nil, "updated_at": time.Now()})
+	return affected(result)
+}
+
+func (r sqlOrders) Deleted(ctx context.Context, storeID string) ([]models.Order, error) {
+	return r.find(r.withItems(ctx).Unscoped().Where("store_id = ? AND deleted_at IS NOT NULL", storeID).Order("deleted_at DESC"))
+}
+
+func (r sqlOrders) Purge(ctx context.Context, cutoff time.Time) (int, error) {
+	var purged int64
+	err := uow.DB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		ids := tx.Unscoped().Model(&sqlOrder{}).Select("id").Where("deleted_at < ?", cutoff)
+		if err := tx.Where("order_id IN (?)", ids).Delete(&sqlOrderItem{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("deleted_at < ?", cutoff).Delete(&sqlOrder{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return int(purged), err
+}
+
+func (r sqlOrders) Pay(ctx context.Context, paymentID string) (models.Order, error) {
+	return r.updateStatus(ctx, "Paid", "payment_id = ? AND status = ?", paymentID, "Pending")
+}
+
+func (r sqlOrders) Transition(ctx context.Context, storeID, id, from, to string) (models.Order, error) {
+	return r.updateStatus(ctx, to, "id = ? AND store_id = ? AND status = ?", id, storeID, from)
+}
+
+// updateStatus sets the status of the first order matching the condition
+// and returns the order as it was before. The update repeats the status
+// check so a concurrent change makes it fail rather than be overwritten.
+func (r sqlOrders) updateStatus(ctx context.Context, status string, condition string, args ...interface{}) (models.Order, error) {
+	var row sqlOrder
+	if err := r.withItems(ctx).Where(condition, args...).First(&row).Error; err != nil {
+		return models.Order{}, sqlError(err)
+	}
+	result := uow.DB(ctx, r.db).Model(&sqlOrder{}).
+		Where("id = ? AND status = ?", row.ID, row.Status).
+		Updates(map[string]interface{}{"status": status, "updated_at": time.Now()})
+	if result.Error != nil {
+		return models.Order{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Order{}, ErrNotFound
+	}
+	return row.order(), nil
+}
+
+// sqlOutboxRecord is an outbox row.
+type sqlOutboxRecord struct {
+	ID            string     `gorm:"type:varchar(24);primaryKey"`
+	Type          string     `gorm:"type:varchar(100);not null"`
+	AggregateID   string     `gorm:"type:varchar(24);not null"`
+	StoreID       string     `gorm:"type:varchar(24)"`
+	Data          []byte     `gorm:"not null"`
+	OccurredAt    time.Time  `gorm:"index;not null"`
+	Attempts      int        `gorm:"default:0"`
+	NextAttemptAt time.Time  `gorm:"index;not null"`
+	DispatchedAt  *time.Time `gorm:"index"`
+	LastError     string
+	Delivered     []string `gorm:"serializer:json"`
+	DeadAt        *time.Time
+}
+
+func (sqlOutboxRecord) TableName() string { return "outbox" }
+
+func (row sqlOutboxRecord) record() events.Record {
+	return events.Record{
+		Event: events.Event{
+			ID:          row.ID,
+			Type:        row.Type,
+			AggregateID: row.AggregateID,
+			StoreID:     row.StoreID,
+			Data:        row.Data,
+			OccurredAt:  row.OccurredAt,
+		},
+		Attempts:      row.Attempts,
+		NextAttemptAt: row.NextAttemptAt,
+		DispatchedAt:  row.DispatchedAt,
+		LastError:     row.LastError,
+		Delivered:     row.Delivered,
+		DeadAt:        row.DeadAt,
+	}
+}
+
+type sqlOutbox struct {
+	db *gorm.DB
+}
+
+func (r sqlOutbox) Add(ctx context.Context, event events.Event) error {
+	record := events.NewRecord(event)
+	row := sqlOutboxRecord{
+		ID:            event.ID,
+		Type:          event.Type,
+		AggregateID:   event.AggregateID,
+		StoreID:       event.StoreID,
+		Data:          event.Data,
+		OccurredAt:    event.OccurredAt,
+		NextAttemptAt: record.NextAttemptAt,
+	}
+	if err := uow.DB(ctx, r.db).Create(&row).Error; err != nil {
+		return err
+	}
+	undoCreate(ctx, r.db, &row)
+	return nil
+}
+
+func (r sqlOutbox) Claim(ctx context.Context, now, until time.Time, limit int) ([]events.Record, error) {
+	var rows []sqlOutboxRecord
+	err := uow.DB(ctx, r.db).
+		Where("dispatched_at IS NULL AND dead_at IS NULL AND next_attempt_at <= ?", now).
+		Order("occurred_at").Limit(limit).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Another dispatcher may have claimed a candidate in the meantime
+	claimed := []events.Record{}
+	for _, row := range rows {
+		result := uow.DB(ctx, r.db).Model(&sqlOutboxRecord{}).
+			Where("id = ? AND dispatched_at IS NULL AND next_attempt_at = ?", row.ID, row.NextAttemptAt).
+			Update("next_attempt_at", until)
+		if result.Error != nil {
+			return claimed, result.Error
+		}
+		if result.RowsAffected == 1 {
+			claimed = append(claimed, row.record())
+		}
+	}
+	return claimed, nil
+}
+
+func (r sqlOutbox) MarkDispatched(ctx context.Context, id string, at time.Time) error {
+	return uow.DB(ctx, r.db).Model(&sqlOutboxRecord{}).Where("id = ?", id).Update("dispatched_at", at).Error
+}
+
+func (r sqlOutbox) MarkFailed(ctx context.Context, record events.Record) error {
+	row := sqlOutboxRecord{
+		Attempts:      record.Attempts,
+		NextAttemptAt: record.NextAttemptAt,
+		LastError:     record.LastError,
+		Delivered:     record.Delivered,
+		DeadAt:        record.DeadAt,
+	}
+	return uow.DB(ctx, r.db).Model(&sqlOutboxRecord{}).Where("id = ?", record.ID).
+		Select("Attempts", "NextAttemptAt", "LastError", "Delivered", "DeadAt").Updates(&row).Error
+}
+
+func (r sqlOutbox) Prune(ctx context.Context, before time.Time) (int, error) {
+	result := uow.DB(ctx, r.db).Where("dispatched_at < ?", before).Delete(&sqlOutboxRecord{})
+	return int(result.RowsAffected), result.Error
+}
+
+// Stores are stored with the model's own GORM annotations, which keep the
+// schedule, zones and staff as JSON.
+type sqlStores struct {
+	db *gorm.DB
+}
+
+// storeFields maps the JSON names of a store's fields to their Go names.
+var storeFields = jsonFields(models.Store{}, models.Store{})
+
+func (r sqlStores) List(ctx context.Context) ([]models.Store, error) {
+	stores := []models.Store{}
+	err := uow.DB(ctx, r.db).Order("name").Find(&stores).Error
+	return stores, err
+}
+
+func (r sqlStores) ByID(ctx context.Context, id string) (models.Store, error) {
+	var store models.Store
+	err := uow.DB(ctx, r.db).Where("id = ?", id).First(&store).Error
+	return store, sqlError(err)
+}
+
+func (r sqlStores) Create(ctx context.Context, store *models.Store) error {
+	return sqlError(uow.DB(ctx, r.db).Create(store).Error)
+}
+
+func (r sqlStores) Update(ctx context.Context, store *models.Store, fields ...string) error {
+	store.UpdatedAt = time.Now()
+	columns := []string{"UpdatedAt"}
+	for _, name := range fields {
+		field, ok := storeFields[name]
+		if !ok {
+			return fmt.Errorf("store has no field %q", name)
+		}
+		columns = append(columns, field)
+	}
+	return affected(uow.DB(ctx, r.db).Model(&models.Store{}).Where("id = ?", store.ID).Select(columns).Updates(store))
+}
+
+// sqlSlot counts the orders that have taken an order slot.
+type sqlSlot struct {
+	ID    string `gorm:"type:varchar(64);primaryKey"`
+	Count int    `gorm:"not null"`
+}
+
+func (sqlSlot) TableName() string { return "order_slots" }
+
+func (r sqlStores) SlotCount(ctx context.Context, storeID string, slot time.Time) (int, error) {
+	var row sqlSlot
+	err := uow.DB(ctx, r.db).Where("id = ?", slotKey(storeID, slot)).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return row.Count, err
+}
+
+func (r sqlStores) TakeSlot(ctx context.Context, storeID string, slot time.Time) (int, error) {
+	key := slotKey(storeID, slot)
+	err := uow.DB(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("order_slots.count + 1")}),
+	}).Create(&sqlSlot{ID: key, Count: 1}).Error
+	if err != nil {
+		return 0, err
+	}
+	var row sqlSlot
+	err = uow.DB(ctx, r.db).Where("id = ?", key).First(&row).Error
+	return row.Count, err
+}
+
+func (r sqlStores) ReleaseSlot(ctx context.Context, storeID string, slot time.Time) error {
+	return uow.DB(ctx, r.db).Model(&sqlSlot{}).Where("id = ? AND count > 0", slotKey(storeID, slot)).
+		Update("count", gorm.Expr("count - 1")).Error
+}
+
+type sqlCategories struct {
+	db *gorm.DB
+}
+
+func (r sqlCategories) List(ctx context.Context, storeID string) ([]models.Category, error) {
+	categories := []models.Category{}
+	err := uow.DB(ctx, r.db).Where("store_id = ?", storeID).Find(&categories).Error
+	return categories, err
+}
+
+func (r sqlCategories) ByID(ctx context.Context, storeID, id string) (models.Category, error) {
+	var category models.Category
+	err := uow.DB(ctx, r.db).Where("id = ? AND store_id = ?", id, storeID).First(&category).Error
+	return category, sqlError(err)
+}
+
+func (r sqlCategories) Create(ctx context.Context, category *models.Category) error {
+	return sqlError(uow.DB(ctx, r.db).Create(category).Error)
+}
+
+func (r sqlCategories) Update(ctx context.Context, category *models.Category) error {
+	return affected(uow.DB(ctx, r.db).Model(&models.Category{}).Where("id = ? AND store_id = ?", category.ID, category.StoreID).
+		Select("*").Updates(category))
+}
+
+func (r sqlCategories) HasChildren(ctx context.Context, storeID, id string) (bool, error) {
+	var children int64
+	err := uow.DB(ctx, r.db).Model(&models.Category{}).Where("store_id = ? AND parent_id = ?", storeID, id).Count(&children).Error
+	return children > 0, err
+}
+
+func (r sqlCategories) Delete(ctx context.Context, storeID, id string) error {
+	return affected(uow.DB(ctx, r.db).Where("id = ? AND store_id = ?", id, storeID).Delete(&models.Category{}))
+}
+
+type sqlFavorites struct {
+	db *gorm.DB
+}
+
+func (r sqlFavorites) FoodIDs(ctx context.Context, userID string) ([]string, error) {
+	ids := []string{}
+	err := uow.DB(ctx, r.db).Model(&models.UserFavorite{}).Where("user_id = ?", userID).Pluck("food_id", &ids).Error
+	return ids, err
+}
+
+// Add relies on the unique index on user and food to ignore favorites the
+// user already has.
+func (r sqlFavorites) Add(ctx context.Context, favorite *models.UserFavorite) error {
+	return sqlError(uow.DB(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).Create(favorite).Error)
+}
+
+func (r sqlFavorites) Remove(ctx context.Context, userID, foodID string) error {
+	return uow.DB(ctx, r.db).Where("user_id = ? AND food_id = ?", userID, foodID).Delete(&models.UserFavorite{}).Error
+}
+
+func (r sqlFavorites) RemoveFoods(ctx context.Context, foodIDs []string) error {
+	if len(foodIDs) == 0 {
+		return nil
+	}
+	return uow.DB(ctx, r.db).Where("food_id IN ?", foodIDs).Delete(&models.UserFavorite{}).Error
+}
+
+func (r sqlFavorites) RemoveUsers(ctx context.Context, userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	return uow.DB(ctx, r.db).Where("user_id IN ?", userIDs).Delete(&models.UserFavorite{}).Error
+}
+
+type sqlInventory struct {
+	db *gorm.DB
+}
+
+func (r sqlInventory) Ingredients(ctx context.Context, storeID string) ([]models.Ingredient, error) {
+	ingredients := []models.Ingredient{}
+	err := uow.DB(ctx, r.db).Where("store_id = ?", storeID).Order("name").Find(&ingredients).Error
+	return ingredients, err
+}
+
+func (r sqlInventory) IngredientsByID(ctx context.Context, ids []string) ([]models.Ingredient, error) {
+	ingredients := []models.Ingredient{}
+	if len(ids) == 0 {
+		return ingredients, nil
+	}
+	err := uow.DB(ctx, r.db).Where("id IN ?", ids).Find(&ingredients).Error
+	return ingredients, err
+}
+
+func (r sqlInventory) LowStockIngredients(ctx context.Context, storeID string) ([]models.Ingredient, error) {
+	ingredients := []models.Ingredient{}
+	err := uow.DB(ctx, r.db).Where("store_id = ? AND stock <= low_stock_threshold", storeID).Find(&ingredients).Error
+	return ingredients, err
+}
+
+func (r sqlInventory) CreateIngredient(ctx context.Context, ingredient *models.Ingredient) error {
+	return sqlError(uow.DB(ctx, r.db).Create(ingredient).Error)
+}
+
+func (r sqlInventory) AdjustIngredient(ctx context.Context, storeID, id string, delta float64) (models.Ingredient, error) {
+	var ingredient models.Ingredient
+	err := uow.DB(ctx, r.db).Select("id").Where("id = ? AND store_id = ?", id, storeID).First(&ingredient).Error
+	if err != nil {
+		return ingredient, sqlError(err)
+	}
+
+	update := uow.DB(ctx, r.db).Model(&models.Ingredient{}).Where("id = ?", id)
+	if delta < 0 {
+		update = update.Where("stock >= ?", -delta)
+	}
+	result := update.Updates(map[string]interface{}{"stock": gorm.Expr("stock + ?", delta), "updated_at": time.Now()})
+	if err := affected(result); errors.Is(err, ErrNotFound) {
+		return ingredient, ErrInsufficientStock
+	} else if err != nil {
+		return ingredient, err
+	}
+	err = uow.DB(ctx, r.db).Where("id = ?", id).First(&ingredient).Error
+	return ingredient, sqlError(err)
+}
+
+func (r sqlInventory) AddAdjustment(ctx context.Context, adjustment *models.StockAdjustment) error {
+	if err := uow.DB(ctx, r.db).Create(adjustment).Error; err != nil {
+		return sqlError(err)
+	}
+	undoCreate(ctx, r.db, &models.StockAdjustment{ID: adjustment.ID})
+	return nil
+}
+
+func (r sqlInventory) Adjustments(ctx context.Context, storeID, targetID string, limit int) ([]models.StockAdjustment, error) {
+	query := uow.DB(ctx, r.db).Where("store_id = ?", storeID)
+	if targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+	adjustments := []models.StockAdjustment{}
+	err := query.Order("created_at DESC").Limit(limit).Find(&adjustments).Error
+	return adjustments, err
+}
+
+// Reviews are stored with the model's own GORM annotations. Who voted a
+// review helpful is kept in review_votes instead of HelpfulBy.
+type sqlReviews struct {
+	db *gorm.DB
+}
+
+// sqlReviewVote is one user's helpful vote for a review.
+type sqlReviewVote struct {
+	ReviewID string `gorm:"type:varchar(24);primaryKey"`
+	UserID   string `gorm:"type:varchar(24);primaryKey"`
+}
+
+func (sqlReviewVote) TableName() string { return "review_votes" }
+
+func (r sqlReviews) Approved(ctx context.Context, foodID string) ([]models.Review, error) {
+	reviews := []models.Review{}
+	err := uow.DB(ctx, r.db).Where("food_id = ? AND status = ?", foodID, models.ReviewApproved).
+		Order("helpful_votes DESC").Order("created_at DESC").Find(&reviews).Error
+	return reviews, err
+}
+
+func (r sqlReviews) Pending(ctx context.Context, storeID string) ([]models.Review, error) {
+	reviews := []models.Review{}
+	err := uow.DB(ctx, r.db).Where("store_id = ? AND status = ?", storeID, models.ReviewPending).Order("created_at").Find(&reviews).Error
+	return reviews, err
+}
+
+func (r sqlReviews) ByID(ctx context.Context, storeID, id string) (models.Review, error) {
+	var review models.Review
+	err := uow.DB(ctx, r.db).Where("id = ? AND store_id = ?", id, storeID).First(&review).Error
+	return review, sqlError(err)
+}
+
+func (r sqlReviews) ByUser(ctx context.Context, foodID, userID string) (models.Review, error) {
+	var review models.Review
+	err := uow.DB(ctx, r.db).Where("food_id = ? AND user_id = ?", foodID, userID).First(&review).Error
+	return review, sqlError(err)
+}
+
+func (r sqlReviews) Create(ctx context.Context, review *models.Review) error {
+	return sqlError(uow.DB(ctx, r.db).Create(review).Error)
+}
+
+func (r sqlReviews) Moderate(ctx context.Context, id, from, to, moderatedBy string) error {
+	result := uow.DB(ctx, r.db).Model(&models.Review{}).Where("id = ? AND status = ?", id, from).
+		Updates(map[string]interface{}{"status": to, "moderated_by": moderatedBy, "updated_at": time.Now()})
+	return affected(result)
+}
+
+// VoteHelpful only counts the vote when it is the user's first for the
+// review.
+func (r sqlReviews) VoteHelpful(ctx context.Context, id, userID string) error {
+	return uow.DB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		var review models.Review
+		if err := tx.Select("id").Where("id = ? AND status = ?", id, models.ReviewApproved).First(&review).Error; err != nil {
+			return sqlError(err)
+		}
+		vote := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&sqlReviewVote{ReviewID: id, UserID: userID})
+		if vote.Error != nil || vote.RowsAffected == 0 {
+			return vote.Error
+		}
+		return tx.Model(&models.Review{}).Where("id = ?", id).Update("helpful_votes", gorm.Expr("helpful_votes + 1")).Error
+	})
+}
+
+type sqlPrices struct {
+	db *gorm.DB
+}
+
+func (r sqlPrices) Record(ctx context.Context, change *models.PriceChange) error {
+	if err := uow.DB(ctx, r.db).Create(change).Error; err != nil {
+		return sqlError(err)
+	}
+	undoCreate(ctx, r.db, &models.PriceChange{ID: change.ID})
+	return nil
+}
+
+func (r sqlPrices) History(ctx context.Context, foodID string) ([]models.PriceChange, error) {
+	history := []models.PriceChange{}
+	err := uow.DB(ctx, r.db).Where("food_id = ?", foodID).Order("created_at DESC").Find(&history).Error
+	return history, err
+}
+
+func (r sqlPrices) Schedules(ctx context.Context, foodID string) ([]models.PriceSchedule, error) {
+	return r.find(uow.DB(ctx, r.db).Where("food_id = ?", foodID))
+}
+
+func (r sqlPrices) find(db *gorm.DB) ([]models.PriceSchedule, error) {
+	schedules := []models.PriceSchedule{}
+	err := db.Order("starts_at").Find(&schedules).Error
+	return schedules, err
+}
+
+func (r sqlPrices) Schedule(ctx context.Context, foodID, id string) (models.PriceSchedule, error) {
+	var schedule models.PriceSchedule
+	err := uow.DB(ctx, r.db).Where("id = ? AND food_id = ?", id, foodID).First(&schedule).Error
+	return schedule, sqlError(err)
+}
+
+func (r sqlPrices) CreateSchedule(ctx context.Context, schedule *models.PriceSchedule) error {
+	return sqlError(uow.DB(ctx, r.db).Create(schedule).Error)
+}
+
+func (r sqlPrices) UpdateSchedule(ctx context.Context, schedule *models.PriceSchedule, from string) error {
+	schedule.UpdatedAt = time.Now()
+	result := uow.DB(ctx, r.db).Model(&models.PriceSchedule{}).Where("id = ? AND status = ?", schedule.ID, from).
+		Updates(map[string]interface{}{"status": schedule.Status, "ends_at": schedule.EndsAt, "updated_at": schedule.UpdatedAt})
+	return affected(result)
+}
+
+func (r sqlPrices) Due(ctx context.Context, now time.Time) ([]models.PriceSchedule, error) {
+	return r.find(uow.DB(ctx, r.db).Where("status = ? AND starts_at <= ?", models.PriceScheduled, now))
+}
+
+func (r sqlPrices) Ended(ctx context.Context, now time.Time) ([]models.PriceSchedule, error) {
+	return r.find(uow.DB(ctx, r.db).Where("status = ? AND ends_at <= ?", models.PriceActive, now))
+}
+
+// Webhooks are stored with the model's own GORM annotations, which keep
+// the event types as JSON.
+type sqlWebhooks struct {
+	db *gorm.DB
+}
+
+func (r sqlWebhooks) List(ctx context.Context, storeID string) ([]models.Webhook, error) {
+	hooks := []models.Webhook{}
+	err := uow.DB(ctx, r.db).Where("store_id = ?", storeID).Order("created_at").Find(&hooks).Error
+	return hooks, err
+}
+
+func (r sqlWebhooks) ByID(ctx context.Context, storeID, id string) (models.Webhook, error) {
+	var hook models.Webhook
+	err := uow.DB(ctx, r.db).Where("id = ? AND store_id = ?", id, storeID).First(&hook).Error
+	return hook, sqlError(err)
+}
+
+// Subscribed filters the event types in Go, since they are stored as JSON.
+func (r sqlWebhooks) Subscribed(ctx context.Context, storeID, eventType string) ([]models.Webhook, error) {
+	var active []models.Webhook
+	if err := uow.DB(ctx, r.db).Where("store_id = ? AND active = ?", storeID, true).Find(&active).Error; err != nil {
+		return nil, err
+	}
+	hooks := []models.Webhook{}
+	for _, hook := range active {
+		subscribed := len(hook.EventTypes) == 0
+		for _, t := range hook.EventTypes {
+			subscribed = subscribed || t == eventType
+		}
+		if subscribed {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks, nil
+}
+
+func (r sqlWebhooks) Create(ctx context.Context, hook *models.Webhook) error {
+	return sqlError(uow.DB(ctx, r.db).Create(hook).Error)
+}
+
+func (r sqlWebhooks) Update(ctx context.Context, hook *models.Webhook) error {
+	hook.UpdatedAt = time.Now()
+	return affected(uow.DB(ctx, r.db).Model(&models.Webhook{}).Where("id = ? AND store_id = ?", hook.ID, hook.StoreID).
+		Select("URL", "EventTypes", "Active", "UpdatedAt").Updates(hook))
+}
+
+func (r sqlWebhooks) Delete(ctx context.Context, storeID, id string) error {
+	return affected(uow.DB(ctx, r.db).Where("id = ? AND store_id = ?", id, storeID).Delete(&models.Webhook{}))
+}
+
+func (r sqlWebhooks) AddDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return sqlError(uow.DB(ctx, r.db).Create(delivery).Error)
+}
+
+func (r sqlWebhooks) Deliveries(ctx context.Context, storeID, webhookID, status string, limit int) ([]models.WebhookDelivery, error) {
+	query := uow.DB(ctx, r.db).Where("webhook_id = ? AND store_id = ?", webhookID, storeID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	deliveries := []models.WebhookDelivery{}
+	err := query.Order("created_at DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (r sqlWebhooks) Redeliver(ctx context.Context, storeID, id string, now time.Time) error {
+	result := uow.DB(ctx, r.db).Model(&models.WebhookDelivery{}).Where("id = ? AND store_id = ?", id, storeID).
+		Updates(map[string]interface{}{
+			"status":          models.DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": now,
+			"updated_at":      now,
+		})
+	return affected(result)
+}
+
+func (r sqlWebhooks) Due(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{}
+	err := uow.DB(ctx, r.db).Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, now).
+		Order("next_attempt_at").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (r sqlWebhooks) Claim(ctx context.Context, delivery models.WebhookDelivery, until time.Time) (bool, error) {
+	result := uow.DB(ctx, r.db).Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, models.DeliveryPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", until)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r sqlWebhooks) RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	columns := []string{"Status", "Attempts", "NextAttemptAt", "LastAttemptAt", "LastStatusCode", "LastError", "UpdatedAt"}
+	return affected(uow.DB(ctx, r.db).Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Select(columns).Updates(delivery))
+}
+
+type sqlPasswordResets struct {
+	db *gorm.DB
+}
+
+func (r sqlPasswordResets) Create(ctx context.Context, reset *models.PasswordReset) error {
+	return sqlError(uow.DB(ctx, r.db).Create(reset).Error)
+}
+
+// Claim repeats the checks in its update so two requests with the same
+// token can't both use it.
+func (r sqlPasswordResets) Claim(ctx context.Context, tokenHash string, now time.Time) (models.PasswordReset, error) {
+	var reset models.PasswordReset
+	err := uow.DB(ctx, r.db).Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).First(&reset).Error
+	if err != nil {
+		return reset, sqlError(err)
+	}
+	result := uow.DB(ctx, r.db).Model(&models.PasswordReset{}).Where("id = ? AND used_at IS NULL", reset.ID).Update("used_at", now)
+	if err := affected(result); err != nil {
+		return models.PasswordReset{}, err
+	}
+	reset.UsedAt = &now
+	return reset, nil
+}
+
+func (r sqlPasswordResets) Discard(ctx context.Context, userID string, now time.Time) error {
+	return uow.DB(ctx, r.db).Model(&models.PasswordReset{}).Where("user_id = ? AND used_at IS NULL", userID).Update("used_at", now).Error
+}
@@ -0,0 +1,738 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go_backend/events"
+	"go_backend/models"
+	"go_backend/uow"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testTime = time.Date(2024, 3, 1, 18, 30, 0, 0, time.UTC)
+
+func openTestSQLite(t *testing.T) Repositories {
+	t.Helper()
+	repos, err := OpenSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	return repos
+}
+
+func testUser(id, email string) models.User {
+	return models.User{
+		ID:        id,
+		Name:      "Ada",
+		Email:     email,
+		Password:  "$2a$10$hash",
+		Address:   "1 Main St",
+		CreatedAt: testTime,
+		UpdatedAt: testTime,
+	}
+}
+
+func testFood(name string, price float64, tags ...string) models.Food {
+	return models.Food{
+		ID:                primitive.NewObjectID(),
+		StoreID:           models.DefaultStoreID,
+		Name:              name,
+		Price:             price,
+		Tags:              tags,
+		ImageUrl:          "/images/" + name + ".jpg",
+		Origins:           []string{"italy"},
+		CookTime:          "20-30",
+		TrackStock:        true,
+		Stock:             3,
+		LowStockThreshold: 2,
+		Version:           1,
+		CreatedAt:         testTime,
+		UpdatedAt:         testTime,
+	}
+}
+
+func testOrder(food models.Food, status string) models.Order {
+	return models.Order{
+		ID:         primitive.NewObjectID().Hex(),
+		StoreID:    models.DefaultStoreID,
+		Name:       "Ada",
+		Address:    "1 Main St",
+		TotalPrice: food.Price,
+		Items:      []models.OrderItem{{Food: food, UnitPrice: food.Price, Price: food.Price, Quantity: 1}},
+		Status:     status,
+		UserID:     "user",
+		PaymentID:  primitive.NewObjectID().Hex(),
+		CreatedAt:  testTime,
+		UpdatedAt:  testTime,
+	}
+}
+
+func TestSQLUsersDuplicateEmail(t *testing.T) {
+	ctx := context.Background()
+	users := openTestSQLite(t).Users
+
+	first := testUser("first", "ada@example.com")
+	if err := users.Create(ctx, &first); err != nil {
+		t.Fatal(err)
+	}
+
+	second := testUser("second", "ada@example.com")
+	var duplicate *DuplicateError
+	if err := users.Create(ctx, &second); !errors.As(err, &duplicate) || duplicate.Field != "email" {
+		t.Fatalf("Create with a taken email = %v, want a duplicate email", err)
+	}
+
+	// The primary key isn't reported against a request field
+	again := testUser("first", "other@example.com")
+	if err := users.Create(ctx, &again); !errors.As(err, &duplicate) || duplicate.Field != "" {
+		t.Fatalf("Create with a taken ID = %v, want a duplicate without a field", err)
+	}
+}
+
+func TestSQLUsersTrash(t *testing.T) {
+	ctx := context.Background()
+	users := openTestSQLite(t).Users
+
+	old := testUser("old", "ada@example.com")
+	if err := users.Create(ctx, &old); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Delete(ctx, "", "old"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := users.Delete(ctx, "", "old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete = %v, want ErrNotFound", err)
+	}
+	if _, err := users.ByID(ctx, "old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ByID of a deleted user = %v, want ErrNotFound", err)
+	}
+
+	// A trashed user's email can be registered again, and then the trashed
+	// user can't be restored
+	replacement := testUser("new", "ada@example.com")
+	if err := users.Create(ctx, &replacement); err != nil {
+		t.Fatalf("Create with a trashed user's email: %v", err)
+	}
+	var duplicate *DuplicateError
+	if err := users.Restore(ctx, "", "old"); !errors.As(err, &duplicate) || duplicate.Field != "email" {
+		t.Fatalf("Restore over a taken email = %v, want a duplicate email", err)
+	}
+
+	deleted, err := users.Deleted(ctx)
+	if err != nil || len(deleted) != 1 || deleted[0].ID != "old" {
+		t.Fatalf("Deleted = %v, %v, want the old user", deleted, err)
+	}
+
+	ids, err := users.Purge(ctx, time.Now().Add(time.Minute))
+	if err != nil || !reflect.DeepEqual(ids, []string{"old"}) {
+		t.Fatalf("Purge = %v, %v, want [old]", ids, err)
+	}
+	if err := users.Restore(ctx, "", "old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Restore after Purge = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSQLFoodsUpdate(t *testing.T) {
+	ctx := context.Background()
+	foods := openTestSQLite(t).Foods
+
+	food := testFood("pizza", 9.5, "italian", "cheese")
+	if err := foods.Create(ctx, &food); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := food
+	food.Price = 11
+	food.Name = "not saved"
+	food.Tags = []string{"spicy"}
+	if err := foods.Update(ctx, &food, "price", "tags"); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if food.Version != 2 {
+		t.Errorf("Version after Update = %d, want 2", food.Version)
+	}
+
+	saved, err := foods.ByID(ctx, food.StoreID, food.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Price != 11 || saved.Name != "pizza" || !reflect.DeepEqual(saved.Tags, []string{"spicy"}) || saved.Version != 2 {
+		t.Errorf("saved food = %+v, want only the price and tags changed", saved)
+	}
+
+	stale.Price = 1
+	if err := foods.Update(ctx, &stale, "price"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update of a stale copy = %v, want ErrNotFound", err)
+	}
+	if err := foods.Update(ctx, &saved, "nope"); err == nil {
+		t.Error("Update of an unknown field succeeded")
+	}
+}
+
+func TestSQLFoodsAdjustStock(t *testing.T) {
+	ctx := context.Background()
+	foods := openTestSQLite(t).Foods
+
+	food := testFood("pizza", 9.5)
+	if err := foods.Create(ctx, &food); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := foods.AdjustStock(ctx, food.StoreID, food.ID, -3)
+	if err != nil || changed.Stock != 0 {
+		t.Fatalf("AdjustStock(-3) = %d, %v, want 0", changed.Stock, err)
+	}
+	if _, err := foods.AdjustStock(ctx, food.StoreID, food.ID, -1); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("AdjustStock below zero = %v, want ErrInsufficientStock", err)
+	}
+	if _, err := foods.AdjustStock(ctx, "other-store", food.ID, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AdjustStock in another store = %v, want ErrNotFound", err)
+	}
+
+	low, err := foods.LowStock(ctx, food.StoreID)
+	if err != nil || len(low) != 1 {
+		t.Errorf("LowStock = %v, %v, want the pizza", low, err)
+	}
+}
+
+func TestSQLFoodsApplyRating(t *testing.T) {
+	ctx := context.Background()
+	foods := openTestSQLite(t).Foods
+
+	food := testFood("pizza", 9.5)
+	if err := foods.Create(ctx, &food); err != nil {
+		t.Fatal(err)
+	}
+	for _, rating := range []int{5, 4, 4} {
+		if err := foods.ApplyRating(ctx, food.ID, rating, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := foods.ApplyRating(ctx, food.ID, -4, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := foods.ByID(ctx, food.StoreID, food.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.RatingSum != 9 || saved.RatingCount != 2 || saved.Stars != 4.5 {
+		t.Errorf("rating = %d/%d, %v stars, want 9/2, 4.5 stars", saved.RatingSum, saved.RatingCount, saved.Stars)
+	}
+}
+
+func TestSQLFoodsFacetsMatchFind(t *testing.T) {
+	ctx := context.Background()
+	foods := openTestSQLite(t).Foods
+
+	for _, food := range []models.Food{
+		testFood("pizza", 9.5, "italian", "cheese"),
+		testFood("pasta", 12, "italian"),
+		testFood("curry", 14, "spicy"),
+	} {
+		if err := foods.Create(ctx, &food); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := models.FoodQuery{StoreID: models.DefaultStoreID, Tag: "italian"}
+	found, err := foods.Find(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	facets, err := foods.Facets(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := models.ComputeFoodFacets(found, query); !reflect.DeepEqual(facets, want) {
+		t.Errorf("Facets = %+v, want the counts of the %d foods Find returns: %+v", facets, len(found), want)
+	}
+}
+
+func TestSQLFoodsTrash(t *testing.T) {
+	ctx := context.Background()
+	foods := openTestSQLite(t).Foods
+
+	food := testFood("pizza", 9.5, "italian")
+	if err := foods.Create(ctx, &food); err != nil {
+		t.Fatal(err)
+	}
+	if err := foods.Delete(ctx, "other-store", food.ID.Hex()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete from another store = %v, want ErrNotFound", err)
+	}
+	if err := foods.Delete(ctx, food.StoreID, food.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := foods.ByIDs(ctx, []primitive.ObjectID{food.ID}); len(found) != 0 {
+		t.Errorf("ByIDs returned a deleted food: %v", found)
+	}
+
+	if err := foods.Restore(ctx, food.StoreID, food.ID.Hex()); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if err := foods.Delete(ctx, food.StoreID, food.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := foods.Purge(ctx, time.Now().Add(time.Minute))
+	if err != nil || len(purged) != 1 || purged[0].ID != food.ID {
+		t.Fatalf("Purge = %v, %v, want the pizza", purged, err)
+	}
+	if deleted, _ := foods.Deleted(ctx, food.StoreID); len(deleted) != 0 {
+		t.Errorf("Deleted after Purge = %v, want none", deleted)
+	}
+}
+
+func TestSQLOrdersStatus(t *testing.T) {
+	ctx := context.Background()
+	orders := openTestSQLite(t).Orders
+
+	order := testOrder(testFood("pizza", 9.5), "Pending")
+	if err := orders.Create(ctx, &order); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := orders.Pay(ctx, order.PaymentID)
+	if err != nil || before.Status != "Pending" {
+		t.Fatalf("Pay = %v, %v, want the pending order", before.Status, err)
+	}
+	if _, err := orders.Pay(ctx, order.PaymentID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Pay = %v, want ErrNotFound", err)
+	}
+	if _, err := orders.Transition(ctx, order.StoreID, order.ID, "Pending", "Cancelled"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Transition from the wrong status = %v, want ErrNotFound", err)
+	}
+	if _, err := orders.Transition(ctx, order.StoreID, order.ID, "Paid", "Delivered"); err != nil {
+		t.Fatal(err)
+	}
+
+	delivered, err := orders.Delivered(ctx, "user", order.Items[0].Food.ID)
+	if err != nil || delivered.ID != order.ID {
+		t.Errorf("Delivered = %v, %v, want the order", delivered.ID, err)
+	}
+	if _, err := orders.Delivered(ctx, "user", primitive.NewObjectID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delivered for another food = %v, want ErrNotFound", err)
+	}
+
+	statuses, err := orders.Statuses(ctx, order.StoreID)
+	if err != nil || !reflect.DeepEqual(statuses, []string{"Delivered"}) {
+		t.Errorf("Statuses = %v, %v, want [Delivered]", statuses, err)
+	}
+}
+
+func TestSQLOrdersUnreserveStockOnce(t *testing.T) {
+	ctx := context.Background()
+	orders := openTestSQLite(t).Orders
+
+	order := testOrder(testFood("pizza", 9.5), "Pending")
+	order.StockReserved = true
+	if err := orders.Create(ctx, &order); err != nil {
+		t.Fatal(err)
+	}
+
+	unreserved, err := orders.UnreserveStock(ctx, order.ID)
+	if err != nil || unreserved.StockReserved || len(unreserved.Items) != 1 {
+		t.Fatalf("UnreserveStock = %+v, %v, want the order with its items", unreserved, err)
+	}
+	if _, err := orders.UnreserveStock(ctx, order.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second UnreserveStock = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSQLOrdersReleaseDue(t *testing.T) {
+	ctx := context.Background()
+	orders := openTestSQLite(t).Orders
+
+	due, later, cancelled := testTime.Add(10*time.Minute), testTime.Add(2*time.Hour), testTime.Add(5*time.Minute)
+	for _, tc := range []struct {
+		status       string
+		scheduledFor *time.Time
+	}{
+		{"Paid", &due},
+		{"Paid", &later},
+		{"Cancelled", &cancelled},
+		{"Paid", nil},
+	} {
+		order := testOrder(testFood("pizza", 9.5), tc.status)
+		order.ScheduledFor = tc.scheduledFor
+		if err := orders.Create(ctx, &order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	released, err := orders.ReleaseDue(ctx, testTime.Add(30*time.Minute), testTime)
+	if err != nil || released != 1 {
+		t.Fatalf("ReleaseDue = %d, %v, want 1", released, err)
+	}
+	if again, _ := orders.ReleaseDue(ctx, testTime.Add(30*time.Minute), testTime); again != 0 {
+		t.Errorf("second ReleaseDue released %d orders, want 0", again)
+	}
+
+	kitchen, err := orders.Kitchen(ctx, models.DefaultStoreID)
+	if err != nil || len(kitchen) != 1 || !kitchen[0].ScheduledFor.Equal(due) {
+		t.Errorf("Kitchen = %v, %v, want the due order", kitchen, err)
+	}
+}
+
+func TestSQLOrdersPurge(t *testing.T) {
+	ctx := context.Background()
+	orders := openTestSQLite(t).Orders
+
+	order := testOrder(testFood("pizza", 9.5), "Delivered")
+	if err := orders.Create(ctx, &order); err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.Delete(ctx, order.StoreID, order.ID); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := orders.Deleted(ctx, order.StoreID); err != nil || len(deleted) != 1 || len(deleted[0].Items) != 1 {
+		t.Fatalf("Deleted = %v, %v, want the order with its items", deleted, err)
+	}
+
+	purged, err := orders.Purge(ctx, time.Now().Add(time.Minute))
+	if err != nil || purged != 1 {
+		t.Fatalf("Purge = %d, %v, want 1", purged, err)
+	}
+	if err := orders.Restore(ctx, order.StoreID, order.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Restore after Purge = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSQLStores(t *testing.T) {
+	ctx := context.Background()
+	stores := openTestSQLite(t).Stores
+
+	store := models.Store{ID: "downtown", Name: "Downtown", Slug: "downtown", Phone: "555-0100", CreatedAt: testTime, UpdatedAt: testTime}
+	if err := stores.Create(ctx, &store); err != nil {
+		t.Fatal(err)
+	}
+	var duplicate *DuplicateError
+	clash := models.Store{ID: "other", Name: "Other", Slug: "downtown"}
+	if err := stores.Create(ctx, &clash); !errors.As(err, &duplicate) || duplicate.Field != "slug" {
+		t.Fatalf("Create with a taken slug = %v, want a duplicate slug", err)
+	}
+
+	// Only the named fields are saved
+	store.Name = "Downtown Kitchen"
+	store.Phone = ""
+	store.Staff = []models.StoreStaff{{UserID: "admin", Role: models.StaffManager}}
+	if err := stores.Update(ctx, &store, "staff"); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got, err := stores.ByID(ctx, "downtown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Downtown" || got.Phone != "555-0100" || !got.HasStaff("admin", models.StaffManager) {
+		t.Errorf("after updating the staff, store = %+v", got)
+	}
+
+	missing := models.Store{ID: "missing"}
+	if err := stores.Update(ctx, &missing, "name"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update of a missing store = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSQLStoresSlots(t *testing.T) {
+	ctx := context.Background()
+	stores := openTestSQLite(t).Stores
+
+	for want := 1; want <= 2; want++ {
+		taken, err := stores.TakeSlot(ctx, "downtown", testTime)
+		if err != nil || taken != want {
+			t.Fatalf("TakeSlot = %d, %v, want %d", taken, err, want)
+		}
+	}
+	if taken, _ := stores.SlotCount(ctx, "uptown", testTime); taken != 0 {
+		t.Errorf("another store's slot count = %d, want 0", taken)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := stores.ReleaseSlot(ctx, "downtown", testTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if taken, err := stores.SlotCount(ctx, "downtown", testTime); err != nil || taken != 0 {
+		t.Errorf("after releasing more than was taken, SlotCount = %d, %v, want 0", taken, err)
+	}
+}
+
+func TestSQLInventoryAdjustIngredient(t *testing.T) {
+	ctx := context.Background()
+	inventory := openTestSQLite(t).Inventory
+
+	flour := models.Ingredient{ID: "flour", StoreID: models.DefaultStoreID, Name: "Flour", Stock: 2, LowStockThreshold: 1}
+	if err := inventory.CreateIngredient(ctx, &flour); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := inventory.AdjustIngredient(ctx, models.DefaultStoreID, "flour", -1.5)
+	if err != nil || got.Stock != 0.5 {
+		t.Fatalf("AdjustIngredient = %v, %v, want a stock of 0.5", got.Stock, err)
+	}
+	if _, err := inventory.AdjustIngredient(ctx, models.DefaultStoreID, "flour", -1); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("AdjustIngredient below zero = %v, want ErrInsufficientStock", err)
+	}
+	if _, err := inventory.AdjustIngredient(ctx, "uptown", "flour", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AdjustIngredient in another store = %v, want ErrNotFound", err)
+	}
+
+	low, err := inventory.LowStockIngredients(ctx, models.DefaultStoreID)
+	if err != nil || len(low) != 1 {
+		t.Errorf("LowStockIngredients = %v, %v, want flour", low, err)
+	}
+}
+
+func TestSQLReviewsVoteHelpfulOnce(t *testing.T) {
+	ctx := context.Background()
+	reviews := openTestSQLite(t).Reviews
+
+	review := models.Review{ID: "review", FoodID: "food", StoreID: models.DefaultStoreID, UserID: "author", OrderID: "order",
+		Rating: 5, Images: []string{"/a.jpg"}, Status: models.ReviewPending, CreatedAt: testTime, UpdatedAt: testTime}
+	if err := reviews.Create(ctx, &review); err != nil {
+		t.Fatal(err)
+	}
+	if err := reviews.VoteHelpful(ctx, "review", "reader"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("VoteHelpful on a pending review = %v, want ErrNotFound", err)
+	}
+
+	if err := reviews.Moderate(ctx, "review", models.ReviewPending, models.ReviewApproved, "admin"); err != nil {
+		t.Fatalf("Moderate: %v", err)
+	}
+	if err := reviews.Moderate(ctx, "review", models.ReviewPending, models.ReviewRejected, "admin"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Moderate from a stale status = %v, want ErrNotFound", err)
+	}
+
+	for _, voter := range []string{"reader", "reader", "other"} {
+		if err := reviews.VoteHelpful(ctx, "review", voter); err != nil {
+			t.Fatalf("VoteHelpful: %v", err)
+		}
+	}
+	approved, err := reviews.Approved(ctx, "food")
+	if err != nil || len(approved) != 1 {
+		t.Fatalf("Approved = %v, %v", approved, err)
+	}
+	if approved[0].HelpfulVotes != 2 || !reflect.DeepEqual(approved[0].Images, []string{"/a.jpg"}) {
+		t.Errorf("approved review = %+v, want 2 votes and its image", approved[0])
+	}
+}
+
+func TestSQLWebhooks(t *testing.T) {
+	ctx := context.Background()
+	hooks := openTestSQLite(t).Webhooks
+
+	for _, hook := range []models.Webhook{
+		{ID: "all", StoreID: models.DefaultStoreID, URL: "https://example.com/all", EventTypes: []string{}, Active: true, Secret: "s"},
+		{ID: "paid", StoreID: models.DefaultStoreID, URL: "https://example.com/paid", EventTypes: []string{"order.paid"}, Active: true, Secret: "s"},
+		{ID: "off", StoreID: models.DefaultStoreID, URL: "https://example.com/off", Active: false, Secret: "s"},
+	} {
+		hook := hook
+		if err := hooks.Create(ctx, &hook); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	subscribed, err := hooks.Subscribed(ctx, models.DefaultStoreID, "order.created")
+	if err != nil || len(subscribed) != 1 || subscribed[0].ID != "all" {
+		t.Errorf("Subscribed to order.created = %v, %v, want only the catch-all webhook", subscribed, err)
+	}
+
+	delivery := models.WebhookDelivery{ID: "first", WebhookID: "all", StoreID: models.DefaultStoreID, EventID: "event",
+		EventType: "order.created", Payload: "{}", Status: models.DeliveryPending, NextAttemptAt: testTime}
+	if err := hooks.AddDelivery(ctx, &delivery); err != nil {
+		t.Fatal(err)
+	}
+	again := delivery
+	again.ID = "second"
+	var duplicate *DuplicateError
+	if err := hooks.AddDelivery(ctx, &again); !errors.As(err, &duplicate) {
+		t.Errorf("AddDelivery of the same event = %v, want a duplicate", err)
+	}
+
+	due, err := hooks.Due(ctx, testTime, 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("Due = %v, %v", due, err)
+	}
+	for i, want := range []bool{true, false} {
+		if claimed, err := hooks.Claim(ctx, due[0], testTime.Add(time.Minute)); err != nil || claimed != want {
+			t.Errorf("Claim %d = %v, %v, want %v", i+1, claimed, err, want)
+		}
+	}
+}
+
+func TestSQLPasswordResetsClaimOnce(t *testing.T) {
+	ctx := context.Background()
+	resets := openTestSQLite(t).PasswordResets
+
+	for _, reset := range []models.PasswordReset{
+		{ID: "valid", UserID: "ada", TokenHash: "valid-hash", ExpiresAt: testTime.Add(time.Hour)},
+		{ID: "expired", UserID: "ada", TokenHash: "expired-hash", ExpiresAt: testTime.Add(-time.Minute)},
+		{ID: "other", UserID: "ada", TokenHash: "other-hash", ExpiresAt: testTime.Add(time.Hour)},
+	} {
+		reset := reset
+		if err := resets.Create(ctx, &reset); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reset, err := resets.Claim(ctx, "valid-hash", testTime)
+	if err != nil || reset.UserID != "ada" || reset.UsedAt == nil {
+		t.Fatalf("Claim = %+v, %v", reset, err)
+	}
+	if _, err := resets.Claim(ctx, "valid-hash", testTime); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Claim = %v, want ErrNotFound", err)
+	}
+	if _, err := resets.Claim(ctx, "expired-hash", testTime); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Claim of an expired token = %v, want ErrNotFound", err)
+	}
+
+	if err := resets.Discard(ctx, "ada", testTime); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resets.Claim(ctx, "other-hash", testTime); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Claim of a discarded token = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSQLOutboxClaim(t *testing.T) {
+	ctx := context.Background()
+	outbox := openTestSQLite(t).Outbox
+
+	for i, id := range []string{"first", "second", "third"} {
+		event := events.Event{ID: id, Type: events.OrderCreated, AggregateID: "order", Data: []byte(`{}`), OccurredAt: testTime.Add(time.Duration(i) * time.Second)}
+		if err := outbox.Add(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(records []events.Record) []string {
+		out := []string{}
+		for _, record := range records {
+			out = append(out, record.ID)
+		}
+		return out
+	}
+	now := testTime.Add(time.Minute)
+	lease := now.Add(time.Minute)
+
+	claimed, err := outbox.Claim(ctx, now, lease, 2)
+	if err != nil || !reflect.DeepEqual(ids(claimed), []string{"first", "second"}) {
+		t.Fatalf("Claim = %v, %v, want the two oldest events", ids(claimed), err)
+	}
+	// Claimed events stay hidden until their lease runs out
+	if claimed, _ := outbox.Claim(ctx, now, lease, 10); !reflect.DeepEqual(ids(claimed), []string{"third"}) {
+		t.Errorf("second Claim = %v, want only the unclaimed event", ids(claimed))
+	}
+
+	if err := outbox.MarkDispatched(ctx, "first", now); err != nil {
+		t.Fatal(err)
+	}
+	second := claimed[1]
+	second.Attempts, second.NextAttemptAt, second.LastError, second.Delivered = 1, lease.Add(time.Hour), "mail server down", []string{"webhooks"}
+	if err := outbox.MarkFailed(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+
+	// After the lease only the third event is due again: the first was
+	// dispatched and the second waits for its retry
+	if claimed, _ := outbox.Claim(ctx, lease, lease.Add(time.Minute), 10); !reflect.DeepEqual(ids(claimed), []string{"third"}) {
+		t.Errorf("Claim after the lease = %v, want only the third event", ids(claimed))
+	}
+	retry := lease.Add(time.Hour)
+	claimed, err = outbox.Claim(ctx, retry, retry.Add(time.Minute), 10)
+	if err != nil || len(claimed) != 2 || claimed[0].ID != "second" {
+		t.Fatalf("Claim at the retry = %v, %v, want second and third", ids(claimed), err)
+	}
+	if claimed[0].Attempts != 1 || claimed[0].LastError != "mail server down" || !reflect.DeepEqual(claimed[0].Delivered, []string{"webhooks"}) {
+		t.Errorf("retried record = %+v, want its attempt, error and deliveries kept", claimed[0])
+	}
+
+	// Dead events are no longer claimed, and pruning only removes
+	// dispatched ones
+	dead := claimed[0]
+	deadAt := retry
+	dead.DeadAt = &deadAt
+	if err := outbox.MarkFailed(ctx, dead); err != nil {
+		t.Fatal(err)
+	}
+	later := retry.Add(time.Hour)
+	if claimed, _ := outbox.Claim(ctx, later, later.Add(time.Minute), 10); !reflect.DeepEqual(ids(claimed), []string{"third"}) {
+		t.Errorf("Claim after the second died = %v, want only the third event", ids(claimed))
+	}
+	if pruned, err := outbox.Prune(ctx, later); err != nil || pruned != 1 {
+		t.Errorf("Prune = %d, %v, want the dispatched event", pruned, err)
+	}
+}
+
+func TestOpenSQLiteCreatesTheDefaultStoreOnce(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	for i := 0; i < 2; i++ {
+		repos, err := OpenSQLite(path)
+		if err != nil {
+			t.Fatalf("OpenSQLite (open %d): %v", i+1, err)
+		}
+		stores, err := repos.Stores.List(context.Background())
+		if err != nil || len(stores) != 1 || stores[0].ID != models.DefaultStoreID {
+			t.Fatalf("stores = %+v, %v, want only the default store", stores, err)
+		}
+	}
+}
+
+func TestSQLCreatesUndoneWithoutATransaction(t *testing.T) {
+	ctx := context.Background()
+	repos := openTestSQLite(t)
+	failed := errors.New("failed")
+
+	user := testUser("ada", "ada@example.com")
+	food := testFood("pizza", 9.5, "italian")
+	order := testOrder(food, "Pending")
+	event := events.Event{ID: "event", Type: events.OrderCreated, Data: []byte(`{}`), OccurredAt: testTime}
+	err := (&uow.Memory{}).Do(ctx, func(ctx context.Context) error {
+		if err := repos.Users.Create(ctx, &user); err != nil {
+			return err
+		}
+		if err := repos.Foods.Create(ctx, &food); err != nil {
+			return err
+		}
+		if err := repos.Orders.Create(ctx, &order); err != nil {
+			return err
+		}
+		if err := repos.Prices.Record(ctx, &models.PriceChange{ID: "change", FoodID: food.ID.Hex(), OldPrice: 9, NewPrice: 9.5, CreatedAt: testTime}); err != nil {
+			return err
+		}
+		if err := repos.Outbox.Add(ctx, event); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Do = %v, want %v", err, failed)
+	}
+
+	if _, err := repos.Users.ByID(ctx, "ada"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("user after the rollback: %v, want ErrNotFound", err)
+	}
+	if foods, _ := repos.Foods.Find(ctx, models.FoodQuery{}); len(foods) != 0 {
+		t.Errorf("foods after the rollback = %v", foods)
+	}
+	if _, err := repos.Orders.ByID(ctx, order.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("order after the rollback: %v, want ErrNotFound", err)
+	}
+	if history, _ := repos.Prices.History(ctx, food.ID.Hex()); len(history) != 0 {
+		t.Errorf("price history after the rollback = %v", history)
+	}
+	if claimed, _ := repos.Outbox.Claim(ctx, testTime, testTime.Add(time.Minute), 10); len(claimed) != 0 {
+		t.Errorf("outbox after the rollback = %v", claimed)
+	}
+
+	// Without a failure everything stays
+	if err := (&uow.Memory{}).Do(ctx, func(ctx context.Context) error { return repos.Users.Create(ctx, &user) }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Users.ByID(ctx, "ada"); err != nil {
+		t.Errorf("user after a successful unit of work: %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"go_backend/controllers"
+	"go_backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupCategoriesRouter(router *gin.Engine) {
+	// Menu category routes, for the default store and per store
+	categoryRoutes(router.Group("/api/categories"))
+	categoryRoutes(router.Group("/api/stores/:storeId/categories"))
+
+	// Structured menu
+	router.GET("/api/menu", controllers.GetMenu)
+	router.GET("/api/stores/:storeId/menu", controllers.GetMenu)
+}
+
+func categoryRoutes(categoryGroup *gin.RouterGroup) {
+	categoryGroup.GET("", controllers.GetCategories)
+	categoryGroup.POST("", middleware.RequireStoreAdmin(), controllers.CreateCategory)
+	categoryGroup.PUT("/:categoryId", middleware.RequireStoreAdmin(), controllers.UpdateCategory)
+	categoryGroup.DELETE("/:categoryId", middleware.RequireStoreAdmin(), controllers.DeleteCategory)
+}
@@ -2,21 +2,38 @@ package routes
 
 import (
 	"go_backend/controllers"
+	"go_backend/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 func SetupFoodsRouter(router *gin.Engine) {
-	// Food-related routes
-	foodGroup := router.Group("/api/foods")
-	{
-		foodGroup.GET("", controllers.GetAllFoods)
-		foodGroup.GET("/search/:searchTerm", controllers.SearchFoods)
-		foodGroup.GET("/tags", controllers.GetAllTags)
-		foodGroup.GET("/tag/:tag", controllers.GetFoodsByTag)
-		foodGroup.GET("/:foodId", controllers.GetFoodByID)
-		foodGroup.DELETE("/:foodId", controllers.DeleteFood)
-		foodGroup.PUT("/", controllers.UpdateFood)
-		foodGroup.POST("/", controllers.AddFood)
-	}
+	// Food-related routes, for the default store and per store
+	foodRoutes(router.Group("/api/foods"))
+	foodRoutes(router.Group("/api/stores/:storeId/foods"))
+}
+
+func foodRoutes(foodGroup *gin.RouterGroup) {
+	foodGroup.GET("", controllers.GetAllFoods)
+	foodGroup.GET("/search/:searchTerm", controllers.SearchFoods)
+	foodGroup.GET("/tags", controllers.GetAllTags)
+	foodGroup.GET("/facets", controllers.GetFoodFacets)
+	foodGroup.GET("/tag/:tag", controllers.GetFoodsByTag)
+	foodGroup.GET("/trash", middleware.RequireStoreAdmin(), controllers.GetFoodTrash)
+	foodGroup.POST("/:foodId/restore", middleware.RequireStoreAdmin(), controllers.RestoreFood)
+	foodGroup.GET("/export", middleware.RequireStoreAdmin(), controllers.ExportFoods)
+	foodGroup.POST("/import", middleware.RequireStoreAdmin(), controllers.ImportFoods)
+	foodGroup.GET("/:foodId", controllers.GetFoodByID)
+	foodGroup.GET("/:foodId/reviews", controllers.GetFoodReviews)
+	foodGroup.POST("/:foodId/reviews", middleware.RequireAuth(), middleware.RequireVerified(middleware.ActionReviews), controllers.CreateReview)
+	foodGroup.PATCH("/:foodId", middleware.RequireStoreAdmin(), controllers.PatchFood)
+	foodGroup.DELETE("/:foodId", middleware.RequireStoreAdmin(), controllers.DeleteFood)
+	foodGroup.GET("/:foodId/prices", middleware.RequireStoreAdmin(), controllers.GetPriceHistory)
+	foodGroup.POST("/:foodId/prices/schedule", middleware.RequireStoreAdmin(), controllers.SchedulePrice)
+	foodGroup.DELETE("/:foodId/prices/schedule/:scheduleId", middleware.RequireStoreAdmin(), controllers.CancelPriceSchedule)
+	foodGroup.PUT("/:foodId/categories", middleware.RequireStoreAdmin(), controllers.SetFoodCategories)
+	foodGroup.POST("/:foodId/images", middleware.RequireStoreAdmin(), controllers.UploadFoodImage)
+	foodGroup.DELETE("/:foodId/images/:imageId", middleware.RequireStoreAdmin(), controllers.DeleteFoodImage)
+	foodGroup.PUT("/", middleware.RequireStoreAdmin(), controllers.UpdateFood)
+	foodGroup.POST("/", middleware.RequireStoreAdmin(), controllers.AddFood)
 }
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"go_backend/controllers"
+	"go_backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupInventoryRouter(router *gin.Engine) {
+	// Admin stock management routes, for the default store and per store
+	inventoryRoutes(router.Group("/api/inventory", middleware.RequireStoreAdmin()))
+	inventoryRoutes(router.Group("/api/stores/:storeId/inventory", middleware.RequireStoreAdmin()))
+}
+
+func inventoryRoutes(inventoryGroup *gin.RouterGroup) {
+	inventoryGroup.GET("/ingredients", controllers.GetIngredients)
+	inventoryGroup.POST("/ingredients", controllers.AddIngredient)
+	inventoryGroup.POST("/adjust", controllers.AdjustStock)
+	inventoryGroup.GET("/adjustments", controllers.GetStockAdjustments)
+	inventoryGroup.GET("/lowStock", controllers.GetLowStock)
+}
@@ -2,20 +2,35 @@ package routes
 
 import (
 	"go_backend/controllers"
+	"go_backend/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRouter() *gin.Engine {
 	router := gin.Default()
+	router.Use(middleware.Authenticate())
 
-	// Order routes
-	router.POST("/api/orders/create", controllers.CreateOrder)
-	router.GET("/api/orders/newOrderForCurrentUser", controllers.GetNewOrderForCurrentUser)
-	router.PUT("/api/orders/pay", controllers.Pay)
-	router.GET("/api/orders/track/:orderId", controllers.TrackOrderById)
-	router.GET("/api/orders/:state", controllers.GetAll)
-	router.GET("/api/orders/allstatus", controllers.GetAllStatus)
+	// Order routes, for the default store and per store
+	orderRoutes(router.Group("/api/orders"))
+	orderRoutes(router.Group("/api/stores/:storeId/orders"))
 
 	return router
 }
+
+func orderRoutes(orderGroup *gin.RouterGroup) {
+	orderGroup.POST("/create", middleware.RequireAuth(), middleware.RequireVerified(middleware.ActionOrders), controllers.CreateOrder)
+	orderGroup.GET("/newOrderForCurrentUser", middleware.RequireAuth(), controllers.GetNewOrderForCurrentUser)
+	orderGroup.PUT("/pay", middleware.RequireAuth(), middleware.RequireVerified(middleware.ActionOrders), controllers.Pay)
+	orderGroup.PUT("/cancel/:orderId", middleware.RequireAuth(), controllers.CancelOrder)
+	orderGroup.PUT("/paymentFailed/:orderId", middleware.RequireAuth(), controllers.PaymentFailed)
+	orderGroup.PUT("/deliver/:orderId", middleware.RequireStoreAdmin(), controllers.DeliverOrder)
+	orderGroup.GET("/track/:orderId", middleware.RequireAuth(), controllers.TrackOrderById)
+	orderGroup.GET("", middleware.RequireStoreAdmin(), controllers.GetAll)
+	orderGroup.GET("/:state", middleware.RequireStoreAdmin(), controllers.GetAll)
+	orderGroup.GET("/allstatus", middleware.RequireStoreAdmin(), controllers.GetAllStatus)
+	orderGroup.GET("/kitchen", middleware.RequireStoreAdmin(), controllers.GetKitchenOrders)
+	orderGroup.GET("/trash", middleware.RequireStoreAdmin(), controllers.GetOrderTrash)
+	orderGroup.DELETE("/:orderId", middleware.RequireStoreAdmin(), controllers.DeleteOrder)
+	orderGroup.POST("/:orderId/restore", middleware.RequireStoreAdmin(), controllers.RestoreOrder)
+}
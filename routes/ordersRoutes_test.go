@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOrderListsNeedAStoreAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	orderRoutes(router.Group("/api/orders"))
+
+	for _, path := range []string{"/api/orders", "/api/orders/Paid", "/api/orders/allstatus"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("anonymous GET %s = %d, want %d", path, recorder.Code, http.StatusUnauthorized)
+		}
+	}
+}
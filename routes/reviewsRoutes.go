@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"go_backend/controllers"
+	"go_backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupReviewsRouter(router *gin.Engine) {
+	// Review moderation and voting routes, for the default store and per store
+	reviewRoutes(router.Group("/api/reviews"))
+	reviewRoutes(router.Group("/api/stores/:storeId/reviews"))
+}
+
+func reviewRoutes(reviewGroup *gin.RouterGroup) {
+	reviewGroup.GET("/pending", middleware.RequireStoreAdmin(), controllers.GetPendingReviews)
+	reviewGroup.PUT("/:reviewId/moderate", middleware.RequireStoreAdmin(), controllers.ModerateReview)
+	reviewGroup.POST("/:reviewId/helpful", middleware.RequireAuth(), controllers.VoteReviewHelpful)
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"go_backend/controllers"
+	"go_backend/middleware"
+	"go_backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupStoreRouter(router *gin.Engine) {
+	// Store management routes
+	storeGroup := router.Group("/api/stores")
+	{
+		storeGroup.GET("", controllers.GetStores)
+		storeGroup.POST("", middleware.RequireSuperAdmin(), controllers.CreateStore)
+		storeGroup.GET("/:storeId", controllers.GetStore)
+		storeGroup.PUT("/:storeId", middleware.RequireStoreAdmin(models.StaffManager), controllers.UpdateStore)
+		storeGroup.PUT("/:storeId/staff", middleware.RequireStoreAdmin(models.StaffManager), controllers.UpdateStoreStaff)
+	}
+
+	// Opening hours routes, for the default store and per store
+	storeHoursRoutes(router.Group("/api/store"))
+	storeHoursRoutes(router.Group("/api/stores/:storeId"))
+}
+
+func storeHoursRoutes(storeGroup *gin.RouterGroup) {
+	storeGroup.GET("/hours", controllers.GetStoreHours)
+	storeGroup.PUT("/hours", middleware.RequireStoreAdmin(), controllers.UpdateStoreHours)
+	storeGroup.GET("/status", controllers.GetStoreStatus)
+	storeGroup.GET("/slots", controllers.GetSlots)
+}
@@ -1,22 +1,49 @@
 package routes
 
 import (
+	"time"
+
 	"go_backend/controllers"
+	"go_backend/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
+// resendLimiter allows each user a few verification emails an hour.
+var resendLimiter = middleware.NewLimiter(3, time.Hour)
+
+// Password reset requests and attempts are limited per client address.
+var (
+	forgotPasswordLimiter = middleware.NewLimiter(5, 15*time.Minute)
+	resetPasswordLimiter  = middleware.NewLimiter(10, 15*time.Minute)
+)
+
 func UserRoutes(router *gin.Engine) {
 	// User-related routes
 	userGroup := router.Group("/api/users")
 	{
 		userGroup.POST("/login", controllers.Login)
 		userGroup.POST("/register", controllers.Register)
-		userGroup.PUT("/updateProfile", controllers.UpdateProfile)
-		userGroup.PUT("/changePassword", controllers.ChangePassword)
-		userGroup.GET("/getAll/:searchTerm", controllers.GetAll)
-		userGroup.PUT("/toggleBlock/:userId", controllers.ToggleBlock)
-		userGroup.GET("/getById/:userId", controllers.GetById)
-		userGroup.PUT("/update", controllers.UpdateUser)
+		userGroup.POST("/verifyEmail", controllers.VerifyEmail)
+		userGroup.POST("/resendVerification", middleware.RequireAuth(), middleware.RateLimit(resendLimiter, middleware.ByUser), controllers.ResendVerification)
+		userGroup.PUT("/updateProfile", middleware.RequireAuth(), controllers.UpdateProfile)
+		userGroup.PUT("/changePassword", middleware.RequireAuth(), controllers.ChangePassword)
+		userGroup.POST("/forgotPassword", middleware.RateLimit(forgotPasswordLimiter, middleware.ByIP), controllers.ForgotPassword)
+		userGroup.POST("/resetPassword", middleware.RateLimit(resetPasswordLimiter, middleware.ByIP), controllers.ResetPassword)
+		userGroup.GET("/getAll/:searchTerm", middleware.RequireAdmin(), controllers.GetAllUsers)
+		userGroup.GET("/getById/:userId", middleware.RequireAdmin(), controllers.GetById)
+		// Store admins are admins too, so changing other accounts is left
+		// to super admins
+		userGroup.PUT("/toggleBlock/:userId", middleware.RequireSuperAdmin(), controllers.ToggleBlock)
+		userGroup.PUT("/update", middleware.RequireSuperAdmin(), controllers.UpdateUser)
+		userGroup.GET("/trash", middleware.RequireSuperAdmin(), controllers.GetUserTrash)
+		userGroup.DELETE("/:userId", middleware.RequireSuperAdmin(), controllers.DeleteUser)
+		userGroup.POST("/:userId/restore", middleware.RequireSuperAdmin(), controllers.RestoreUser)
+		userGroup.GET("/favorites", middleware.RequireAuth(), controllers.GetFavorites)
+		userGroup.POST("/favorites/:foodId", middleware.RequireAuth(), controllers.AddFavorite)
+		userGroup.DELETE("/favorites/:foodId", middleware.RequireAuth(), controllers.RemoveFavorite)
+		userGroup.GET("/allergens", middleware.RequireAuth(), controllers.GetAllergenProfile)
+		userGroup.PUT("/allergens", middleware.RequireAuth(), controllers.UpdateAllergenProfile)
+		userGroup.POST("/cart/allergens", middleware.RequireAuth(), controllers.CheckCartAllergens)
 	}
 }
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStoreAdminsCantManageAccounts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// A store manager: an admin, but not a super admin
+	router.Use(func(c *gin.Context) {
+		c.Set("userId", "manager")
+		c.Set("isAdmin", true)
+	})
+	UserRoutes(router)
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPut, "/api/users/toggleBlock/owner"},
+		{http.MethodPut, "/api/users/update"},
+		{http.MethodGet, "/api/users/trash"},
+		{http.MethodDelete, "/api/users/owner"},
+		{http.MethodPost, "/api/users/owner/restore"},
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(route.method, route.path, nil))
+		if recorder.Code != http.StatusForbidden {
+			t.Errorf("%s %s = %d, want %d", route.method, route.path, recorder.Code, http.StatusForbidden)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"go_backend/controllers"
+	"go_backend/middleware"
+	"go_backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupWebhooksRouter(router *gin.Engine) {
+	// Webhook routes, for the default store and per store
+	webhookRoutes(router.Group("/api/webhooks"))
+	webhookRoutes(router.Group("/api/stores/:storeId/webhooks"))
+}
+
+func webhookRoutes(webhookGroup *gin.RouterGroup) {
+	manager := middleware.RequireStoreAdmin(models.StaffManager)
+	webhookGroup.GET("", manager, controllers.GetWebhooks)
+	webhookGroup.POST("", manager, controllers.CreateWebhook)
+	webhookGroup.PUT("/:webhookId", manager, controllers.UpdateWebhook)
+	webhookGroup.DELETE("/:webhookId", manager, controllers.DeleteWebhook)
+	webhookGroup.GET("/:webhookId/deliveries", manager, controllers.GetWebhookDeliveries)
+	webhookGroup.POST("/deliveries/:deliveryId/redeliver", manager, controllers.RedeliverWebhook)
+}
@@ -0,0 +1,34 @@
+package uow
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// GORM runs each unit of work as a SQL transaction. Repositories reach the
+// transaction through DB.
+type GORM struct {
+	DB *gorm.DB
+	// Attempts defaults to DefaultAttempts.
+	Attempts int
+}
+
+type txKey struct{}
+
+func (g GORM) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return retry(ctx, g.Attempts, func() error {
+		return g.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(context.WithValue(ctx, txKey{}, tx))
+		})
+	})
+}
+
+// DB returns the transaction of the GORM unit of work running ctx, or db
+// outside of one.
+func DB(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx
+	}
+	return db.WithContext(ctx)
+}
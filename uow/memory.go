@@ -0,0 +1,52 @@
+package uow
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is the in-process UnitOfWork for tests and for stores without
+// transactions, such as a standalone Mongo server. Units of work run one at
+// a time, and when one fails the undo functions it registered with
+// OnRollback run newest first.
+type Memory struct {
+	// Attempts defaults to DefaultAttempts.
+	Attempts int
+
+	mu sync.Mutex
+}
+
+type rollbackKey struct{}
+
+type rollbackLog struct {
+	undo []func()
+}
+
+func (m *Memory) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return retry(ctx, m.Attempts, func() error {
+		log := &rollbackLog{}
+		err := fn(context.WithValue(ctx, rollbackKey{}, log))
+		if err != nil {
+			log.rollback()
+		}
+		return err
+	})
+}
+
+func (l *rollbackLog) rollback() {
+	for i := len(l.undo) - 1; i >= 0; i-- {
+		l.undo[i]()
+	}
+}
+
+// OnRollback registers undo to run if the unit of work running ctx fails.
+// Only Memory runs undo functions: Mongo and SQL transactions discard their
+// writes themselves, so undoing them again would count twice.
+func OnRollback(ctx context.Context, undo func()) {
+	if log, ok := ctx.Value(rollbackKey{}).(*rollbackLog); ok {
+		log.undo = append(log.undo, undo)
+	}
+}
@@ -0,0 +1,66 @@
+package uow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryRollsBackNewestFirst(t *testing.T) {
+	failed := errors.New("failed")
+	undone := []string{}
+
+	err := (&Memory{}).Do(context.Background(), func(ctx context.Context) error {
+		OnRollback(ctx, func() { undone = append(undone, "slot") })
+		OnRollback(ctx, func() { undone = append(undone, "stock") })
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Do = %v, want %v", err, failed)
+	}
+	if want := []string{"stock", "slot"}; !reflect.DeepEqual(undone, want) {
+		t.Errorf("undone = %v, want %v", undone, want)
+	}
+}
+
+func TestMemoryKeepsSuccessfulWork(t *testing.T) {
+	undone := false
+	err := (&Memory{}).Do(context.Background(), func(ctx context.Context) error {
+		OnRollback(ctx, func() { undone = true })
+		return nil
+	})
+	if err != nil || undone {
+		t.Errorf("Do = %v, undone = %v; want the work kept", err, undone)
+	}
+}
+
+func TestMemoryRetriesTransientFailures(t *testing.T) {
+	attempts, undone := 0, 0
+	err := (&Memory{Attempts: 3}).Do(context.Background(), func(ctx context.Context) error {
+		attempts++
+		OnRollback(ctx, func() { undone++ })
+		if attempts < 3 {
+			return fmt.Errorf("attempt %d: %w", attempts, ErrTransient)
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 || undone != 2 {
+		t.Errorf("Do = %v after %d attempts and %d undos, want success after 3 attempts and 2 undos", err, attempts, undone)
+	}
+
+	attempts = 0
+	err = (&Memory{Attempts: 2}).Do(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return ErrTransient
+	})
+	if !errors.Is(err, ErrTransient) || attempts != 2 {
+		t.Errorf("Do = %v after %d attempts, want ErrTransient after 2", err, attempts)
+	}
+}
+
+func TestOnRollbackOutsideMemory(t *testing.T) {
+	// Outside a Memory unit of work there is nothing to undo with
+	OnRollback(context.Background(), func() { t.Error("undo ran outside a unit of work") })
+}
@@ -0,0 +1,66 @@
+package uow
+
+import (
+	"context"
+	"errors"
+
+	"go_backend/data"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Mongo runs each unit of work as a Mongo transaction. The context given
+// to fn carries the session, so collection calls made with it join the
+// transaction. Transactions need a replica set; on a standalone server
+// use Memory instead.
+type Mongo struct {
+	// Client defaults to data.GetMongoClient(). Collections used inside
+	// the unit of work must come from the same client.
+	Client *mongo.Client
+	// Attempts defaults to DefaultAttempts.
+	Attempts int
+}
+
+func (m Mongo) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	client := m.Client
+	if client == nil {
+		client = data.GetMongoClient()
+	}
+
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	return retry(ctx, m.Attempts, func() error {
+		return mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+			if err := sc.StartTransaction(); err != nil {
+				return err
+			}
+			if err := fn(sc); err != nil {
+				sc.AbortTransaction(context.Background())
+				return err
+			}
+			return m.commit(sc)
+		})
+	})
+}
+
+// commit retries a commit whose outcome the server couldn't confirm.
+// Committing again is safe; the server applies the transaction once.
+func (m Mongo) commit(sc mongo.SessionContext) error {
+	attempts := m.Attempts
+	if attempts < 1 {
+		attempts = DefaultAttempts
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		err = sc.CommitTransaction(sc)
+		var labeled mongo.LabeledError
+		if err == nil || !(errors.As(err, &labeled) && labeled.HasErrorLabel("UnknownTransactionCommitResult")) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+// Package uow runs groups of reads and writes as a unit of work that
+// either takes effect as a whole or not at all.
+package uow
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultAttempts is how many times Do runs a unit of work that keeps
+// failing with transient errors.
+const DefaultAttempts = 3
+
+// ErrTransient marks a failure that may succeed when retried. Mongo errors
+// labelled TransientTransactionError count as transient too.
+var ErrTransient = errors.New("transient failure")
+
+// UnitOfWork runs functions atomically.
+type UnitOfWork interface {
+	// Do runs fn as one unit of work. fn must do all its reads and writes
+	// with the context it is given. When fn fails transiently the whole
+	// unit is retried, so fn must not keep state between attempts.
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// IsTransient reports whether err may succeed on retry.
+func IsTransient(err error) bool {
+	if errors.Is(err, ErrTransient) {
+		return true
+	}
+	var labeled interface{ HasErrorLabel(string) bool }
+	return errors.As(err, &labeled) && labeled.HasErrorLabel("TransientTransactionError")
+}
+
+// retry runs attempt until it succeeds, fails permanently or has been tried
+// attempts times, backing off a little longer each time.
+func retry(ctx context.Context, attempts int, attempt func() error) error {
+	if attempts < 1 {
+		attempts = DefaultAttempts
+	}
+	for i := 1; ; i++ {
+		err := attempt()
+		if err == nil || i >= attempts || !IsTransient(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(i) * 20 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go_backend/clock"
+	"go_backend/models"
+	"go_backend/repository"
+)
+
+const (
+	defaultMaxAttempts = 8
+	batchSize          = 50
+	// claimLease hides a delivery from other senders while it is sent.
+	claimLease = 2 * time.Minute
+	maxBackoff = 6 * time.Hour
+)
+
+// Sender sends due deliveries.
+type Sender struct {
+	Clock    clock.Clock
+	Webhooks repository.Webhooks
+	Client   *http.Client
+	// MaxAttempts is how many failed attempts move a delivery to the dead
+	// letter state.
+	MaxAttempts int
+}
+
+// NewSender reads the attempt limit from WEBHOOK_MAX_ATTEMPTS, defaulting
+// to 8, and times requests out after 10 seconds. Its client refuses to
+// connect to blocked addresses.
+func NewSender(c clock.Clock, hooks repository.Webhooks) *Sender {
+	maxAttempts := defaultMaxAttempts
+	if raw := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			maxAttempts = n
+		} else {
+			log.Printf("Ignoring invalid WEBHOOK_MAX_ATTEMPTS %q", raw)
+		}
+	}
+	return &Sender{Clock: c, Webhooks: hooks, Client: NewClient(10 * time.Second), MaxAttempts: maxAttempts}
+}
+
+// NewClient returns an HTTP client that checks each address it dials, so a
+// host that resolved to a public address when the webhook was saved can't
+// later be pointed at a private one. It doesn't use proxies, whose
+// addresses would be checked instead of the endpoint's.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || (blocked(ip) && !allowPrivate()) {
+				return ErrPrivateAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// Run sends the deliveries that are due.
+func (s *Sender) Run(ctx context.Context) error {
+	now := s.Clock.Now()
+	deliveries, err := s.Webhooks.Due(ctx, now, batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		// Claim the delivery so other instances skip it
+		claimed, err := s.Webhooks.Claim(ctx, delivery, now.Add(claimLease))
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		if err := s.attempt(ctx, delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attempt sends one delivery and records the outcome.
+func (s *Sender) attempt(ctx context.Context, delivery models.WebhookDelivery) error {
+	hook, err := s.Webhooks.ByID(ctx, delivery.StoreID, delivery.WebhookID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return s.record(ctx, delivery, 0, fmt.Errorf("webhook was deleted"), true)
+	}
+	if err != nil {
+		return err
+	}
+	if !hook.Active {
+		return s.record(ctx, delivery, 0, fmt.Errorf("webhook is disabled"), true)
+	}
+
+	status, err := s.send(ctx, hook, delivery)
+	return s.record(ctx, delivery, status, err, false)
+}
+
+// send posts the delivery and returns the response status. Any status
+// other than 2xx is an error.
+func (s *Sender) send(ctx context.Context, hook models.Webhook, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := s.Clock.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "foodstore-webhooks")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// record stores the outcome of an attempt. Failures are retried with
+// backoff until MaxAttempts, or not at all when final is set.
+func (s *Sender) record(ctx context.Context, delivery models.WebhookDelivery, status int, sendErr error, final bool) error {
+	now := s.Clock.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.LastStatusCode = status
+	delivery.LastError = ""
+	delivery.UpdatedAt = now
+
+	switch {
+	case sendErr == nil:
+		delivery.Status = models.DeliverySucceeded
+	case final || delivery.Attempts >= s.maxAttempts():
+		delivery.Status = models.DeliveryDeadLetter
+		delivery.LastError = sendErr.Error()
+		log.Printf("Webhook delivery %s to %s moved to dead letter after %d attempts: %v", delivery.ID, delivery.WebhookID, delivery.Attempts, sendErr)
+	default:
+		delivery.LastError = sendErr.Error()
+		delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts))
+	}
+
+	return s.Webhooks.RecordAttempt(ctx, &delivery)
+}
+
+func (s *Sender) maxAttempts() int {
+	if s.MaxAttempts <= 0 {
+		return defaultMaxAttempts
+	}
+	return s.MaxAttempts
+}
+
+// Backoff is the delay before retrying after the given number of failed
+// attempts: 30s, 1m, 2m and so on, capped at six hours.
+func Backoff(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
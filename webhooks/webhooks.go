@@ -0,0 +1,169 @@
+// Package webhooks sends a store's order events to the endpoints its
+// admins have registered. Each request is signed with the webhook's
+// secret, retried with exponential backoff, and dead-lettered after
+// repeated failures.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"go_backend/events"
+	"go_backend/models"
+	"go_backend/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventTypes are the events webhooks can subscribe to.
+var EventTypes = []string{events.OrderCreated, events.OrderPaid, events.OrderStatusChanged}
+
+// Request headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// ErrPrivateAddress is returned for webhook hosts on loopback, private or
+// link-local addresses, which would let store admins reach the server's
+// own network.
+var ErrPrivateAddress = errors.New("url must not point to a private, loopback or link-local address")
+
+// Validate checks a webhook's URL and event types. The URL's host is
+// resolved and must only have public addresses.
+func Validate(ctx context.Context, w models.Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if err := checkHost(ctx, u.Hostname()); err != nil {
+		return err
+	}
+	for _, eventType := range w.EventTypes {
+		known := false
+		for _, t := range EventTypes {
+			known = known || t == eventType
+		}
+		if !known {
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+	}
+	return nil
+}
+
+// checkHost resolves host and rejects it if any of its addresses is
+// blocked
+func checkHost(ctx context.Context, host string) error {
+	if allowPrivate() {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if blocked(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// blocked reports whether ip is one webhooks may not be sent to.
+func blocked(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// allowPrivate lets development setups point webhooks at local endpoints
+// by setting WEBHOOK_ALLOW_PRIVATE to true.
+func allowPrivate() bool {
+	return os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+}
+
+// NewSecret returns a random signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign is the X-Webhook-Signature for a delivery: "sha256=" followed by the
+// hex HMAC-SHA256, keyed by the secret, of the timestamp, a dot and the
+// body. Receivers recompute it to check the request and reject stale
+// timestamps to stop replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sink queues a delivery of each event for every active webhook of the
+// event's store that subscribes to it.
+type Sink struct {
+	Webhooks repository.Webhooks
+}
+
+func (Sink) Name() string { return "webhooks" }
+
+func (s Sink) Deliver(ctx context.Context, event events.Event) error {
+	if event.StoreID == "" || !subscribable(event.Type) {
+		return nil
+	}
+
+	hooks, err := s.Webhooks.Subscribed(ctx, event.StoreID, event.Type)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		delivery := models.WebhookDelivery{
+			ID:            primitive.NewObjectID().Hex(),
+			WebhookID:     hook.ID,
+			StoreID:       hook.StoreID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: time.Now(),
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
+		}
+		// Events can be dispatched more than once; the unique index on
+		// webhook and event keeps a single delivery
+		var duplicate *repository.DuplicateError
+		if err := s.Webhooks.AddDelivery(ctx, &delivery); err != nil && !errors.As(err, &duplicate) {
+			return err
+		}
+	}
+	return nil
+}
+
+func subscribable(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go_backend/clock"
+	"go_backend/models"
+	"go_backend/repository"
+)
+
+var testTime = time.Date(2024, 3, 1, 18, 30, 0, 0, time.UTC)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":"evt"}`)
+	timestamp := testTime.Unix()
+
+	// Computed independently with Python's hmac module
+	want := "sha256=3c9ed3d09ebfde4a73157638b028069c271f6b1ddfb009fa0c34a496b0b259c9"
+	if got := Sign("secret", timestamp, body); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+
+	for name, other := range map[string]string{
+		"secret":    Sign("other", timestamp, body),
+		"timestamp": Sign("secret", timestamp+1, body),
+		"body":      Sign("secret", timestamp, []byte(`{"id":"evt2"}`)),
+	} {
+		if other == want {
+			t.Errorf("changing the %s kept the signature", name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	badURL := errors.New("url must be an absolute http or https URL")
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://93.184.216.34/hook", nil},
+		{"http://[2606:2800:220:1::]/hook", nil},
+		{"ftp://93.184.216.34/hook", badURL},
+		{"/hook", badURL},
+		{"http://127.0.0.1:8080/hook", ErrPrivateAddress},
+		{"http://localhost/hook", ErrPrivateAddress},
+		{"http://[::1]/hook", ErrPrivateAddress},
+		{"http://10.0.0.5/hook", ErrPrivateAddress},
+		{"http://192.168.1.1/hook", ErrPrivateAddress},
+		{"http://169.254.169.254/latest/meta-data", ErrPrivateAddress},
+		{"http://[fe80::1]/hook", ErrPrivateAddress},
+		{"http://0.0.0.0/hook", ErrPrivateAddress},
+	}
+	for _, tt := range tests {
+		err := Validate(context.Background(), models.Webhook{URL: tt.url})
+		if (tt.want == nil) != (err == nil) || (err != nil && err.Error() != tt.want.Error()) {
+			t.Errorf("Validate(%s) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+	if err := Validate(context.Background(), models.Webhook{URL: "http://127.0.0.1:8080/hook"}); err != nil {
+		t.Errorf("Validate with WEBHOOK_ALLOW_PRIVATE = %v, want nil", err)
+	}
+}
+
+func TestNewClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// A host that passed Validate may resolve somewhere else by the time
+	// the delivery is sent
+	_, err := NewClient(time.Second).Get(server.URL)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("Get = %v, want ErrPrivateAddress", err)
+	}
+
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+	resp, err := NewClient(time.Second).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get with WEBHOOK_ALLOW_PRIVATE = %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{1000, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// testSender sends deliveries of one webhook to handler
+func testSender(t *testing.T, handler http.HandlerFunc) (*Sender, repository.Webhooks) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	repos, err := repository.OpenSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hook := models.Webhook{ID: "hook", StoreID: models.DefaultStoreID, URL: server.URL, Active: true, Secret: "secret"}
+	if err := repos.Webhooks.Create(ctx, &hook); err != nil {
+		t.Fatal(err)
+	}
+	delivery := models.WebhookDelivery{ID: "delivery", WebhookID: "hook", StoreID: models.DefaultStoreID, EventID: "evt",
+		EventType: "order.paid", Payload: `{"id":"evt"}`, Status: models.DeliveryPending, NextAttemptAt: testTime}
+	if err := repos.Webhooks.AddDelivery(ctx, &delivery); err != nil {
+		t.Fatal(err)
+	}
+	return &Sender{Clock: clock.Fixed(testTime), Webhooks: repos.Webhooks, Client: server.Client(), MaxAttempts: 3}, repos.Webhooks
+}
+
+func storedDelivery(t *testing.T, hooks repository.Webhooks) models.WebhookDelivery {
+	t.Helper()
+	deliveries, err := hooks.Deliveries(context.Background(), models.DefaultStoreID, "hook", "", 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Deliveries = %v, %v", deliveries, err)
+	}
+	return deliveries[0]
+}
+
+func TestSenderSignsRequests(t *testing.T) {
+	var signed bool
+	sender, hooks := testSender(t, func(w http.ResponseWriter, r *http.Request) {
+		timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		signed = timestamp == testTime.Unix() &&
+			r.Header.Get(HeaderSignature) == Sign("secret", timestamp, []byte(`{"id":"evt"}`)) &&
+			r.Header.Get(HeaderEvent) == "order.paid" && r.Header.Get(HeaderDelivery) == "delivery"
+	})
+
+	if err := sender.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !signed {
+		t.Error("the request wasn't signed with the webhook's secret")
+	}
+	if got := storedDelivery(t, hooks); got.Status != models.DeliverySucceeded || got.Attempts != 1 || got.LastStatusCode != http.StatusOK {
+		t.Errorf("delivery = %+v, want one successful attempt", got)
+	}
+}
+
+func TestSenderBacksOffThenDeadLetters(t *testing.T) {
+	requests := 0
+	sender, hooks := testSender(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	now := testTime
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		sender.Clock = clock.Fixed(now)
+		if err := sender.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		got := storedDelivery(t, hooks)
+		if got.Attempts != attempt || got.LastStatusCode != http.StatusServiceUnavailable || got.LastError == "" {
+			t.Fatalf("after attempt %d delivery = %+v", attempt, got)
+		}
+		if attempt < 3 {
+			if want := now.Add(Backoff(attempt)); got.Status != models.DeliveryPending || !got.NextAttemptAt.Equal(want) {
+				t.Fatalf("after attempt %d delivery is %s until %v, want pending until %v", attempt, got.Status, got.NextAttemptAt, want)
+			}
+
+			// Nothing is sent before the retry is due
+			sender.Clock = clock.Fixed(got.NextAttemptAt.Add(-time.Second))
+			sender.Run(context.Background())
+			if requests != attempt {
+				t.Fatalf("sent %d requests before the retry was due, want %d", requests, attempt)
+			}
+			now = got.NextAttemptAt
+		} else if got.Status != models.DeliveryDeadLetter {
+			t.Errorf("after the last attempt delivery is %s, want dead letter", got.Status)
+		}
+	}
+}